@@ -0,0 +1,176 @@
+package bactract
+
+// Transcode the (UTF-8) output of the writers to other character sets
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	//
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// Charset is an output character set along with the names used for it
+// by Oracle (SQL*Loader) and PostgreSQL (client_encoding)
+type Charset struct {
+	OraName  string
+	PgName   string
+	IanaName string
+	Encoding encoding.Encoding
+}
+
+// charsets are the supported output character sets
+var charsets = []Charset{
+	{"UTF8", "UTF8", "UTF-8", unicode.UTF8},
+	{"WE8ISO8859P1", "LATIN1", "ISO-8859-1", charmap.ISO8859_1},
+	{"EE8ISO8859P2", "LATIN2", "ISO-8859-2", charmap.ISO8859_2},
+	{"CL8ISO8859P5", "ISO_8859_5", "ISO-8859-5", charmap.ISO8859_5},
+	{"WE8ISO8859P15", "LATIN9", "ISO-8859-15", charmap.ISO8859_15},
+	{"TH8TISASCII", "WIN874", "windows-874", charmap.Windows874},
+	{"EE8MSWIN1250", "WIN1250", "windows-1250", charmap.Windows1250},
+	{"CL8MSWIN1251", "WIN1251", "windows-1251", charmap.Windows1251},
+	{"WE8MSWIN1252", "WIN1252", "windows-1252", charmap.Windows1252},
+	{"EL8MSWIN1253", "WIN1253", "windows-1253", charmap.Windows1253},
+	{"TR8MSWIN1254", "WIN1254", "windows-1254", charmap.Windows1254},
+	{"IW8MSWIN1255", "WIN1255", "windows-1255", charmap.Windows1255},
+	{"AR8MSWIN1256", "WIN1256", "windows-1256", charmap.Windows1256},
+	{"BLT8MSWIN1257", "WIN1257", "windows-1257", charmap.Windows1257},
+	{"VN8MSWIN1258", "WIN1258", "windows-1258", charmap.Windows1258},
+	{"JA16SJIS", "SJIS", "Shift_JIS", japanese.ShiftJIS},
+	{"JA16EUC", "EUC_JP", "EUC-JP", japanese.EUCJP},
+	{"ZHS16GBK", "GBK", "GBK", simplifiedchinese.GBK},
+	{"ZHT16BIG5", "BIG5", "Big5", traditionalchinese.Big5},
+	// NB the x/text EUC-KR is the WHATWG EUC-KR, which is code page 949
+	// (UHC) rather than the strict (KS X 1001 only) EUC-KR
+	{"KO16MSWIN949", "UHC", "windows-949", korean.EUCKR},
+}
+
+// LookupCharset returns the output character set for the Oracle,
+// PostgreSQL, or IANA name (case insensitive)
+func LookupCharset(name string) (cs Charset, err error) {
+
+	for _, c := range charsets {
+		if strings.EqualFold(name, c.OraName) || strings.EqualFold(name, c.PgName) || strings.EqualFold(name, c.IanaName) {
+			return c, err
+		}
+	}
+
+	// Some additional aliases
+	switch strings.ToUpper(strings.Replace(name, "-", "", -1)) {
+	case "AL32UTF8", "UTF8":
+		return charsets[0], err
+	case "LATIN1", "ISO88591":
+		return LookupCharset("ISO-8859-1")
+	case "CP1252", "WINDOWS1252":
+		return LookupCharset("windows-1252")
+	}
+
+	return cs, fmt.Errorf("unsupported charset %q", name)
+}
+
+// LookupUnmappablePolicy returns the policy (UnmappableReplace,
+// UnmappableDrop, or UnmappableError) for the name (replace, drop, or
+// error)
+func LookupUnmappablePolicy(name string) (p int, err error) {
+	switch strings.ToLower(name) {
+	case "", "replace":
+		return UnmappableReplace, err
+	case "drop":
+		return UnmappableDrop, err
+	case "error":
+		return UnmappableError, err
+	}
+	return p, fmt.Errorf("unsupported unmappable character policy %q", name)
+}
+
+// IsUTF8 returns true if the character set is UTF-8 (no transcoding needed)
+func (cs Charset) IsUTF8() bool {
+	return cs.Encoding == nil || cs.Encoding == unicode.UTF8
+}
+
+// NewWriter returns a writer that transcodes the UTF-8 written to it to
+// the character set before writing to w. Characters that cannot be
+// mapped to the character set are dealt with according to the policy.
+func (cs Charset) NewWriter(w io.Writer, policy int) io.Writer {
+	if cs.IsUTF8() {
+		return w
+	}
+	return &charsetWriter{
+		w:      w,
+		enc:    cs.Encoding.NewEncoder(),
+		name:   cs.OraName,
+		policy: policy,
+	}
+}
+
+type charsetWriter struct {
+	w       io.Writer
+	enc     *encoding.Encoder
+	name    string
+	policy  int
+	pending []byte // an incomplete UTF-8 sequence from the previous write
+}
+
+func (cw *charsetWriter) Write(p []byte) (n int, err error) {
+
+	b := append(cw.pending, p...)
+	cw.pending = nil
+
+	// Don't split multi-byte characters across writes
+	cut := len(b)
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	if cut < len(b) {
+		cw.pending = append([]byte(nil), b[cut:]...)
+		b = b[:cut]
+	}
+
+	out, err := cw.enc.Bytes(b)
+	if err != nil {
+		out, err = cw.encodeRunes(b)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = cw.w.Write(out)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), err
+}
+
+// encodeRunes encodes the UTF-8 one character at a time, applying the
+// unmappable character policy to those characters that cannot be
+// encoded
+func (cw *charsetWriter) encodeRunes(b []byte) (out []byte, err error) {
+
+	for _, r := range string(b) {
+		e, err := cw.enc.String(string(r))
+		if err != nil {
+			switch cw.policy {
+			case UnmappableDrop:
+				continue
+			case UnmappableError:
+				return out, fmt.Errorf("character %q (U+%04X) cannot be mapped to %s", r, r, cw.name)
+			}
+			e = "?"
+		}
+		out = append(out, e...)
+	}
+	return out, err
+}
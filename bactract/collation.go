@@ -0,0 +1,270 @@
+package bactract
+
+// Determine the code page for the collations found in the model and
+// decode the non-Unicode (code page) character data.
+//
+// NB that the char, varchar, and text data in the BCP files is stored
+// as UTF-16 so the code page is only needed for those values that carry
+// non-Unicode character data (sql_variant and binary XML).
+
+import (
+	"strings"
+
+	//
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+const defaultCodePage = 1252
+
+// codePages maps the code pages used by SQL Server collations to the
+// corresponding encoding
+var codePages = map[int]encoding.Encoding{
+	437:   charmap.CodePage437,
+	850:   charmap.CodePage850,
+	874:   charmap.Windows874,
+	932:   japanese.ShiftJIS,
+	936:   simplifiedchinese.GBK,
+	949:   korean.EUCKR,
+	950:   traditionalchinese.Big5,
+	1250:  charmap.Windows1250,
+	1251:  charmap.Windows1251,
+	1252:  charmap.Windows1252,
+	1253:  charmap.Windows1253,
+	1254:  charmap.Windows1254,
+	1255:  charmap.Windows1255,
+	1256:  charmap.Windows1256,
+	1257:  charmap.Windows1257,
+	1258:  charmap.Windows1258,
+	65001: unicode.UTF8,
+}
+
+// lcidCodePages maps the (primary language of the) LCID to the code
+// page. Those LCIDs not listed use 1252.
+var lcidCodePages = map[int]int{
+	0x01: 1256, // Arabic
+	0x04: 936,  // Chinese (see lcidToCodePage)
+	0x05: 1250, // Czech
+	0x08: 1253, // Greek
+	0x0d: 1255, // Hebrew
+	0x0e: 1250, // Hungarian
+	0x11: 932,  // Japanese
+	0x12: 949,  // Korean
+	0x15: 1250, // Polish
+	0x18: 1250, // Romanian
+	0x19: 1251, // Russian
+	0x1a: 1250, // Croatian, Serbian (Latin)
+	0x1b: 1250, // Slovak
+	0x1c: 1250, // Albanian
+	0x1e: 874,  // Thai
+	0x1f: 1254, // Turkish
+	0x20: 1256, // Urdu
+	0x22: 1251, // Ukrainian
+	0x23: 1251, // Belarusian
+	0x24: 1250, // Slovenian
+	0x25: 1257, // Estonian
+	0x26: 1257, // Latvian
+	0x27: 1257, // Lithuanian
+	0x29: 1256, // Farsi
+	0x2a: 1258, // Vietnamese
+	0x2f: 1251, // Macedonian
+	0x3f: 1251, // Kazakh
+	0x43: 1251, // Uzbek (Cyrillic)
+	0x44: 1251, // Tatar
+	0x50: 1251, // Mongolian
+}
+
+// collationPrefixes maps the leading portion of the Windows collation
+// names to the code page. Those not listed use 1252.
+var collationPrefixes = map[string]int{
+	"Albanian":         1250,
+	"Arabic":           1256,
+	"Azeri_Cyrillic":   1251,
+	"Bosnian_Latin":    1250,
+	"Chinese_Hong":     950,
+	"Chinese_PRC":      936,
+	"Chinese_Simp":     936,
+	"Chinese_Taiwan":   950,
+	"Chinese_Trad":     950,
+	"Croatian":         1250,
+	"Cyrillic":         1251,
+	"Czech":            1250,
+	"Estonian":         1257,
+	"Greek":            1253,
+	"Hebrew":           1255,
+	"Hungarian":        1250,
+	"Japanese":         932,
+	"Kazakh":           1251,
+	"Korean":           949,
+	"Latvian":          1257,
+	"Lithuanian":       1257,
+	"Macedonian":       1251,
+	"Polish":           1250,
+	"Romanian":         1250,
+	"Serbian_Cyrillic": 1251,
+	"Serbian_Latin":    1250,
+	"Slovak":           1250,
+	"Slovenian":        1250,
+	"Tatar":            1251,
+	"Thai":             874,
+	"Turkish":          1254,
+	"Ukrainian":        1251,
+	"Urdu":             1256,
+	"Uzbek_Latin":      1254,
+	"Vietnamese":       1258,
+}
+
+// CollationInfo contains the comparison semantics of a collation
+type CollationInfo struct {
+	Name              string
+	IsCaseSensitive   bool
+	IsAccentSensitive bool
+	IsBinary          bool // binary collations compare the code points (and are case and accent sensitive)
+}
+
+// ParseCollation determines the comparison semantics of a collation
+// from the name (Latin1_General_CI_AS, SQL_Latin1_General_CP1_CS_AS,
+// Latin1_General_BIN2, etc.)
+func ParseCollation(name string) (ci CollationInfo) {
+
+	ci.Name = name
+	for _, tok := range strings.Split(strings.ToUpper(name), "_") {
+		switch tok {
+		case "BIN", "BIN2":
+			ci.IsBinary = true
+			ci.IsCaseSensitive = true
+			ci.IsAccentSensitive = true
+		case "CS":
+			ci.IsCaseSensitive = true
+		case "AS":
+			ci.IsAccentSensitive = true
+		}
+	}
+	return ci
+}
+
+// collationToCodePage determines the code page for a collation name.
+// The SQL collation names include the code page (SQL_Latin1_General_CP1_CI_AS,
+// SQL_Latin1_General_CP1250_CI_AS, etc.) while the code page for the
+// Windows collation names (Latin1_General_CI_AS, etc.) depends on the
+// language.
+func collationToCodePage(name string) int {
+
+	switch {
+	case name == "":
+		return 0
+	case strings.Contains(strings.ToUpper(name), "_UTF8"):
+		return 65001
+	case strings.HasPrefix(name, "SQL_"):
+		for _, tok := range strings.Split(name, "_") {
+			if !strings.HasPrefix(tok, "CP") {
+				continue
+			}
+			cp, err := toInt([]byte(strings.TrimPrefix(tok, "CP")))
+			if err != nil {
+				continue
+			}
+			if cp == 1 {
+				return 1252
+			}
+			if _, ok := codePages[cp]; ok {
+				return cp
+			}
+		}
+		return defaultCodePage
+	}
+
+	for prefix, cp := range collationPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return cp
+		}
+	}
+	return defaultCodePage
+}
+
+// lcidToCodePage determines the code page for an LCID
+func lcidToCodePage(lcid int) int {
+
+	switch lcid {
+	case 0:
+		return 0
+	case 0x0404, 0x0c04, 0x1404: // Chinese (Taiwan, Hong Kong, Macao)
+		return 950
+	case 0x081a, 0x141a: // Serbian (Latin), Bosnian (Latin)
+		return 1250
+	case 0x0c1a, 0x201a: // Serbian (Cyrillic), Bosnian (Cyrillic)
+		return 1251
+	}
+
+	cp, ok := lcidCodePages[lcid&0x3ff]
+	if ok {
+		return cp
+	}
+	return defaultCodePage
+}
+
+// sortIDToCodePage determines the code page for the sort ID of a SQL
+// collation. Not all SQL collation sort IDs are known.
+func sortIDToCodePage(sortID int) int {
+
+	switch {
+	case sortID >= 30 && sortID <= 34:
+		return 437
+	case sortID >= 40 && sortID <= 49, sortID >= 55 && sortID <= 61:
+		return 850
+	case sortID >= 50 && sortID <= 54, sortID >= 183 && sortID <= 186, sortID >= 210 && sortID <= 217:
+		return 1252
+	case sortID >= 80 && sortID <= 98:
+		return 1250
+	case sortID >= 104 && sortID <= 108:
+		return 1251
+	case sortID >= 112 && sortID <= 124:
+		return 1253
+	case sortID >= 128 && sortID <= 130:
+		return 1254
+	case sortID >= 136 && sortID <= 138:
+		return 1255
+	case sortID >= 144 && sortID <= 146:
+		return 1256
+	case sortID >= 152 && sortID <= 160:
+		return 1257
+	}
+	return 0
+}
+
+// collationBytesToCodePage determines the code page for the 5 byte
+// collation found in sql_variant properties. The first 4 bytes contain
+// the LCID (20 bits) and flags, the final byte is the SQL sort ID (0
+// for Windows collations).
+func collationBytesToCodePage(b []byte) int {
+
+	if len(b) < 5 {
+		return 0
+	}
+
+	if cp := sortIDToCodePage(int(b[4])); cp != 0 {
+		return cp
+	}
+
+	lcid := int(b[0]) | int(b[1])<<8 | int(b[2]&0x0f)<<16
+	return lcidToCodePage(lcid)
+}
+
+// decodeCodePage translates the non-Unicode character data for the
+// specified code page to a string. Unknown code pages are treated as 1252.
+func decodeCodePage(b []byte, cp int) (s string, err error) {
+
+	enc, ok := codePages[cp]
+	if !ok {
+		enc = codePages[defaultCodePage]
+	}
+
+	var d []byte
+	d, err = enc.NewDecoder().Bytes(b)
+	return string(d), err
+}
@@ -0,0 +1,33 @@
+package bactract
+
+import (
+	"testing"
+)
+
+func TestCollationToCodePage(t *testing.T) {
+
+	tests := []struct {
+		name string
+		want int
+	}{
+		{"", 0},
+		{"SQL_Latin1_General_CP1_CI_AS", 1252},
+		{"SQL_Latin1_General_CP1250_CI_AS", 1250},
+		{"SQL_Latin1_General_CP437_BIN", 437},
+		{"Latin1_General_CI_AS", 1252},
+		{"Latin1_General_100_CI_AS_SC_UTF8", 65001},
+		{"Cyrillic_General_CI_AS", 1251},
+		{"Japanese_CI_AS", 932},
+		{"Korean_Wansung_CI_AS", 949},
+		{"Chinese_PRC_CI_AS", 936},
+		{"Chinese_Taiwan_Stroke_CI_AS", 950},
+		{"Serbian_Cyrillic_100_CI_AS", 1251},
+		{"Serbian_Latin_100_CI_AS", 1250},
+	}
+
+	for _, tt := range tests {
+		if got := collationToCodePage(tt.name); got != tt.want {
+			t.Errorf("%q: got %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
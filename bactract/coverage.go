@@ -0,0 +1,273 @@
+package bactract
+
+// Report on the model.xml coverage: which element types and properties
+// are consumed by, or ignored by, the model extraction, and which
+// objects are affected by what is ignored.
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	//
+	"golang.org/x/net/html/charset"
+)
+
+// CoverageItem contains the count of an element type, or of a property
+// of an element type, found in the model
+type CoverageItem struct {
+	ElementType string   `json:"elementType"`
+	Property    string   `json:"property,omitempty"` // empty for the element type itself
+	Count       int      `json:"count"`
+	IsConsumed  bool     `json:"isConsumed"`
+	Objects     []string `json:"objects,omitempty"` // the objects with the (ignored) element type or property
+}
+
+// CoverageFinding contains an object that will not migrate as is, such
+// as a computed column (which is not in the BCP data) or a column of an
+// unknown datatype
+type CoverageFinding struct {
+	Object string `json:"object"`
+	Issue  string `json:"issue"`
+}
+
+// Coverage contains the model coverage report
+type Coverage struct {
+	Items    []CoverageItem    `json:"items"`
+	Findings []CoverageFinding `json:"findings"`
+}
+
+// columnProperties are the column properties consumed by extractTables
+var columnProperties = []string{"Length", "Scale", "Precision", "IsNullable",
+	"Collation", "IsSparse", "IsFileStream", "IsRowGuidCol", "IsColumnSet",
+	"IsIdentity", "ExpressionScript", "IsPersisted", "GeneratedAlwaysType",
+	"IsHidden"}
+
+// routineProperties are the routine properties consumed by extractRoutines
+var routineProperties = []string{"BodyScript", "IsInsertTrigger",
+	"IsUpdateTrigger", "IsDeleteTrigger", "SqlTriggerType"}
+
+// consumedProperties lists, by element (or annotation) type, the
+// properties that are consumed by the model extraction. The element
+// types not listed are ignored.
+//
+// NB that this needs to be kept in step with the extract functions.
+var consumedProperties = map[string][]string{
+	"SqlDatabaseOptions":                   {"Collation"},
+	"SqlTable":                             {"IsMemoryOptimized", "Durability"},
+	"SqlTableType":                         {},
+	"SqlSimpleColumn":                      columnProperties,
+	"SqlComputedColumn":                    columnProperties,
+	"SqlTableTypeSimpleColumn":             columnProperties,
+	"SqlTableTypeComputedColumn":           columnProperties,
+	"SqlTypeSpecifier":                     {"Length", "Scale", "Precision", "IsNullable", "IsMax"},
+	"SqlIdentityOptions":                   {"IdentitySeed", "IdentityIncrement"},
+	"SqlUserDefinedDataType":               {"Length", "Precision", "Scale", "IsNullable"},
+	"SqlUserDefinedType":                   {"ClassName"},
+	"SqlPrimaryKeyConstraint":              {"IsClustered"},
+	"SqlUniqueConstraint":                  {"IsClustered"},
+	"SqlForeignKeyConstraint":              {"DeleteAction", "UpdateAction", "IsNotForReplication", "NotForReplication", "IsDisabled", "Disabled", "IsEnabled", "WithNoCheck", "IsNotTrusted"},
+	"SqlCheckConstraint":                   {"CheckExpressionScript"},
+	"SqlDefaultConstraint":                 {"DefaultExpressionScript"},
+	"SqlIndex":                             {"IsUnique", "IsClustered", "FilterPredicate"},
+	"SqlIndexedColumnSpecification":        {"IsAscending"},
+	"SqlView":                              {"QueryScript"},
+	"SqlProcedure":                         routineProperties,
+	"SqlScalarFunction":                    routineProperties,
+	"SqlInlineTableValuedFunction":         routineProperties,
+	"SqlMultiStatementTableValuedFunction": routineProperties,
+	"SqlDmlTrigger":                        routineProperties,
+	"SqlScriptFunctionImplementation":      {"BodyScript"},
+	"SqlSubroutineParameter":               {"IsOutput", "DefaultExpressionScript"},
+	"SqlSchema":                            {},
+	"SqlSequence":                          {"StartValue", "IncrementValue", "MinValue", "MaxValue", "NoMinValue", "NoMaxValue", "IsCycling", "CacheSize", "IsCached", "NoCache"},
+	"SqlSynonym":                           {"ForObjectScript"},
+	"SqlExtendedProperty":                  {"Value"},
+	"SqlUser":                              {"AuthenticationType", "WithoutLogin"},
+	"SqlRole":                              {},
+	"SqlRoleMembership":                    {},
+	"SqlPermissionStatement":               {},
+	"SqlPartitionFunction":                 {"Range"},
+	"SqlPartitionValue":                    {"ExpressionScript"},
+	"SqlPartitionScheme":                   {},
+	"SysCommentsObjectAnnotation":          {"HeaderContents"},
+	"SqlInlineConstraintAnnotation":        {},
+}
+
+// isConsumed returns true if the element type (and property) is
+// consumed by the model extraction
+func isConsumed(elementType, property string) bool {
+	props, ok := consumedProperties[elementType]
+	if !ok || property == "" {
+		return ok
+	}
+	for _, p := range props {
+		if p == property {
+			return true
+		}
+	}
+	return false
+}
+
+// GetCoverage walks the model.xml file and counts the element types and
+// properties, marking each as consumed or ignored by the model
+// extraction, and lists the objects that will not migrate as is.
+func (b Bacpac) GetCoverage(ef string) (c Coverage, err error) {
+
+	c.Items, err = b.modelCoverage()
+	if err != nil {
+		return c, err
+	}
+
+	m, err := b.GetModel(ef)
+	if err != nil {
+		return c, err
+	}
+	c.Findings = modelFindings(m)
+
+	return c, err
+}
+
+// modelCoverage counts the element types and properties in the model
+func (b Bacpac) modelCoverage() (items []CoverageItem, err error) {
+
+	f, err := os.Open(b.ModelFileName())
+	if err != nil {
+		return items, err
+	}
+	defer func() {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	dec := xml.NewDecoder(f)
+	dec.CharsetReader = charset.NewReaderLabel
+	dec.Strict = false
+
+	counts := make(map[[2]string]*CoverageItem)
+	objects := make(map[[2]string]map[string]bool)
+
+	count := func(elementType, property, object string) {
+		k := [2]string{elementType, property}
+		ci, ok := counts[k]
+		if !ok {
+			ci = &CoverageItem{ElementType: elementType, Property: property, IsConsumed: isConsumed(elementType, property)}
+			counts[k] = ci
+			objects[k] = make(map[string]bool)
+		}
+		ci.Count++
+		if !ci.IsConsumed && object != "" {
+			objects[k][normalizeQN(object)] = true
+		}
+	}
+
+	// The element (or annotation) that is being walked. Unnamed elements
+	// (and annotations) take the name of the enclosing element.
+	type context struct {
+		elementType string
+		name        string
+	}
+	var stack []context
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return items, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "Element", "Annotation":
+				ctx := context{elementType: xmlAttr(t, "Type"), name: xmlAttr(t, "Name")}
+				if len(stack) > 0 && (ctx.name == "" || t.Name.Local == "Annotation") {
+					ctx.name = stack[len(stack)-1].name
+				}
+				stack = append(stack, ctx)
+				count(ctx.elementType, "", ctx.name)
+			case "Property":
+				if len(stack) > 0 {
+					ctx := stack[len(stack)-1]
+					count(ctx.elementType, xmlAttr(t, "Name"), ctx.name)
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "Element", "Annotation":
+				if len(stack) > 0 {
+					stack = stack[:len(stack)-1]
+				}
+			}
+		}
+	}
+
+	for k, ci := range counts {
+		for o := range objects[k] {
+			ci.Objects = append(ci.Objects, o)
+		}
+		sort.Strings(ci.Objects)
+		items = append(items, *ci)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].ElementType != items[j].ElementType {
+			return items[i].ElementType < items[j].ElementType
+		}
+		return items[i].Property < items[j].Property
+	})
+
+	return items, err
+}
+
+// xmlAttr returns the value of an attribute of an XML element
+func xmlAttr(t xml.StartElement, name string) string {
+	for _, a := range t.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// modelFindings lists the table columns, and tables, that will not
+// migrate as is
+func modelFindings(m ExtractedModel) (findings []CoverageFinding) {
+
+	var tables []string
+	for k := range m.Tables {
+		tables = append(tables, k)
+	}
+	sort.Strings(tables)
+
+	for _, k := range tables {
+		t := m.Tables[k]
+
+		if t.Durability == "SCHEMA_ONLY" {
+			findings = append(findings, CoverageFinding{k, "memory-optimized SCHEMA_ONLY table, there is no data"})
+		}
+
+		for _, c := range t.Columns {
+			qn := strings.Join([]string{k, c.ColName}, ".")
+			switch {
+			case c.IsComputed:
+				findings = append(findings, CoverageFinding{qn, "computed column (persisted or not), not in the BCP data"})
+			case c.IsColumnSet:
+				findings = append(findings, CoverageFinding{qn, "sparse column set, not in the BCP data"})
+			case c.IsFileStream:
+				findings = append(findings, CoverageFinding{qn, "FILESTREAM column, not in the BCP data"})
+			case c.IsClrType:
+				findings = append(findings, CoverageFinding{qn, fmt.Sprintf("CLR type %s, the data cannot be extracted", c.DtStr)})
+			case c.DataType == NullDatatype:
+				findings = append(findings, CoverageFinding{qn, fmt.Sprintf("unknown datatype %s", c.DtStr)})
+			}
+		}
+	}
+	return findings
+}
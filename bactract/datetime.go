@@ -10,9 +10,9 @@ import (
 // Note 1. A datetime is stored as two integers (one for the date and
 // one for the time) that appear to be offsets from 1900-01-01 00:00:00.
 //
-// Note 2. The value for the time potion of the datetime appears to be
-// the seconds since midnight multiplied by 300 (5 minutes). I don't know
-// why.
+// Note 2. The value for the time potion of the datetime is the number
+// of 1/300 second ticks since midnight. SQL Server rounds these to
+// milliseconds ending in .000, .003 or .007 (see datetimeMillis).
 //
 // Note 3. Go does not account for leap seconds when dong datetime
 // calculations. Whether, or how much of an issue this is unknown--
@@ -63,13 +63,31 @@ func readDatetime(r *tReader, tc TableColumn) (ec ExtractedColumn, err error) {
 			s |= int32(sb) << uint(8*i)
 		}
 
+		// 300 ticks per second * 60 * 60 * 24
+		if s < 0 || s >= 25920000 {
+			err = fmt.Errorf("%s invalid time ticks (%d) for column %q", fn, s, tc.ColName)
+			return
+		}
+
 		start := time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC)
 		d := start.AddDate(0, 0, int(days))
-		m, _ := time.ParseDuration(fmt.Sprintf("%ds", s/300))
-		dt := d.Add(m)
+		m := time.Duration(datetimeMillis(s)) * time.Millisecond
 
-		ec.Str = dt.Format("2006-01-02 15:04:05")
+		digits := fracSecDigits(3)
+		dt := roundFracSec(d.Add(m), digits)
+
+		ec.Str = dt.Format(calcDatetimeFormat(digits))
 	}
 
 	return
 }
+
+// datetimeMillis converts the 1/300 second ticks of a datetime to
+// milliseconds using the SQL Server rounding rules. Each tick is 3 1/3
+// milliseconds which gets rounded to the nearest millisecond, giving
+// values ending in 0, 3 or 7 (i.e. 1 tick -> 3 ms, 2 ticks -> 7 ms, 3
+// ticks -> 10 ms). Note that the final tick of the day (25919999)
+// rounds to 23:59:59.997 so there is no overflow into the next day.
+func datetimeMillis(ticks int32) int64 {
+	return (int64(ticks)*10 + 1) / 3
+}
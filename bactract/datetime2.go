@@ -6,11 +6,16 @@ import (
 	"time"
 )
 
-// readDatetime2 reads the value for a datetime column.
+// readDatetime2 reads the value for a datetime2 column.
 func readDatetime2(r *tReader, tc TableColumn) (ec ExtractedColumn, err error) {
 
 	fn := "readDatetime2"
-	defSz := 8
+	dateSize := 3
+	timeSize, err := calcTimeSize(tc.Scale)
+	if err != nil {
+		return
+	}
+	defSz := dateSize + timeSize
 	if debugFlag {
 		debOut(fmt.Sprintf("Func %s", fn))
 	}
@@ -31,8 +36,7 @@ func readDatetime2(r *tReader, tc TableColumn) (ec ExtractedColumn, err error) {
 	// Read the datetime
 	if ss.byteCount > 0 {
 
-		dateSize := 3
-		timeSize := ss.byteCount - dateSize
+		timeSize = ss.byteCount - dateSize
 
 		var s, y []byte
 		s, err = r.readBytes(fmt.Sprintf("%s: timeBytes", fn), timeSize)
@@ -59,16 +63,16 @@ func readDatetime2(r *tReader, tc TableColumn) (ec ExtractedColumn, err error) {
 		d := start.AddDate(0, 0, days)
 
 		// Add the time portion
-		var duration string
-		duration, err = calcTimeDuration(tc.Scale, ticks)
+		var m time.Duration
+		m, err = calcTimeDuration(tc.Scale, ticks)
 		if err != nil {
 			return
 		}
 
-		m, _ := time.ParseDuration(duration)
-		dt := d.Add(m)
+		digits := fracSecDigits(tc.Scale)
+		dt := roundFracSec(d.Add(m), digits)
 
-		ec.Str = dt.Format(calcDatetimeFormat(tc.Scale, ticks))
+		ec.Str = dt.Format(calcDatetimeFormat(digits))
 	}
 
 	return
@@ -133,7 +137,10 @@ func readDate(r *tReader, tc TableColumn) (ec ExtractedColumn, err error) {
 func readTime(r *tReader, tc TableColumn) (ec ExtractedColumn, err error) {
 
 	fn := "readTime"
-	defSz := 5
+	defSz, err := calcTimeSize(tc.Scale)
+	if err != nil {
+		return
+	}
 	if debugFlag {
 		debOut(fmt.Sprintf("Func %s", fn))
 	}
@@ -168,43 +175,71 @@ func readTime(r *tReader, tc TableColumn) (ec ExtractedColumn, err error) {
 		d := time.Date(1901, 1, 1, 0, 0, 0, 0, time.UTC)
 
 		// Add the time
-		var duration string
-		duration, err = calcTimeDuration(tc.Scale, ticks)
+		var m time.Duration
+		m, err = calcTimeDuration(tc.Scale, ticks)
 		if err != nil {
 			return
 		}
 
-		m, _ := time.ParseDuration(duration)
-		t := d.Add(m)
+		// NB rounding up to the next day wraps around to midnight,
+		// which is what SQL Server does when casting to a lower scale
+		digits := fracSecDigits(tc.Scale)
+		t := roundFracSec(d.Add(m), digits)
 
-		ec.Str = t.Format(calcTimeFormat(tc.Scale, ticks))
+		ec.Str = t.Format(calcTimeFormat(digits))
 	}
 
 	return
 }
 
-func calcDatetimeFormat(scale int, ticks uint64) (dtf string) {
+// FracSecDigits returns the number of fractional second digits that
+// are output for the column
+func (tc TableColumn) FracSecDigits() int {
+	switch tc.DataType {
+	case Datetime:
+		return fracSecDigits(3)
+	case Datetime2, Time:
+		return fracSecDigits(tc.Scale)
+	}
+	return 0
+}
 
-	var ns []string
-	ns = append(ns, "2006-01-02 15:04:05")
-	if scale > 0 {
-		ns = append(ns, ".")
-		for i := 0; i < scale; i++ {
-			ns = append(ns, "0")
-		}
+// fracSecDigits returns the number of fractional second digits to
+// output for a column whose native fractional second scale is scale.
+func fracSecDigits(scale int) int {
+	switch {
+	case timePrecision < 0:
+		return scale
+	case timePrecision > 9:
+		return 9
+	}
+	return timePrecision
+}
+
+// roundFracSec rounds the fractional seconds of t to the specified
+// number of digits
+func roundFracSec(t time.Time, digits int) time.Time {
+	if digits >= 9 {
+		return t
 	}
-	dtf = strings.Join(ns, "")
+	d := time.Duration(1)
+	for i := digits; i < 9; i++ {
+		d *= 10
+	}
+	return t.Round(d)
+}
 
-	return dtf
+func calcDatetimeFormat(digits int) (dtf string) {
+	return "2006-01-02 " + calcTimeFormat(digits)
 }
 
-func calcTimeFormat(scale int, ticks uint64) (tf string) {
+func calcTimeFormat(digits int) (tf string) {
 
 	var ns []string
 	ns = append(ns, "15:04:05")
-	if scale > 0 {
+	if digits > 0 {
 		ns = append(ns, ".")
-		for i := 0; i < scale; i++ {
+		for i := 0; i < digits; i++ {
 			ns = append(ns, "0")
 		}
 	}
@@ -213,55 +248,50 @@ func calcTimeFormat(scale int, ticks uint64) (tf string) {
 	return tf
 }
 
-func calcTimeDuration(scale int, ticks uint64) (pds string, err error) {
-
-	var u = map[int]string{
-		0: "s",
-		1: "ms",
-		2: "ms",
-		3: "ms",
-		4: "us",
-		5: "us",
-		6: "us",
-		7: "ns",
+// calcTimeSize returns the number of bytes used to store the time
+// portion of a time, datetime2, or datetimeoffset having the specified scale
+func calcTimeSize(scale int) (sz int, err error) {
+
+	switch {
+	case scale >= 0 && scale <= 2:
+		sz = 3
+	case scale <= 4:
+		sz = 4
+	case scale <= 7:
+		sz = 5
+	default:
+		err = fmt.Errorf("Could not determine the time size. Unknown scale (%d)", scale)
 	}
+	return sz, err
+}
 
-	units, ok := u[scale]
-	if !ok {
-		err = fmt.Errorf("Could not determine units for datetime2 time duration. Unknown scale (%d)", scale)
-		return pds, err
+// calcTimeDuration converts the stored ticks for a time having the
+// specified scale to the duration since midnight. The ticks are in
+// units of 10^-scale seconds:
+//
+//	0 -> ticks * 1 s
+//	1 -> ticks * 100 ms
+//	2 -> ticks * 10 ms
+//	3 -> ticks * 1 ms
+//	4 -> ticks * 100 us
+//	5 -> ticks * 10 us
+//	6 -> ticks * 1 us
+//	7 -> ticks * 100 ns
+func calcTimeDuration(scale int, ticks uint64) (d time.Duration, err error) {
+
+	if scale < 0 || scale > 7 {
+		err = fmt.Errorf("Could not determine units for time duration. Unknown scale (%d)", scale)
+		return d, err
 	}
 
-	var pd uint64
-
-	switch scale {
-	case 0:
-		pd = ticks / 1000000
-	case 1:
-		pd = ticks / 100000
-	case 2:
-		pd = ticks / 10000
-	case 3:
-		pd = ticks / 1000
-	case 4:
-		pd = ticks / 100
-	case 5:
-		pd = ticks / 10
-	case 6:
-		pd = ticks
-	case 7:
-		pd = ticks * 100
+	unit := time.Duration(1)
+	for i := scale; i < 9; i++ {
+		unit *= 10
 	}
 
-	// 0 -> ticks * 1 s
-	// 1 -> ticks * 100 ms
-	// 2 -> ticks * 10 ms
-	// 3 -> ticks * 1 ms
-	// 4 -> ticks * 100 us
-	// 5 -> ticks * 10 us
-	// 6 -> ticks * 1 us
-	// 7 -> ticks * 100 ns
-
-	pds = fmt.Sprintf("%d%s", pd, units)
-	return pds, err
+	d = time.Duration(ticks) * unit
+	if d >= 24*time.Hour {
+		err = fmt.Errorf("Invalid time duration (%s) for scale %d", d, scale)
+	}
+	return d, err
 }
@@ -0,0 +1,183 @@
+package bactract
+
+import (
+	"testing"
+)
+
+func TestDatetimeMillis(t *testing.T) {
+
+	tests := []struct {
+		ticks int32
+		want  int64
+	}{
+		{0, 0},
+		{1, 3},
+		{2, 7},
+		{3, 10},
+		{299, 997},
+		{300, 1000},
+		{25919999, 86399997},
+	}
+
+	for _, tt := range tests {
+		if got := datetimeMillis(tt.ticks); got != tt.want {
+			t.Errorf("%d ticks: got %d ms, want %d ms", tt.ticks, got, tt.want)
+		}
+	}
+}
+
+func TestReadDatetime(t *testing.T) {
+
+	// 2020-01-01 is day 43829 (0xab35) from 1900-01-01
+	day := []byte{0x35, 0xab, 0x00, 0x00}
+
+	tests := []struct {
+		name     string
+		nullable bool
+		b        []byte
+		want     string
+	}{
+		{"midnight", false, append(day, 0x00, 0x00, 0x00, 0x00), "2020-01-01 00:00:00.000"},
+		{"237 ticks past 12:34:56", false, append(day, 0x2d, 0x5a, 0xcf, 0x00), "2020-01-01 12:34:56.790"},
+		{"last tick of the day", false, append(day, 0xff, 0x81, 0x8b, 0x01), "2020-01-01 23:59:59.997"},
+		{"nullable", true, append([]byte{0x08}, append(day, 0x01, 0x00, 0x00, 0x00)...), "2020-01-01 00:00:00.003"},
+	}
+
+	for _, tt := range tests {
+		tc := TableColumn{ColName: "d", DataType: Datetime, DtStr: "datetime", IsNullable: tt.nullable}
+		ec, err := readDatetime(variantReader(tt.b), tc)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+		if ec.Str != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, ec.Str, tt.want)
+		}
+	}
+
+	tc := TableColumn{ColName: "d", DataType: Datetime, DtStr: "datetime", IsNullable: true}
+
+	ec, err := readDatetime(variantReader([]byte{0xff}), tc)
+	if err != nil {
+		t.Fatalf("null: unexpected error: %s", err)
+	}
+	if !ec.IsNull {
+		t.Errorf("null: got %q, want null", ec.Str)
+	}
+
+	if _, err := readDatetime(variantReader(append([]byte{0x08}, append(day, 0x00, 0x82, 0x8b, 0x01)...)), tc); err == nil {
+		t.Errorf("one day of ticks: expected an error")
+	}
+}
+
+func TestReadDatetimePrecision(t *testing.T) {
+
+	saved := timePrecision
+	defer func() { timePrecision = saved }()
+
+	// The reader consumes the buffer so each read gets its own copy
+	b := []byte{0x35, 0xab, 0x00, 0x00, 0x2d, 0x5a, 0xcf, 0x00}
+	tc := TableColumn{ColName: "d", DataType: Datetime, DtStr: "datetime"}
+
+	tests := []struct {
+		precision int
+		want      string
+	}{
+		{0, "2020-01-01 12:34:57"},
+		{2, "2020-01-01 12:34:56.79"},
+		{6, "2020-01-01 12:34:56.790000"},
+	}
+
+	for _, tt := range tests {
+		timePrecision = tt.precision
+		ec, err := readDatetime(variantReader(append([]byte{}, b...)), tc)
+		if err != nil {
+			t.Errorf("precision %d: unexpected error: %s", tt.precision, err)
+			continue
+		}
+		if ec.Str != tt.want {
+			t.Errorf("precision %d: got %q, want %q", tt.precision, ec.Str, tt.want)
+		}
+	}
+}
+
+func TestReadDatetime2(t *testing.T) {
+
+	// 2020-01-01 is day 737424 (0x0b4090) from 0001-01-01
+	day := []byte{0x90, 0x40, 0x0b}
+
+	tests := []struct {
+		name  string
+		scale int
+		b     []byte
+		want  string
+	}{
+		{"scale 0", 0, append([]byte{0xf0, 0xb0, 0x00}, day...), "2020-01-01 12:34:56"},
+		{"scale 3", 3, append([]byte{0x95, 0x2c, 0xb3, 0x02}, day...), "2020-01-01 12:34:56.789"},
+		{"scale 7", 7, append([]byte{0x87, 0xee, 0x97, 0x76, 0x69}, day...), "2020-01-01 12:34:56.1234567"},
+	}
+
+	for _, tt := range tests {
+		tc := TableColumn{ColName: "d", DataType: Datetime2, DtStr: "datetime2", Scale: tt.scale}
+		ec, err := readDatetime2(variantReader(tt.b), tc)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+		if ec.Str != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, ec.Str, tt.want)
+		}
+	}
+}
+
+func TestReadTime(t *testing.T) {
+
+	saved := timePrecision
+	defer func() { timePrecision = saved }()
+
+	tests := []struct {
+		name      string
+		precision int
+		b         []byte
+		want      string
+	}{
+		{"full precision", -1, []byte{0x87, 0xee, 0x97, 0x76, 0x69}, "12:34:56.1234567"},
+		{"rounded to ms", 3, []byte{0x87, 0xee, 0x97, 0x76, 0x69}, "12:34:56.123"},
+		{"last tick of the day", -1, []byte{0xff, 0xbf, 0x69, 0x2a, 0xc9}, "23:59:59.9999999"},
+		{"rounding wraps to midnight", 0, []byte{0xff, 0xbf, 0x69, 0x2a, 0xc9}, "00:00:00"},
+	}
+
+	tc := TableColumn{ColName: "t", DataType: Time, DtStr: "time", Scale: 7}
+
+	for _, tt := range tests {
+		timePrecision = tt.precision
+		ec, err := readTime(variantReader(tt.b), tc)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+		if ec.Str != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, ec.Str, tt.want)
+		}
+	}
+}
+
+func TestCalcTimeDurationErrors(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		scale int
+		ticks uint64
+	}{
+		{"scale too large", 8, 0},
+		{"negative scale", -1, 0},
+		{"one day of seconds", 0, 86400},
+		{"one day of 100 ns ticks", 7, 864000000000},
+	}
+
+	for _, tt := range tests {
+		if d, err := calcTimeDuration(tt.scale, tt.ticks); err == nil {
+			t.Errorf("%s: expected an error, got %s", tt.name, d)
+		}
+	}
+}
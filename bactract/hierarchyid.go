@@ -0,0 +1,196 @@
+package bactract
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// hidPattern is a hierarchyid label encoding pattern. The pattern
+// consists of the fixed prefix bits, the label value bits (x), the
+// fixed filler bits (0 or 1), and the terminator bit (T).
+type hidPattern struct {
+	min     int64
+	pattern string
+}
+
+// hidPatterns are the hierarchyid label encoding patterns. The
+// patterns, and the label ranges that they cover, are:
+//
+//	-281479271682120 .. -4294971465  000101...
+//	-4294971464 .. -4169             000110...
+//	-4168 .. -73                     000111...
+//	-72 .. -9                        0010...
+//	-8 .. -1                         00111...
+//	0 .. 3                           01...
+//	4 .. 7                           100...
+//	8 .. 15                          101...
+//	16 .. 79                         110...
+//	80 .. 1103                       1110...
+//	1104 .. 5199                     11110...
+//	5200 .. 4294972495               111110...
+//	4294972496 .. 281479271683151    111111...
+var hidPatterns = []hidPattern{
+	{-281479271682120, "000101xxxxxxxxxxxxxx0xxxxxxxxxxxxxxxxxxxxx0xxxxxx0xxx0x1xxxT"},
+	{-4294971464, "000110xxxxxxxxxxxxxxxxxxx0xxxxxx0xxx0x1xxxT"},
+	{-4168, "000111xxxxx0xxx0x1xxxT"},
+	{-72, "0010xx0x1xxxT"},
+	{-8, "00111xxxT"},
+	{0, "01xxT"},
+	{4, "100xxT"},
+	{8, "101xxxT"},
+	{16, "110xx0x1xxxT"},
+	{80, "1110xxx0xxx0x1xxxT"},
+	{1104, "11110xxxxx0xxx0x1xxxT"},
+	{5200, "111110xxxxxxxxxxxxxxxxxxx0xxxxxx0xxx0x1xxxT"},
+	{4294972496, "111111xxxxxxxxxxxxxx0xxxxxxxxxxxxxxxxxxxxx0xxxxxx0xxx0x1xxxT"},
+}
+
+// readHierarchyID reads the value for a hierarchyid column.
+//
+// Note 1. The hierarchyid is a bit-packed (most significant bit first)
+// list of labels. Each label is encoded using one of the hidPatterns
+// where the terminator bit is 1 for the final label of a level and 0
+// for the labels that are followed by a dot. The non-final labels of a
+// level are stored as one more than their actual value. The final byte
+// is padded with 0 bits.
+//
+// Note 2. I have no suitable bacpac for testing so the size bytes are
+// assumed to be the same as for geography (the other CLR datatype).
+func readHierarchyID(r *tReader, tc TableColumn) (ec ExtractedColumn, err error) {
+
+	fn := "readHierarchyID"
+	if debugFlag {
+		debOut(fmt.Sprintf("Func %s", fn))
+	}
+
+	// Determine how many bytes to read
+	var ss storedSize
+	ss, err = r.readStoredSize(tc, 8, 0)
+	if err != nil {
+		return
+	}
+
+	// Check for nulls
+	if ss.isNull {
+		ec.IsNull = ss.isNull
+		return
+	}
+
+	var b []byte
+	b, err = r.readBytes(fn, ss.byteCount)
+	if err != nil {
+		return
+	}
+
+	ec.Str, err = parseHierarchyID(b)
+	if err != nil {
+		err = fmt.Errorf("%s %s for column %q", fn, err, tc.ColName)
+	}
+	return
+}
+
+// parseHierarchyID translates the hierarchyid bytes to the canonical
+// string form (/1/3.2/7/)
+func parseHierarchyID(b []byte) (s string, err error) {
+
+	bitCount := len(b) * 8
+	bit := func(i int) byte {
+		return (b[i/8] >> uint(7-i%8)) & 0x01
+	}
+
+	// paddingOnly checks if the remaining bits are all padding
+	paddingOnly := func(i int) bool {
+		if bitCount-i >= 8 {
+			return false
+		}
+		for ; i < bitCount; i++ {
+			if bit(i) != 0 {
+				return false
+			}
+		}
+		return true
+	}
+
+	var sb strings.Builder
+	sb.WriteString("/")
+
+	i := 0
+	for i < bitCount && !paddingOnly(i) {
+
+		// Determine the pattern
+		var pat string
+		var min int64
+		for _, p := range hidPatterns {
+			prefix := p.pattern[:strings.Index(p.pattern, "x")]
+			if i+len(prefix) > bitCount {
+				continue
+			}
+			match := true
+			for j := 0; j < len(prefix); j++ {
+				if bit(i+j) != prefix[j]-'0' {
+					match = false
+					break
+				}
+			}
+			if match {
+				pat = p.pattern
+				min = p.min
+				break
+			}
+		}
+		if pat == "" {
+			return s, fmt.Errorf("invalid hierarchyid label at bit %d", i)
+		}
+		if i+len(pat) > bitCount {
+			return s, errors.New("truncated hierarchyid")
+		}
+
+		// Extract the label value and terminator
+		var v int64
+		var isLast bool
+		for j, c := range pat {
+			switch c {
+			case 'x':
+				v = v<<1 | int64(bit(i+j))
+			case 'T':
+				isLast = bit(i+j) == 1
+			}
+		}
+		i += len(pat)
+
+		v += min
+		if isLast {
+			sb.WriteString(fmt.Sprintf("%d/", v))
+		} else {
+			sb.WriteString(fmt.Sprintf("%d.", v-1))
+		}
+	}
+
+	s = sb.String()
+	if strings.HasSuffix(s, ".") {
+		return s, errors.New("unterminated hierarchyid level")
+	}
+	return s, err
+}
+
+// HierarchyIDToLtree translates the canonical string form of a
+// hierarchyid (/1/3.2/-7/) to a PostgreSQL ltree compatible path
+// (1.3_2.n7). The dots within a level are replaced with underscores and
+// the minus signs of negative labels are replaced with "n". The root
+// node (/) is the empty path.
+func HierarchyIDToLtree(s string) string {
+
+	s = strings.Trim(s, "/")
+	if s == "" {
+		return s
+	}
+
+	var labels []string
+	for _, level := range strings.Split(s, "/") {
+		level = strings.Replace(level, ".", "_", -1)
+		level = strings.Replace(level, "-", "n", -1)
+		labels = append(labels, level)
+	}
+	return strings.Join(labels, ".")
+}
@@ -0,0 +1,72 @@
+package bactract
+
+import (
+	"testing"
+)
+
+func TestParseHierarchyID(t *testing.T) {
+
+	// The values as returned by SQL Server for CAST ( '<path>' AS hierarchyid )
+	tests := []struct {
+		b    []byte
+		want string
+	}{
+		{[]byte{}, "/"},
+		{[]byte{0x48}, "/0/"},
+		{[]byte{0x58}, "/1/"},
+		{[]byte{0x68}, "/2/"},
+		{[]byte{0x78}, "/3/"},
+		{[]byte{0x5a, 0xc0}, "/1/1/"},
+		{[]byte{0x5b, 0x40}, "/1/2/"},
+		{[]byte{0x6a, 0xc0}, "/2/1/"},
+		{[]byte{0x62, 0xc0}, "/1.1/"},
+		{[]byte{0x3f, 0x80}, "/-1/"},
+	}
+
+	for _, tt := range tests {
+		got, err := parseHierarchyID(tt.b)
+		if err != nil {
+			t.Errorf("0x%X: unexpected error: %s", tt.b, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("0x%X: got %q, want %q", tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestParseHierarchyIDErrors(t *testing.T) {
+
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{"unterminated level", []byte{0x60}},
+		{"truncated label", []byte{0xfc}},
+	}
+
+	for _, tt := range tests {
+		if got, err := parseHierarchyID(tt.b); err == nil {
+			t.Errorf("%s: expected an error, got %q", tt.name, got)
+		}
+	}
+}
+
+func TestHierarchyIDToLtree(t *testing.T) {
+
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"/", ""},
+		{"/1/", "1"},
+		{"/1/3.2/7/", "1.3_2.7"},
+		{"/-1/2/", "n1.2"},
+	}
+
+	for _, tt := range tests {
+		if got := HierarchyIDToLtree(tt.s); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
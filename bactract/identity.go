@@ -0,0 +1,61 @@
+package bactract
+
+// Track the identity column values read so that the identity sequences
+// of the target database can be advanced once the data is loaded.
+
+import (
+	"log"
+	"strconv"
+	"strings"
+)
+
+// IdentityColumns returns the identity columns for the table
+func (t Table) IdentityColumns() (cols []TableColumn) {
+	for _, c := range t.Columns {
+		if c.IsIdentity {
+			cols = append(cols, c)
+		}
+	}
+	return cols
+}
+
+// trackIdentity records the extracted value for identity columns. For
+// positive increments the largest value is kept, for negative
+// increments the smallest.
+func (r *tReader) trackIdentity(tc TableColumn, ec ExtractedColumn) {
+
+	if !tc.IsIdentity || ec.IsNull {
+		return
+	}
+
+	// decimal(p,0) and numeric(p,0) values have a trailing decimal point
+	v, err := strconv.ParseInt(strings.TrimSuffix(ec.Str, "."), 10, 64)
+	if err != nil {
+		// Only complain once per column
+		if !r.identityErrs[tc.ColName] {
+			if r.identityErrs == nil {
+				r.identityErrs = make(map[string]bool)
+			}
+			r.identityErrs[tc.ColName] = true
+			log.Printf("Unable to track the identity value %q for column %s.%s.%s: %s", ec.Str, r.table.Schema, r.table.TabName, tc.ColName, err)
+		}
+		return
+	}
+
+	if r.identityValues == nil {
+		r.identityValues = make(map[string]int64)
+	}
+
+	last, ok := r.identityValues[tc.ColName]
+	if !ok || (tc.IdentityIncr >= 0 && v > last) || (tc.IdentityIncr < 0 && v < last) {
+		r.identityValues[tc.ColName] = v
+	}
+}
+
+// IdentityValue returns the largest (or smallest, for negative
+// increments) value read so far for the identity column. The ok is false
+// if no values have been read.
+func (r *tReader) IdentityValue(colName string) (v int64, ok bool) {
+	v, ok = r.identityValues[colName]
+	return v, ok
+}
@@ -0,0 +1,45 @@
+package bactract
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// readImage reads the value for an image column. The value is
+// translated to a (lowercase) hex string.
+func readImage(r *tReader, tc TableColumn) (ec ExtractedColumn, err error) {
+
+	fn := "readImage"
+	if debugFlag {
+		debOut(fmt.Sprintf("Func %s", fn))
+	}
+
+	// Determine how many bytes to read-- same as for text and ntext
+	var ss storedSize
+	ss, err = r.readStoredSize(tc, 4, 0)
+	if err != nil {
+		return
+	}
+
+	// Check for nulls
+	if ss.isNull {
+		ec.IsNull = ss.isNull
+		return
+	}
+
+	// Stream large values
+	if r.isStreamed(tc, ss.byteCount) {
+		ec.LobFile, err = r.streamLob(fn, tc, ss.byteCount, lobBinary)
+		return
+	}
+
+	// Read and translate the image
+	var b []byte
+	b, err = r.readBytes(fn, ss.byteCount)
+	if err != nil {
+		return
+	}
+
+	ec.Str = hex.EncodeToString(b)
+	return
+}
@@ -0,0 +1,179 @@
+package bactract
+
+// Stream large values to sidecar files (or other writers) rather than
+// reading them into memory.
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	lobChunkSz = 65536 // the number of bytes to read at a time when streaming a large value
+)
+
+// Kinds of large values
+const (
+	lobText       = iota // UTF-16 character data, written as UTF-8
+	lobBinary     = iota // binary data, written as is
+	lobPaddedText = iota // as lobText, but dropping six leading null bytes (as readString does)
+)
+
+// LobWriterFunc returns the writer that a large value for the column
+// is streamed to along with the reference to record in the extracted
+// column for the value. The writer is closed once the value has been
+// written.
+type LobWriterFunc func(tc TableColumn, rownum uint64, isBinary bool) (w io.WriteCloser, ref string, err error)
+
+// SetLobFiles causes the non-null values of large value columns (see
+// IsLob) that are larger than threshold bytes (as stored) to be
+// streamed to per-value files in dir. The name of the file is stored
+// in the LobFile of the extracted column. A threshold of 0 streams all
+// non-null values, including the empty ones, and a negative threshold
+// disables streaming large values.
+func (r *tReader) SetLobFiles(threshold int, dir string) {
+
+	if threshold < 0 {
+		r.lobWriter = nil
+		return
+	}
+
+	r.lobThreshold = threshold
+	r.lobWriter = func(tc TableColumn, rownum uint64, isBinary bool) (w io.WriteCloser, ref string, err error) {
+
+		ext := "txt"
+		if isBinary {
+			ext = "bin"
+		}
+
+		ref = catDir([]string{dir, fmt.Sprintf("%s.%s.%s.%d.%s", r.table.Schema, r.table.TabName, tc.ColName, rownum, ext)})
+		w, err = os.Create(ref)
+		return w, ref, err
+	}
+}
+
+// SetLobWriter causes the non-null values of large value columns (see
+// IsLob) that are larger than threshold bytes (as stored) to be
+// streamed to the writers returned by f. As with SetLobFiles, a
+// threshold of 0 streams all non-null values. A nil f or a negative
+// threshold disables streaming large values.
+func (r *tReader) SetLobWriter(threshold int, f LobWriterFunc) {
+
+	if threshold < 0 {
+		f = nil
+	}
+	r.lobThreshold = threshold
+	r.lobWriter = f
+}
+
+// IsLob returns true for the columns that can have their values
+// streamed rather than read into memory: text, ntext, image,
+// varbinary, and the varchar(max) and nvarchar(max) columns
+func (tc TableColumn) IsLob() bool {
+	switch tc.DataType {
+	case Text, NText, Image, Varbinary:
+		return true
+	case Varchar, NVarchar:
+		return tc.Length == 0
+	}
+	return false
+}
+
+// isStreamed determines if the value of the column is to be streamed
+func (r *tReader) isStreamed(tc TableColumn, byteCount int) bool {
+	return r.lobWriter != nil && tc.IsLob() && (byteCount > r.lobThreshold || r.lobThreshold == 0)
+}
+
+// streamLob reads the specified number of bytes from the reader, in
+// chunks, and writes them to the writer for the column.
+//
+// As with readString, if a lobPaddedText value starts with six null
+// bytes then those are dropped and an additional six bytes are read.
+func (r *tReader) streamLob(label string, tc TableColumn, n int, kind int) (ref string, err error) {
+
+	if debugFlag {
+		debOut(fmt.Sprintf("%s: Attempting to stream %d bytes", label, n))
+	}
+
+	var w io.WriteCloser
+	w, ref, err = r.lobWriter(tc, r.rownum, kind == lobBinary)
+	if err != nil {
+		return ref, err
+	}
+	defer func() {
+		if cerr := w.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	buf := make([]byte, lobChunkSz)
+	var carry []byte
+	first := true
+
+	for n > 0 {
+
+		sz := n
+		if sz > len(buf) {
+			sz = len(buf)
+		}
+
+		b := buf[:sz]
+		_, err = r.reader.Read(b)
+		if err != nil {
+			return ref, err
+		}
+		n -= sz
+
+		if kind == lobBinary {
+			_, err = w.Write(b)
+			if err != nil {
+				return ref, err
+			}
+			continue
+		}
+
+		if first && kind == lobPaddedText && len(b) > 1 && b[0] == 0x00 {
+			nCt := 0
+			for _, v := range b {
+				if v != 0x00 {
+					break
+				}
+				nCt++
+			}
+			if nCt == 6 {
+				b = b[6:]
+				n += 6
+			}
+		}
+		first = false
+
+		// Don't split surrogate pairs across chunks
+		data := append(carry, b...)
+		carry = nil
+		if n > 0 && len(data) > 1 {
+			u := rune(data[len(data)-2]) | rune(data[len(data)-1])<<8
+			if u >= 0xd800 && u < 0xdc00 {
+				carry = append(carry, data[len(data)-2:]...)
+				data = data[:len(data)-2]
+			}
+		}
+
+		var s string
+		s, err = utf16ToString(data)
+		if err != nil {
+			return ref, err
+		}
+
+		_, err = io.WriteString(w, s)
+		if err != nil {
+			return ref, err
+		}
+	}
+
+	if debugFlag {
+		debOut(fmt.Sprintf("%s: Streamed to %s", label, ref))
+	}
+
+	return ref, err
+}
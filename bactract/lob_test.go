@@ -0,0 +1,127 @@
+package bactract
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+// lobBuffer is an in memory writer for streamed values
+type lobBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *lobBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+// lobBufferReader returns a reader on b that streams all non-null large
+// values to the returned buffers
+func lobBufferReader(b []byte) (*tReader, *[]*lobBuffer) {
+	var bufs []*lobBuffer
+	r := variantReader(b)
+	r.SetLobWriter(0, func(tc TableColumn, rownum uint64, isBinary bool) (io.WriteCloser, string, error) {
+		lb := &lobBuffer{}
+		bufs = append(bufs, lb)
+		return lb, tc.ColName, nil
+	})
+	return r, &bufs
+}
+
+func TestStreamLobSurrogateCarry(t *testing.T) {
+
+	// A value where the surrogate pair for U+1F600 straddles the end of
+	// the first chunk
+	want := strings.Repeat("a", lobChunkSz/2-1) + "\U0001F600b"
+
+	tc := TableColumn{ColName: "doc", DataType: NVarchar, DtStr: "nvarchar"}
+	r, bufs := lobBufferReader(nvarcharMaxBytes(want))
+
+	ec, err := readNVarchar(r, tc)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ec.LobFile != "doc" || len(*bufs) != 1 {
+		t.Fatalf("expected the value to be streamed, got %+v", ec)
+	}
+
+	lb := (*bufs)[0]
+	if !lb.closed {
+		t.Errorf("the writer was not closed")
+	}
+	got := lb.String()
+	if strings.ContainsRune(got, '\ufffd') {
+		t.Errorf("the surrogate pair was split and replaced with U+FFFD")
+	}
+	if got != want {
+		t.Errorf("got %d bytes, want %d bytes", len(got), len(want))
+	}
+}
+
+func TestStreamLobPaddedText(t *testing.T) {
+
+	// Two varchar(max) values where the first has the six leading null
+	// bytes that are not included in the stored size
+	var b []byte
+	padded := nvarcharMaxBytes("hello")
+	b = append(b, padded[:8]...)
+	b = append(b, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00)
+	b = append(b, padded[8:]...)
+	b = append(b, nvarcharMaxBytes("next")...)
+
+	tc := TableColumn{ColName: "doc", DataType: Varchar, DtStr: "varchar", IsNullable: true}
+
+	// The streamed values match those read into memory
+	want := []string{"hello", "next"}
+
+	mr := variantReader(append([]byte{}, b...))
+	for i, w := range want {
+		ec, err := readString(mr, tc)
+		if err != nil {
+			t.Fatalf("in memory %d: unexpected error: %s", i+1, err)
+		}
+		if ec.Str != w {
+			t.Errorf("in memory %d: got %q, want %q", i+1, ec.Str, w)
+		}
+	}
+
+	r, bufs := lobBufferReader(b)
+	for i := range want {
+		if _, err := readString(r, tc); err != nil {
+			t.Fatalf("streamed %d: unexpected error: %s", i+1, err)
+		}
+	}
+	if len(*bufs) != len(want) {
+		t.Fatalf("streamed %d values, want %d", len(*bufs), len(want))
+	}
+	for i, w := range want {
+		if got := (*bufs)[i].String(); got != w {
+			t.Errorf("streamed %d: got %q, want %q", i+1, got, w)
+		}
+	}
+}
+
+func TestStreamLobBinary(t *testing.T) {
+
+	// The bytes of binary values are written as is, including any leading
+	// null bytes
+	want := append([]byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, bytes.Repeat([]byte{0xd8}, lobChunkSz)...)
+	n := len(want)
+	b := append([]byte{byte(n), byte(n >> 8), byte(n >> 16), byte(n >> 24)}, want...)
+
+	tc := TableColumn{ColName: "img", DataType: Image, DtStr: "image", IsNullable: true}
+	r, bufs := lobBufferReader(b)
+
+	if _, err := readImage(r, tc); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(*bufs) != 1 {
+		t.Fatalf("streamed %d values, want 1", len(*bufs))
+	}
+	if got := (*bufs)[0].Bytes(); !bytes.Equal(got, want) {
+		t.Errorf("got %d bytes, want %d bytes", len(got), len(want))
+	}
+}
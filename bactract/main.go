@@ -12,6 +12,18 @@ var debugFlag bool //= false // Whether or not to spew debugging information to
 //const debugFlag = false     // Trim the length of byte arrays and strings when outputting debug information
 const debugLen = 30 // Trim the length of byte arrays and strings when outputting debug information
 
+var surrogatePolicy = SurrogateReplace // How to deal with unpaired UTF-16 surrogates
+
+var rowversionFormat = RowversionHex // How to output rowversion values
+
+var guidFormat = GUIDCanonical // How to output uniqueidentifier values
+
+var schemaMap map[string]string // The source to output schema name mappings
+
+var historyMode = HistoryInclude // How to extract the history tables for temporal tables
+
+var timePrecision = -1 // The number of fractional second digits to output for temporal values (negative uses the column scale)
+
 // Note that this is an incomplete (I think) list of the possible
 // datatypes, however, ya gotta work with what ya got
 const (
@@ -44,6 +56,54 @@ const (
 	UniqueIdentifier = iota
 	Varbinary        = iota
 	Varchar          = iota
+	Xml              = iota
+	HierarchyID      = iota
+	Image            = iota
+	Rowversion       = iota
+)
+
+// Policies for dealing with unpaired UTF-16 surrogates in character data
+const (
+	SurrogateReplace = iota // Replace the unpaired surrogate with U+FFFD
+	SurrogateDrop    = iota // Discard the unpaired surrogate
+	SurrogateError   = iota // Fail the read of the column
+)
+
+// Output formats for rowversion (timestamp) values
+const (
+	RowversionHex    = iota // Hex string
+	RowversionUint64 = iota // Big-endian unsigned integer
+)
+
+// Output format options for uniqueidentifier values. The options may be
+// combined (GUIDUpper | GUIDNoDashes) although GUIDRaw is never dashed
+// or braced.
+const (
+	GUIDCanonical = 0         // Lowercase 8-4-4-4-12 form
+	GUIDUpper     = 1 << iota // Uppercase hex digits
+	GUIDNoDashes  = 1 << iota // No dashes between the groups
+	GUIDBraces    = 1 << iota // Enclosed in braces
+	GUIDRaw       = 1 << iota // Hex of the 16 bytes as stored by SQL Server (mixed-endian)
+)
+
+// Policies for dealing with characters that cannot be mapped to the output charset
+const (
+	UnmappableReplace = iota // Replace the character with "?"
+	UnmappableDrop    = iota // Discard the character
+	UnmappableError   = iota // Fail the write
+)
+
+// Period column types for temporal tables
+const (
+	PeriodStart = "ROW START"
+	PeriodEnd   = "ROW END"
+)
+
+// How the data for the history tables of temporal tables is extracted
+const (
+	HistoryInclude = iota // Extract the history tables as separate tables
+	HistoryExclude = iota // Do not extract the history tables
+	HistoryCombine = iota // Append the history data to the data for the temporal table
 )
 
 // Bacpac is the base for an unzipped bacpac file
@@ -55,6 +115,12 @@ type Bacpac struct {
 func New(baseDir string) (b Bacpac, err error) {
 	b.baseDir = baseDir
 	debugFlag = false
+	timePrecision = -1
+	surrogatePolicy = SurrogateReplace
+	rowversionFormat = RowversionHex
+	guidFormat = GUIDCanonical
+	schemaMap = nil
+	historyMode = HistoryInclude
 
 	return b, err
 }
@@ -63,6 +129,48 @@ func (b Bacpac) SetDebug(debug bool) {
 	debugFlag = debug
 }
 
+// SetGUIDFormat sets the output format options for uniqueidentifier
+// values (GUIDUpper, GUIDNoDashes, GUIDBraces, or GUIDRaw). The default,
+// GUIDCanonical, is the lowercase 8-4-4-4-12 form.
+func (b Bacpac) SetGUIDFormat(f int) {
+	guidFormat = f
+}
+
+// SetSchemaMap sets the source to output schema name mappings (see
+// LookupSchemaMap). The mappings are applied to the extracted model and
+// to the exported table names.
+func (b Bacpac) SetSchemaMap(m map[string]string) {
+	schemaMap = m
+}
+
+// SetHistoryMode sets how the history tables for temporal tables are
+// extracted (HistoryInclude, HistoryExclude, or HistoryCombine). The
+// default is HistoryInclude.
+func (b Bacpac) SetHistoryMode(m int) {
+	historyMode = m
+}
+
+// SetRowversionFormat sets the output format for rowversion (timestamp)
+// values (RowversionHex or RowversionUint64). The default is RowversionHex.
+func (b Bacpac) SetRowversionFormat(f int) {
+	rowversionFormat = f
+}
+
+// SetSurrogatePolicy sets how unpaired UTF-16 surrogates found in
+// character data are dealt with (SurrogateReplace, SurrogateDrop, or
+// SurrogateError). The default is SurrogateReplace.
+func (b Bacpac) SetSurrogatePolicy(p int) {
+	surrogatePolicy = p
+}
+
+// SetTimePrecision sets the number of fractional second digits (0 to 9)
+// to output for datetime, datetime2, and time values. Values having
+// more digits are rounded. A negative precision uses the scale of the
+// column (3 for datetime).
+func (b Bacpac) SetTimePrecision(p int) {
+	timePrecision = p
+}
+
 // ExportedTables returns the list of data containing tables found in the bacpac
 func (b Bacpac) ExportedTables() (s []string, err error) {
 
@@ -86,7 +194,7 @@ func (b Bacpac) ExportedTables() (s []string, err error) {
 		}
 		switch mode := fi.Mode(); {
 		case mode.IsDir():
-			s = append(s, d.Name())
+			s = append(s, mapQN(d.Name()))
 		}
 	}
 
@@ -8,6 +8,7 @@ import (
 	"encoding/xml"
 	"io/ioutil"
 	"os"
+	"strconv"
 	"strings"
 
 	//
@@ -87,9 +88,10 @@ type DataSchemaModel struct {
 									Type     string `xml:"Type,attr"`
 									Name     string `xml:"Name,attr"`
 									Property []struct {
-										Text  string `xml:",chardata"`
-										Name  string `xml:"Name,attr"`
-										Value string `xml:"Value,attr"`
+										Text      string `xml:",chardata"`
+										Name      string `xml:"Name,attr"`
+										Value     string `xml:"Value,attr"`
+										ValueText string `xml:"Value"`
 									} `xml:"Property"`
 									Relationship struct {
 										Text  string `xml:",chardata"`
@@ -228,30 +230,112 @@ type TableColumn struct {
 	Scale         int
 	Precision     int
 	IsNullable    bool
-	IsAdulterated bool // flag to indicate if the byte-stream for the column is supected of having been messed with
+	IsAdulterated bool   // flag to indicate if the byte-stream for the column is supected of having been messed with
+	Collation     string // the column collation, if different from the database collation
+	CodePage      int    // the code page for char, varchar, and text columns
+	IsIdentity    bool
+	IdentitySeed  int64             // the seed for identity columns
+	IdentityIncr  int64             // the increment for identity columns
+	DefaultName   string            // the name of the default constraint, if named
+	Default       string            // the (T-SQL) default expression
+	IsComputed    bool              // computed columns are not in the BCP data
+	IsPersisted   bool              // the computed column is persisted
+	Expression    string            // the (T-SQL) expression for computed columns
+	Description   string            // the MS_Description extended property
+	Properties    map[string]string // the other extended properties
+	Period        string            // PeriodStart or PeriodEnd for the system-versioning period columns
+	IsHidden      bool              // the (period) column is hidden
+	IsSparse      bool
+	IsFileStream  bool // FILESTREAM data is not exported to the BCP data
+	IsRowGuidCol  bool
+	IsColumnSet   bool   // the XML column set for the sparse columns is not stored, and not exported
+	UserType      string // the (schema.name) alias type of the column, if any
+	IsClrType     bool   // the column is of a (user defined) CLR type
+}
+
+// DefaultConstraint contains the definition for a column default
+type DefaultConstraint struct {
+	ConsName   string
+	ColName    string
+	Expression string
 }
 
 type UniqueConstraint struct {
-	ConsName string
-	Columns  []string
+	ConsName    string
+	Columns     []string
+	IsClustered bool
 }
 
+// Referential actions for foreign keys
+const (
+	FKNoAction   = "NO ACTION"
+	FKCascade    = "CASCADE"
+	FKSetNull    = "SET NULL"
+	FKSetDefault = "SET DEFAULT"
+)
+
 type ForeignKey struct {
+	ConsName            string
+	Columns             []string
+	RefTable            string
+	RefColumns          []string
+	DeleteAction        string // FKNoAction, FKCascade, FKSetNull, or FKSetDefault
+	UpdateAction        string // FKNoAction, FKCascade, FKSetNull, or FKSetDefault
+	IsNotForReplication bool
+	IsDisabled          bool
+	IsNotTrusted        bool // created or re-enabled WITH NOCHECK
+}
+
+// CheckConstraint contains the definition for a table check constraint
+type CheckConstraint struct {
 	ConsName   string
-	Columns    []string
-	RefTable   string
-	RefColumns []string
+	Expression string // the (T-SQL) check expression
+}
+
+// IndexColumn contains the definition for an index key column
+type IndexColumn struct {
+	ColName      string
+	IsDescending bool
+}
+
+// Index contains the definition for a (non-constraint) table index
+type Index struct {
+	IdxName     string
+	Columns     []IndexColumn
+	Included    []string
+	IsUnique    bool
+	IsClustered bool
+	Filter      string // the (T-SQL) filter predicate for filtered indexes
 }
 
 // Table struct contains the definition for an exported database table
 type Table struct {
-	DataDir string
-	Schema  string
-	TabName string
-	PK      UniqueConstraint
-	Columns []TableColumn
-	FKs     []ForeignKey
-	Unique  []UniqueConstraint
+	DataDir     string
+	Schema      string
+	TabName     string
+	PK          UniqueConstraint
+	Columns     []TableColumn
+	FKs         []ForeignKey
+	Unique      []UniqueConstraint
+	Checks      []CheckConstraint
+	Indexes     []Index
+	Description string            // the MS_Description extended property
+	Properties  map[string]string // the other extended properties
+
+	IsSystemVersioned bool   // the table is a temporal (system-versioned) table
+	HistoryTable      string // the (schema.name) history table for temporal tables
+	PeriodStart       string // the period start column for temporal tables
+	PeriodEnd         string // the period end column for temporal tables
+	IsHistoryTable    bool   // the table is the history table for a temporal table
+	TemporalTable     string // the (schema.name) temporal table for history tables
+	IsMemoryOptimized bool
+	Durability        string // SCHEMA_AND_DATA or SCHEMA_ONLY for memory-optimized tables
+
+	PartitionScheme string            // the partition scheme for partitioned tables
+	PartitionColumn string            // the partitioning column for partitioned tables
+	PartitionFunc   PartitionFunction // the partition function for partitioned tables
+
+	history *Table // the history table, for combining the history data
 }
 
 // UserDefinedType struct contains the definition for an exported user
@@ -260,24 +344,55 @@ type Table struct {
 type UserDefinedType struct {
 	Schema     string
 	Name       string
+	BaseType   string // the type that the alias type is defined on (possibly another alias type)
 	DataType   int
-	DtStr      string
+	DtStr      string // the (resolved) base datatype
 	Length     int
 	Scale      int
 	Precision  int
 	IsNullable bool
+	IsClrType  bool // the (resolved) base type is a CLR type
 }
 
 // ExtractedModel contains the model data needed for identifying, and
 // extracting the data from, all the exported tables
 type ExtractedModel struct {
 	baseDir                string
-	Collation              string
+	Collation              string // the LCID of the database collation
 	CollationCaseSensitive bool
+	DatabaseCollation      string // the name of the database collation
+	CodePage               int    // the code page for the database collation
 	FileFormatVersion      string
 	SchemaVersion          string
 	DspName                string
 	Tables                 map[string]Table
+	Views                  map[string]View
+	Procedures             map[string]Procedure
+	Functions              map[string]Function
+	Triggers               map[string]Trigger
+	Schemas                map[string]Schema
+	Sequences              map[string]Sequence
+	Synonyms               map[string]Synonym
+	ExtendedProperties     map[string]map[string]string // the extended properties, by (schema.name[.column]) object
+	Users                  map[string]User
+	Roles                  map[string]Role
+	RoleMemberships        []RoleMembership
+	Permissions            []Permission
+	PartitionFunctions     map[string]PartitionFunction
+	PartitionSchemes       map[string]PartitionScheme
+	UserTypes              map[string]UserDefinedType
+	TableTypes             map[string]TableType
+	ClrTypes               map[string]ClrType
+}
+
+// View contains the definition for a view
+type View struct {
+	Schema       string
+	Name         string
+	Query        string   // the (T-SQL) query for the view
+	Columns      []string // the view columns
+	Dependencies []string // the (schema.name) objects that the view references
+	ColumnDeps   []string // the (schema.table.column) columns that the view references
 }
 
 // dtMap maps the datatype strings in the model.xml file to the appropriate datatype enums
@@ -292,22 +407,27 @@ var dtMap = map[string]int{
 	"decimal":          Decimal,
 	"float":            Float,
 	"geography":        Geography,
+	"hierarchyid":      HierarchyID,
+	"image":            Image,
 	"int":              Int,
 	"nchar":            NChar,
 	"ntext":            NText,
 	"numeric":          Numeric,
 	"nvarchar":         NVarchar,
 	"real":             Real,
+	"rowversion":       Rowversion,
 	"smalldatetime":    SmallDatetime,
 	"smallint":         SmallInt,
 	"smallmoney":       SmallMoney,
 	"sql_variant":      SQLVariant,
 	"time":             Time,
 	"text":             Text,
+	"timestamp":        Rowversion,
 	"tinyint":          TinyInt,
 	"uniqueidentifier": UniqueIdentifier,
 	"varbinary":        Varbinary,
 	"varchar":          Varchar,
+	"xml":              Xml,
 }
 
 // ModelFileName returns the path/name for the model xml file
@@ -346,6 +466,8 @@ func (bp Bacpac) GetModel(ef string) (m ExtractedModel, err error) {
 	m.SchemaVersion = doc.SchemaVersion
 	m.DspName = doc.DspName
 	m.CollationCaseSensitive = doc.CollationCaseSensitive == "True"
+	m.DatabaseCollation = extractDatabaseCollation(doc)
+	m.CodePage = databaseCodePage(doc)
 
 	var exceptions ColumnExceptions
 	if ef != "" {
@@ -364,17 +486,35 @@ func (bp Bacpac) GetModel(ef string) (m ExtractedModel, err error) {
 	// Grab the table definition data, using the custom data types to
 	// translate to base types -- don't know if composite types are
 	// possible but if they are, I don't have any to test with anyhow...
-	rt := bp.extractTables(doc, exceptions)
+	rt, tt := bp.extractTables(doc, exceptions)
 
 	m.Tables = rt
+	m.TableTypes = tt
+	m.UserTypes = extractUserTypes(doc)
+	m.ClrTypes = extractClrTypes(doc)
+	m.Views = extractViews(doc)
+	m.Procedures, m.Functions, m.Triggers = extractRoutines(doc)
+	m.Schemas = extractSchemas(doc)
+	m.Sequences = extractSequences(doc)
+	m.Synonyms = extractSynonyms(doc)
+	m.ExtendedProperties = extractExtendedProperties(doc)
+	m.Users = extractUsers(doc)
+	m.Roles, m.RoleMemberships = extractRoles(doc)
+	m.Permissions = extractPermissions(doc)
+	m.PartitionFunctions, m.PartitionSchemes = extractPartitions(doc)
+	linkPartitions(&m)
+
+	remapSchemas(&m)
 
 	return m, err
 }
 
-// extractTables extracts the table definitions from the schema model
-func (bp Bacpac) extractTables(doc DataSchemaModel, exceptions ColumnExceptions) (rt map[string]Table) {
+// extractTables extracts the table (and table type) definitions from
+// the schema model
+func (bp Bacpac) extractTables(doc DataSchemaModel, exceptions ColumnExceptions) (rt map[string]Table, tt map[string]TableType) {
 
 	rt = make(map[string]Table)
+	tt = make(map[string]TableType)
 
 	var ex map[string]ColumnException
 	ex = make(map[string]ColumnException)
@@ -389,14 +529,26 @@ func (bp Bacpac) extractTables(doc DataSchemaModel, exceptions ColumnExceptions)
 
 	// Grab the custom data types: name, schema, base type, length
 	userTypes := extractUserTypes(doc)
+	clrTypes := extractClrTypes(doc)
+
+	// The default code page for the character columns
+	dbCodePage := databaseCodePage(doc)
 
 	// Grab the primary keys, foreign keys, and unique constraints
 	pks := extractPrimaryKeys(doc)
 	fks := extractForeignKeys(doc)
 	ucs := extractUniqueConstraints(doc)
+	cks := extractCheckConstraints(doc)
+	ixs := extractIndexes(doc)
+
+	// Grab the column defaults
+	dfs := extractDefaultConstraints(doc)
+
+	// Grab the extended properties (descriptions)
+	eps := extractExtendedProperties(doc)
 
 	for _, element := range doc.Model.Element {
-		if element.Type != "SqlTable" {
+		if element.Type != "SqlTable" && element.Type != "SqlTableType" {
 			continue
 		}
 
@@ -419,28 +571,90 @@ func (bp Bacpac) extractTables(doc DataSchemaModel, exceptions ColumnExceptions)
 			t.Unique = uc
 		}
 
+		ck, ok := cks[qtn]
+		if ok {
+			t.Checks = ck
+		}
+
+		ix, ok := ixs[qtn]
+		if ok {
+			t.Indexes = ix
+		}
+
 		t.Schema = extractQNToken(qtn, 0)
 		t.TabName = extractQNToken(qtn, 1)
+		t.Description, t.Properties = splitDescription(eps[normalizeQN(qtn)])
+
+		for _, p := range element.Property {
+			switch p.Name {
+			case "IsMemoryOptimized":
+				t.IsMemoryOptimized = p.AttrValue == "True"
+			case "Durability":
+				t.Durability = "SCHEMA_AND_DATA"
+				if p.AttrValue == "1" || strings.EqualFold(p.AttrValue, "SchemaOnly") {
+					t.Durability = "SCHEMA_ONLY"
+				}
+			}
+		}
+		if t.IsMemoryOptimized && t.Durability == "" {
+			t.Durability = "SCHEMA_AND_DATA"
+		}
 
 		dd := strings.Join([]string{t.Schema, t.TabName}, ".")
 		t.DataDir = catDir([]string{bp.baseDir, "Data", dd})
 
 		for _, relationship := range element.Relationship {
+			switch relationship.Name {
+			case "TemporalSystemVersioningHistoryTable":
+				for _, entry := range relationship.Entry {
+					t.HistoryTable = normalizeQN(entry.References.Name)
+					t.IsSystemVersioned = t.HistoryTable != ""
+				}
+			case "PartitionScheme":
+				for _, entry := range relationship.Entry {
+					n := entry.References.Name
+					if n == "" && len(entry.Element.Relationship.Entry) > 0 {
+						n = entry.Element.Relationship.Entry[0].References.Name
+					}
+					t.PartitionScheme = normalizeQN(n)
+				}
+			case "PartitionColumn":
+				for _, entry := range relationship.Entry {
+					t.PartitionColumn = extractQNToken(entry.References.Name, 2)
+				}
+			}
 			if relationship.Name != "Columns" {
 				continue
 			}
 
 			for _, entry := range relationship.Entry {
-				if entry.Element.Type != "SqlSimpleColumn" {
+				switch entry.Element.Type {
+				case "SqlSimpleColumn", "SqlComputedColumn", "SqlTableTypeSimpleColumn", "SqlTableTypeComputedColumn":
+				default:
 					continue
 				}
 
 				var col TableColumn
+				col.IsComputed = strings.HasSuffix(entry.Element.Type, "ComputedColumn")
 
 				col.ColName = extractQNToken(entry.Element.Name, 2)
 				col.IsNullable = true
 
 				for _, re := range entry.Element.Relationship.Entry {
+					if re.Element.Type == "SqlIdentityOptions" {
+						col.IsIdentity = true
+						col.IdentitySeed = 1
+						col.IdentityIncr = 1
+						for _, p := range re.Element.Property {
+							switch p.Name {
+							case "IdentitySeed":
+								col.IdentitySeed, _ = strconv.ParseInt(strings.TrimSpace(p.ValueText), 10, 64)
+							case "IdentityIncrement":
+								col.IdentityIncr, _ = strconv.ParseInt(strings.TrimSpace(p.ValueText), 10, 64)
+							}
+						}
+						continue
+					}
 					if re.Element.Type != "SqlTypeSpecifier" {
 						continue
 					}
@@ -456,13 +670,17 @@ func (bp Bacpac) extractTables(doc DataSchemaModel, exceptions ColumnExceptions)
 
 					ut, ok := userTypes[col.DtStr]
 					if ok {
+						col.UserType = col.DtStr
 						col.DtStr = ut.DtStr
 						col.DataType = ut.DataType
 						col.Length = ut.Length
 						col.Scale = ut.Scale
+						col.Precision = ut.Precision
 						col.IsNullable = ut.IsNullable
+						col.IsClrType = ut.IsClrType
 					} else {
 						col.DataType = dtMap[col.DtStr]
+						_, col.IsClrType = clrTypes[col.DtStr]
 					}
 
 					for _, p := range re.Element.Property {
@@ -493,8 +711,39 @@ func (bp Bacpac) extractTables(doc DataSchemaModel, exceptions ColumnExceptions)
 						if p.AttrValue == "False" {
 							col.IsNullable = false
 						}
+					case "Collation":
+						col.Collation = p.AttrValue
+					case "IsSparse":
+						col.IsSparse = p.AttrValue == "True"
+					case "IsFileStream":
+						col.IsFileStream = p.AttrValue == "True"
+					case "IsRowGuidCol":
+						col.IsRowGuidCol = p.AttrValue == "True"
+					case "IsColumnSet":
+						col.IsColumnSet = p.AttrValue == "True"
+					case "IsIdentity":
+						col.IsIdentity = p.AttrValue == "True"
+					case "ExpressionScript":
+						col.Expression = strings.TrimSpace(p.Value.Text)
+					case "IsPersisted":
+						col.IsPersisted = p.AttrValue == "True"
+					case "GeneratedAlwaysType":
+						switch p.AttrValue {
+						case "1":
+							col.Period = PeriodStart
+							t.PeriodStart = col.ColName
+						case "2":
+							col.Period = PeriodEnd
+							t.PeriodEnd = col.ColName
+						}
+					case "IsHidden":
+						col.IsHidden = p.AttrValue == "True"
 					}
 				}
+				if col.IsIdentity && col.IdentityIncr == 0 {
+					col.IdentitySeed = 1
+					col.IdentityIncr = 1
+				}
 
 				// Check for column definition exceptions
 				k := strings.Join([]string{t.Schema, t.TabName, col.ColName}, ".")
@@ -509,14 +758,89 @@ func (bp Bacpac) extractTables(doc DataSchemaModel, exceptions ColumnExceptions)
 					col.IsAdulterated = v.IsAdulterated
 				}
 
+				col.Description, col.Properties = splitDescription(eps[normalizeQN(entry.Element.Name)])
+
+				df, ok := dfs[qtn][col.ColName]
+				if ok {
+					col.DefaultName = df.ConsName
+					col.Default = df.Expression
+				}
+
+				switch col.DataType {
+				case Char, Varchar, Text:
+					col.CodePage = dbCodePage
+					if col.Collation != "" {
+						col.CodePage = collationToCodePage(col.Collation)
+					}
+				}
+
 				t.Columns = append(t.Columns, col)
 			}
 		}
 		key := strings.Join([]string{t.Schema, t.TabName}, ".")
+		if element.Type == "SqlTableType" {
+			tt[key] = TableType{Schema: t.Schema, Name: t.TabName, Columns: t.Columns}
+			continue
+		}
 		rt[key] = t
 	}
 
-	return rt
+	// Link the temporal and history tables
+	for key, t := range rt {
+		if !t.IsSystemVersioned {
+			continue
+		}
+		h, ok := rt[t.HistoryTable]
+		if !ok {
+			continue
+		}
+		h.IsHistoryTable = true
+		h.TemporalTable = key
+		rt[t.HistoryTable] = h
+
+		t.history = &h
+		rt[key] = t
+	}
+
+	return rt, tt
+}
+
+// extractDatabaseCollation extracts the name of the database collation
+// from the schema model
+func extractDatabaseCollation(doc DataSchemaModel) string {
+
+	// <Model>
+	//     <Element Type="SqlDatabaseOptions">
+	//         <Property Name="Collation" Value="SQL_Latin1_General_CP1_CI_AS" />
+	// ...
+
+	for _, element := range doc.Model.Element {
+		if element.Type != "SqlDatabaseOptions" {
+			continue
+		}
+		for _, p := range element.Property {
+			if p.Name == "Collation" {
+				return p.AttrValue
+			}
+		}
+	}
+	return ""
+}
+
+// databaseCodePage determines the code page for the database collation,
+// falling back to the collation LCID when the database collation name
+// is not available
+func databaseCodePage(doc DataSchemaModel) int {
+
+	cp := collationToCodePage(extractDatabaseCollation(doc))
+	if cp == 0 {
+		lcid, _ := toInt([]byte(doc.CollationLcid))
+		cp = lcidToCodePage(lcid)
+	}
+	if cp == 0 {
+		cp = defaultCodePage
+	}
+	return cp
 }
 
 // extractUserTypes extracts the user defined types from the schema model
@@ -571,13 +895,19 @@ func extractUserTypes(doc DataSchemaModel) (rt map[string]UserDefinedType) {
 				case "Schema":
 					t.Schema = normalizeQN(entry.References.Name)
 				case "Type":
-					t.DtStr = normalizeQN(entry.References.Name)
+					t.BaseType = strings.TrimPrefix(normalizeQN(entry.References.Name), "sys.")
+					t.DtStr = t.BaseType
 					t.DataType = dtMap[t.DtStr]
 				}
 			}
 		}
 		rt[t.Name] = t
 	}
+
+	clrTypes := extractClrTypes(doc)
+	for name := range rt {
+		rt[name] = resolveUserType(name, rt, clrTypes, make(map[string]bool))
+	}
 	return rt
 }
 
@@ -604,6 +934,12 @@ func extractPrimaryKeys(doc DataSchemaModel) (pks map[string]UniqueConstraint) {
 			}
 		}
 
+		for _, p := range element.Property {
+			if p.Name == "IsClustered" {
+				pk.IsClustered = p.AttrValue == "True"
+			}
+		}
+
 		for _, r := range element.Relationship {
 			switch r.Name {
 			case "ColumnSpecifications":
@@ -652,6 +988,26 @@ func extractForeignKeys(doc DataSchemaModel) (fks map[string][]ForeignKey) {
 			}
 		}
 
+		fk.DeleteAction = FKNoAction
+		fk.UpdateAction = FKNoAction
+
+		for _, p := range element.Property {
+			switch p.Name {
+			case "DeleteAction":
+				fk.DeleteAction = toFKAction(p.AttrValue)
+			case "UpdateAction":
+				fk.UpdateAction = toFKAction(p.AttrValue)
+			case "IsNotForReplication", "NotForReplication":
+				fk.IsNotForReplication = p.AttrValue == "True"
+			case "IsDisabled", "Disabled":
+				fk.IsDisabled = p.AttrValue == "True"
+			case "IsEnabled":
+				fk.IsDisabled = p.AttrValue == "False"
+			case "WithNoCheck", "IsNotTrusted":
+				fk.IsNotTrusted = p.AttrValue == "True"
+			}
+		}
+
 		for _, r := range element.Relationship {
 			switch r.Name {
 			case "Columns":
@@ -679,6 +1035,20 @@ func extractForeignKeys(doc DataSchemaModel) (fks map[string][]ForeignKey) {
 	return fks
 }
 
+// toFKAction translates the model value for a foreign key referential
+// action (either the enum value or name) to the action
+func toFKAction(s string) string {
+	switch strings.ToLower(strings.Replace(s, " ", "", -1)) {
+	case "1", "cascade":
+		return FKCascade
+	case "2", "setnull":
+		return FKSetNull
+	case "3", "setdefault":
+		return FKSetDefault
+	}
+	return FKNoAction
+}
+
 // extractUniqueConstraints extracts the non-primary key unique constraints from the schema model
 func extractUniqueConstraints(doc DataSchemaModel) (uniq map[string][]UniqueConstraint) {
 
@@ -696,6 +1066,12 @@ func extractUniqueConstraints(doc DataSchemaModel) (uniq map[string][]UniqueCons
 			u.ConsName = extractQNToken(element.Name, 1)
 		}
 
+		for _, p := range element.Property {
+			if p.Name == "IsClustered" {
+				u.IsClustered = p.AttrValue == "True"
+			}
+		}
+
 		for _, r := range element.Relationship {
 			switch r.Name {
 			case "ColumnSpecifications":
@@ -721,6 +1097,368 @@ func extractUniqueConstraints(doc DataSchemaModel) (uniq map[string][]UniqueCons
 	return uniq
 }
 
+// extractViews extracts the view definitions from the schema model
+func extractViews(doc DataSchemaModel) (views map[string]View) {
+
+	// <Element Type="SqlView" Name="[dbo].[view_name]">
+	//     <Property Name="QueryScript">
+	//         <Value><![CDATA[SELECT ... FROM [dbo].[table]]]></Value>
+	//     </Property>
+	//     <Relationship Name="Columns">
+	//         <Entry>
+	//             <Element Type="SqlComputedColumn" Name="[dbo].[view_name].[column]">
+	//             ...
+	//     </Relationship>
+	//     <Relationship Name="QueryDependencies">
+	//         <Entry>
+	//             <References Name="[dbo].[table]" />
+	//         </Entry>
+	//         <Entry>
+	//             <References Name="[dbo].[table].[column]" />
+	//         </Entry>
+	//     ...
+
+	views = make(map[string]View)
+
+	for _, element := range doc.Model.Element {
+		if element.Type != "SqlView" {
+			continue
+		}
+
+		var vw View
+		vw.Schema = extractQNToken(element.Name, 0)
+		vw.Name = extractQNToken(element.Name, 1)
+
+		for _, p := range element.Property {
+			if p.Name == "QueryScript" {
+				vw.Query = strings.TrimSpace(p.Value.Text)
+			}
+		}
+
+		deps := make(map[string]bool)
+		cols := make(map[string]bool)
+
+		for _, r := range element.Relationship {
+			switch r.Name {
+			case "Columns":
+				for _, e := range r.Entry {
+					if e.Element.Name != "" {
+						vw.Columns = append(vw.Columns, extractQNToken(e.Element.Name, 2))
+					}
+				}
+			case "QueryDependencies":
+				for _, e := range r.Entry {
+					n := e.References.Name
+					if n == "" || e.References.ExternalSource == "BuiltIns" {
+						continue
+					}
+					tokens := strings.Split(normalizeQN(n), ".")
+					if len(tokens) < 2 {
+						continue
+					}
+					dep := strings.Join(tokens[:2], ".")
+					if !deps[dep] {
+						deps[dep] = true
+						vw.Dependencies = append(vw.Dependencies, dep)
+					}
+					if len(tokens) == 3 {
+						col := normalizeQN(n)
+						if !cols[col] {
+							cols[col] = true
+							vw.ColumnDeps = append(vw.ColumnDeps, col)
+						}
+					}
+				}
+			}
+		}
+
+		key := strings.Join([]string{vw.Schema, vw.Name}, ".")
+		views[key] = vw
+	}
+
+	return views
+}
+
+// extractCheckConstraints extracts the check constraints from the schema model
+func extractCheckConstraints(doc DataSchemaModel) (cks map[string][]CheckConstraint) {
+
+	// <Element Type="SqlCheckConstraint" Name="[dbo].[CK_table_column]">
+	//     <Property Name="CheckExpressionScript">
+	//         <Value><![CDATA[([column]>(0))]]></Value>
+	//     </Property>
+	//     <Relationship Name="DefiningTable">
+	//         <Entry>
+	//             <References Name="[dbo].[table]" />
+	//         </Entry>
+	//     </Relationship>
+	// ...
+
+	cks = make(map[string][]CheckConstraint)
+
+	for _, element := range doc.Model.Element {
+		if element.Type != "SqlCheckConstraint" {
+			continue
+		}
+
+		var ck CheckConstraint
+		var key string
+
+		if element.Name != "" {
+			ck.ConsName = extractQNToken(element.Name, 1)
+		}
+
+		for _, p := range element.Property {
+			if p.Name == "CheckExpressionScript" {
+				ck.Expression = strings.TrimSpace(p.Value.Text)
+			}
+		}
+
+		for _, r := range element.Relationship {
+			if r.Name == "DefiningTable" {
+				e := r.Entry[0]
+				key = e.References.Name
+			}
+		}
+
+		if key != "" {
+			cks[key] = append(cks[key], ck)
+		}
+	}
+
+	return cks
+}
+
+// extractIndexes extracts the indexes from the schema model
+func extractIndexes(doc DataSchemaModel) (ixs map[string][]Index) {
+
+	// <Element Type="SqlIndex" Name="[dbo].[table].[IX_table_column]">
+	//     <Property Name="IsUnique" Value="True" />
+	//     <Property Name="FilterPredicate">
+	//         <Value><![CDATA[([column] IS NOT NULL)]]></Value>
+	//     </Property>
+	//     <Relationship Name="ColumnSpecifications">
+	//         <Entry>
+	//             <Element Type="SqlIndexedColumnSpecification">
+	//                 <Property Name="IsAscending" Value="False" />
+	//                 <Relationship Name="Column">
+	//                     <Entry>
+	//                         <References Name="[dbo].[table].[column]" />
+	//                     </Entry>
+	//                 </Relationship>
+	//             </Element>
+	//         </Entry>
+	//     </Relationship>
+	//     <Relationship Name="IncludedColumns">
+	//         <Entry>
+	//             <References Name="[dbo].[table].[other_column]" />
+	//         </Entry>
+	//     </Relationship>
+	//     <Relationship Name="IndexedObject">
+	//         <Entry>
+	//             <References Name="[dbo].[table]" />
+	//         </Entry>
+	//     </Relationship>
+	// ...
+
+	ixs = make(map[string][]Index)
+
+	for _, element := range doc.Model.Element {
+		if element.Type != "SqlIndex" {
+			continue
+		}
+
+		var ix Index
+		var key string
+
+		ix.IdxName = extractQNToken(element.Name, 2)
+
+		for _, p := range element.Property {
+			switch p.Name {
+			case "IsUnique":
+				ix.IsUnique = p.AttrValue == "True"
+			case "IsClustered":
+				ix.IsClustered = p.AttrValue == "True"
+			case "FilterPredicate":
+				ix.Filter = strings.TrimSpace(p.Value.Text)
+			}
+		}
+
+		for _, r := range element.Relationship {
+			switch r.Name {
+			case "ColumnSpecifications":
+				for _, e := range r.Entry {
+					if e.Element.Type != "SqlIndexedColumnSpecification" || e.Element.Relationship.Name != "Column" {
+						continue
+					}
+					var c IndexColumn
+					c.ColName = extractQNToken(e.Element.Relationship.Entry[0].References.Name, 2)
+					for _, p := range e.Element.Property {
+						if p.Name == "IsAscending" && p.AttrValue == "False" {
+							c.IsDescending = true
+						}
+					}
+					ix.Columns = append(ix.Columns, c)
+				}
+			case "IncludedColumns":
+				for _, e := range r.Entry {
+					ix.Included = append(ix.Included, extractQNToken(e.References.Name, 2))
+				}
+			case "IndexedObject":
+				e := r.Entry[0]
+				key = e.References.Name
+			}
+		}
+
+		if key != "" && len(ix.Columns) > 0 {
+			ixs[key] = append(ixs[key], ix)
+		}
+	}
+
+	return ixs
+}
+
+// extractDefaultConstraints extracts the column defaults from the schema
+// model. The defaults are mapped by table and then column.
+func extractDefaultConstraints(doc DataSchemaModel) (dfs map[string]map[string]DefaultConstraint) {
+
+	// <Element Type="SqlDefaultConstraint" Name="[dbo].[DF_table_column]">
+	//     <Property Name="DefaultExpressionScript">
+	//         <Value><![CDATA[(getdate())]]></Value>
+	//     </Property>
+	//     <Relationship Name="DefiningTable">
+	//         <Entry>
+	//             <References Name="[dbo].[table]" />
+	//         </Entry>
+	//     </Relationship>
+	//     <Relationship Name="ForColumn">
+	//         <Entry>
+	//             <References Name="[dbo].[table].[column]" />
+	//         </Entry>
+	//     </Relationship>
+	// ...
+
+	dfs = make(map[string]map[string]DefaultConstraint)
+
+	for _, element := range doc.Model.Element {
+		if element.Type != "SqlDefaultConstraint" {
+			continue
+		}
+
+		var df DefaultConstraint
+		var key string
+
+		if element.Name != "" {
+			df.ConsName = extractQNToken(element.Name, 1)
+		}
+
+		for _, p := range element.Property {
+			if p.Name == "DefaultExpressionScript" {
+				df.Expression = strings.TrimSpace(p.Value.Text)
+			}
+		}
+
+		for _, r := range element.Relationship {
+			switch r.Name {
+			case "DefiningTable":
+				e := r.Entry[0]
+				key = e.References.Name
+			case "ForColumn":
+				e := r.Entry[0]
+				df.ColName = extractQNToken(e.References.Name, 2)
+			}
+		}
+
+		if key != "" && df.ColName != "" {
+			if _, ok := dfs[key]; !ok {
+				dfs[key] = make(map[string]DefaultConstraint)
+			}
+			dfs[key][df.ColName] = df
+		}
+	}
+
+	return dfs
+}
+
+// extractExtendedProperties extracts the extended properties from the
+// schema model. The properties are keyed by the (schema.name[.column])
+// name of the object that they are for.
+func extractExtendedProperties(doc DataSchemaModel) (eps map[string]map[string]string) {
+
+	// <Element Type="SqlExtendedProperty" Name="[SqlColumn].[dbo].[table].[column].[MS_Description]">
+	//     <Property Name="Value">
+	//         <Value><![CDATA[N'The description']]></Value>
+	//     </Property>
+	//     <Relationship Name="Host">
+	//         <Entry>
+	//             <References Name="[dbo].[table].[column]" />
+	//         </Entry>
+	//     </Relationship>
+	// </Element>
+
+	eps = make(map[string]map[string]string)
+
+	for _, element := range doc.Model.Element {
+		if element.Type != "SqlExtendedProperty" {
+			continue
+		}
+
+		tokens := strings.Split(element.Name, "].[")
+		name := strings.Trim(tokens[len(tokens)-1], "[]")
+
+		var value, host string
+		for _, p := range element.Property {
+			if p.Name == "Value" {
+				value = unquoteLiteral(p.Value.Text)
+			}
+		}
+		for _, r := range element.Relationship {
+			if r.Name != "Host" {
+				continue
+			}
+			for _, e := range r.Entry {
+				host = normalizeQN(e.References.Name)
+			}
+		}
+		if host == "" {
+			continue
+		}
+
+		if _, ok := eps[host]; !ok {
+			eps[host] = make(map[string]string)
+		}
+		eps[host][name] = value
+	}
+	return eps
+}
+
+// splitDescription splits the MS_Description from the other extended properties
+func splitDescription(props map[string]string) (desc string, other map[string]string) {
+	for k, v := range props {
+		if k == "MS_Description" {
+			desc = v
+			continue
+		}
+		if other == nil {
+			other = make(map[string]string)
+		}
+		other[k] = v
+	}
+	return desc, other
+}
+
+// unquoteLiteral returns the value of a (T-SQL) string literal, such as
+// N'it''s'. Other values (numbers, etc.) are returned as is.
+func unquoteLiteral(s string) string {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "N'") {
+		s = s[1:]
+	}
+	if len(s) >= 2 && strings.HasPrefix(s, "'") && strings.HasSuffix(s, "'") {
+		s = strings.Replace(s[1:len(s)-1], "''", "'", -1)
+	}
+	return s
+}
+
 // extractQNToken tokenizes the supplied qualified name and returns token[i]
 func extractQNToken(qn string, i int) (s string) {
 	if qn != "" {
@@ -4,7 +4,7 @@ import (
 	"fmt"
 )
 
-// readNText reads the value for a varchar column
+// readNText reads the value for a ntext column
 func readNText(r *tReader, tc TableColumn) (ec ExtractedColumn, err error) {
 
 	fn := "readNText"
@@ -31,6 +31,12 @@ func readNText(r *tReader, tc TableColumn) (ec ExtractedColumn, err error) {
 		return
 	}
 
+	// Stream large values
+	if r.isStreamed(tc, ss.byteCount) {
+		ec.LobFile, err = r.streamLob(fn, tc, ss.byteCount, lobText)
+		return
+	}
+
 	// Read the chars
 	var b []byte
 	b, err = r.readBytes(fn, ss.byteCount)
@@ -38,6 +44,9 @@ func readNText(r *tReader, tc TableColumn) (ec ExtractedColumn, err error) {
 		return
 	}
 
-	ec.Str = string(toRunes(b))
+	ec.Str, err = utf16ToString(b)
+	if err != nil {
+		err = fmt.Errorf("%s %s for column %q", fn, err, tc.ColName)
+	}
 	return
 }
@@ -4,7 +4,7 @@ import (
 	"fmt"
 )
 
-// readNVarchar reads the value for a varchar column
+// readNVarchar reads the value for a nvarchar column
 func readNVarchar(r *tReader, tc TableColumn) (ec ExtractedColumn, err error) {
 
 	fn := "readNVarchar"
@@ -12,9 +12,16 @@ func readNVarchar(r *tReader, tc TableColumn) (ec ExtractedColumn, err error) {
 		debOut(fmt.Sprintf("Func %s", fn))
 	}
 
+	// If the size is not specified then it is nvarchar(max) which, as
+	// for varchar(max), requires 8 bytes to store the size
+	sz := 2
+	if tc.Length == 0 {
+		sz = 8
+	}
+
 	// Determine how many bytes to read
 	var ss storedSize
-	ss, err = r.readStoredSize(tc, 2, 0)
+	ss, err = r.readStoredSize(tc, sz, 0)
 	if err != nil {
 		return
 	}
@@ -26,7 +33,7 @@ func readNVarchar(r *tReader, tc TableColumn) (ec ExtractedColumn, err error) {
 	}
 
 	// Check the stored size vs. the column size
-	if ss.byteCount > tc.Length*2 {
+	if tc.Length > 0 && ss.byteCount > tc.Length*2 {
 		err = fmt.Errorf("%s byteCount too large for column %q (%d vs %d)", fn, tc.ColName, ss.byteCount, tc.Length*2)
 		return
 	}
@@ -37,6 +44,12 @@ func readNVarchar(r *tReader, tc TableColumn) (ec ExtractedColumn, err error) {
 		return
 	}
 
+	// Stream large values
+	if r.isStreamed(tc, ss.byteCount) {
+		ec.LobFile, err = r.streamLob(fn, tc, ss.byteCount, lobText)
+		return
+	}
+
 	// Read the chars
 	var b []byte
 	b, err = r.readBytes(fn, ss.byteCount)
@@ -44,6 +57,9 @@ func readNVarchar(r *tReader, tc TableColumn) (ec ExtractedColumn, err error) {
 		return
 	}
 
-	ec.Str = string(toRunes(b))
+	ec.Str, err = utf16ToString(b)
+	if err != nil {
+		err = fmt.Errorf("%s %s for column %q", fn, err, tc.ColName)
+	}
 	return
 }
@@ -0,0 +1,225 @@
+package bactract
+
+// Extract the partition functions and schemes from the model and
+// determine the partition for the rows of partitioned tables
+
+import (
+	"math/big"
+	"strings"
+	"time"
+)
+
+// PartitionFunction contains the definition for a partition function
+type PartitionFunction struct {
+	Name         string
+	DtStr        string   // the datatype of the partitioning column
+	IsRangeRight bool     // the boundary values belong to the upper (RANGE RIGHT) rather than the lower (RANGE LEFT) partition
+	Boundaries   []string // the (unquoted) boundary values, in ascending order
+}
+
+// PartitionScheme contains the definition for a partition scheme
+type PartitionScheme struct {
+	Name     string
+	Function string // the partition function used by the scheme
+}
+
+// IsPartitioned returns true if the table is partitioned
+func (t Table) IsPartitioned() bool {
+	return t.PartitionColumn != "" && t.PartitionFunc.Name != ""
+}
+
+// PartitionCount returns the number of partitions for the table, or 0
+// for tables that are not partitioned
+func (t Table) PartitionCount() int {
+	if !t.IsPartitioned() {
+		return 0
+	}
+	return len(t.PartitionFunc.Boundaries) + 1
+}
+
+// PartitionNumber returns the (1 based, as $PARTITION does) partition
+// number for a row of data, or 0 for tables that are not partitioned.
+// Null values go to the first partition.
+func (t Table) PartitionNumber(row []ExtractedColumn) int {
+
+	if !t.IsPartitioned() {
+		return 0
+	}
+
+	var value ExtractedColumn
+	found := false
+	for _, ec := range row {
+		if ec.ColName == t.PartitionColumn {
+			value = ec
+			found = true
+			break
+		}
+	}
+	if !found || value.IsNull {
+		return 1
+	}
+
+	pf := t.PartitionFunc
+	for i, b := range pf.Boundaries {
+		c := compareBoundary(value.Str, b, pf.DtStr)
+		if c < 0 || (c == 0 && !pf.IsRangeRight) {
+			return i + 1
+		}
+	}
+	return len(pf.Boundaries) + 1
+}
+
+// compareBoundary compares a column value to a boundary value, returning
+// -1, 0, or +1. Values that cannot be parsed are compared as strings.
+func compareBoundary(value, boundary, dtStr string) int {
+
+	switch dtMap[dtStr] {
+	case BigInt, Int, SmallInt, TinyInt, Decimal, Numeric, Float, Real, Money, SmallMoney:
+		v, ok1 := new(big.Float).SetString(value)
+		b, ok2 := new(big.Float).SetString(boundary)
+		if ok1 && ok2 {
+			return v.Cmp(b)
+		}
+	case Date, Datetime, Datetime2, SmallDatetime, Time:
+		v, ok1 := ParseBoundaryTime(value)
+		b, ok2 := ParseBoundaryTime(boundary)
+		if ok1 && ok2 {
+			switch {
+			case v.Before(b):
+				return -1
+			case v.After(b):
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(value, boundary)
+}
+
+// boundaryTimeFormats are the formats accepted for date/time boundaries
+var boundaryTimeFormats = []string{
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02",
+	"20060102 15:04:05.999999999",
+	"20060102",
+	"15:04:05.999999999",
+}
+
+// ParseBoundaryTime parses a date/time value or partition boundary
+func ParseBoundaryTime(s string) (t time.Time, ok bool) {
+	for _, f := range boundaryTimeFormats {
+		t, err := time.Parse(f, strings.TrimSpace(s))
+		if err == nil {
+			return t, true
+		}
+	}
+	return t, false
+}
+
+// unquoteBoundary strips the parens, N prefix, and quotes from a
+// boundary value expression
+func unquoteBoundary(s string) string {
+	s = strings.TrimSpace(s)
+	for strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		s = strings.TrimSpace(s[1 : len(s)-1])
+	}
+	s = strings.TrimPrefix(s, "N")
+	if len(s) >= 2 && strings.HasPrefix(s, "'") && strings.HasSuffix(s, "'") {
+		s = strings.Replace(s[1:len(s)-1], "''", "'", -1)
+	}
+	return s
+}
+
+// extractPartitions extracts the partition functions and schemes from
+// the schema model
+func extractPartitions(doc DataSchemaModel) (fcns map[string]PartitionFunction, schemes map[string]PartitionScheme) {
+
+	// <Element Type="SqlPartitionFunction" Name="[pf_name]">
+	//     <Property Name="Range" Value="2" />
+	//     <Relationship Name="BoundaryValues">
+	//         <Entry>
+	//             <Element Type="SqlPartitionValue">
+	//                 <Property Name="ExpressionScript">
+	//                     <Value><![CDATA['2020-01-01']]></Value>
+	//                 </Property>
+	//             </Element>
+	//         </Entry>
+	//     ...
+	//     <Relationship Name="ParameterType">
+	//         <Entry>
+	//             <Element Type="SqlTypeSpecifier">
+	//                 <Relationship Name="Type">
+	//                     <Entry>
+	//                         <References ExternalSource="BuiltIns" Name="[date]" />
+	// ...
+	// <Element Type="SqlPartitionScheme" Name="[ps_name]">
+	//     <Relationship Name="PartitionFunction">
+	//         <Entry>
+	//             <References Name="[pf_name]" />
+	//         </Entry>
+	//     </Relationship>
+	// ...
+
+	fcns = make(map[string]PartitionFunction)
+	schemes = make(map[string]PartitionScheme)
+
+	for _, element := range doc.Model.Element {
+		switch element.Type {
+		case "SqlPartitionFunction":
+			var pf PartitionFunction
+			pf.Name = normalizeQN(element.Name)
+
+			for _, p := range element.Property {
+				if p.Name == "Range" {
+					pf.IsRangeRight = p.AttrValue == "2" || strings.EqualFold(p.AttrValue, "Right")
+				}
+			}
+
+			for _, r := range element.Relationship {
+				for _, e := range r.Entry {
+					switch r.Name {
+					case "BoundaryValues":
+						for _, p := range e.Element.Property {
+							if p.Name == "ExpressionScript" {
+								pf.Boundaries = append(pf.Boundaries, unquoteBoundary(p.Value.Text))
+							}
+						}
+					case "ParameterType":
+						for _, re := range e.Element.Relationship.Entry {
+							pf.DtStr = strings.TrimPrefix(normalizeQN(re.References.Name), "sys.")
+						}
+					}
+				}
+			}
+			fcns[pf.Name] = pf
+
+		case "SqlPartitionScheme":
+			var ps PartitionScheme
+			ps.Name = normalizeQN(element.Name)
+			for _, r := range element.Relationship {
+				if r.Name != "PartitionFunction" {
+					continue
+				}
+				for _, e := range r.Entry {
+					ps.Function = normalizeQN(e.References.Name)
+				}
+			}
+			schemes[ps.Name] = ps
+		}
+	}
+	return fcns, schemes
+}
+
+// linkPartitions adds the partition functions to the partitioned tables
+func linkPartitions(m *ExtractedModel) {
+	for key, t := range m.Tables {
+		if t.PartitionScheme == "" {
+			continue
+		}
+		if ps, ok := m.PartitionSchemes[t.PartitionScheme]; ok {
+			t.PartitionFunc = m.PartitionFunctions[ps.Function]
+			m.Tables[key] = t
+		}
+	}
+}
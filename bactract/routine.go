@@ -0,0 +1,390 @@
+package bactract
+
+// Extract the programmability objects (stored procedures, functions,
+// and triggers) from the model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Function kinds
+const (
+	ScalarFunction              = "scalar"
+	InlineTableFunction         = "inline table"
+	MultiStatementTableFunction = "multi-statement table"
+)
+
+// Parameter contains the definition for a procedure or function parameter
+type Parameter struct {
+	Name      string
+	DtStr     string
+	DataType  int
+	Length    int // -1 for max
+	Precision int
+	Scale     int
+	IsOutput  bool
+	Default   string // the (T-SQL) default expression
+}
+
+// Procedure contains the definition for a stored procedure
+type Procedure struct {
+	Schema     string
+	Name       string
+	Header     string // the CREATE PROCEDURE ... AS header, if available
+	Body       string // the (T-SQL) procedure body
+	Parameters []Parameter
+	References []string // the (schema.name) objects referenced by the body
+}
+
+// Function contains the definition for a user defined function
+type Function struct {
+	Schema        string
+	Name          string
+	Kind          string // ScalarFunction, InlineTableFunction, or MultiStatementTableFunction
+	Header        string // the CREATE FUNCTION ... AS header, if available
+	Body          string // the (T-SQL) function body
+	Parameters    []Parameter
+	ReturnType    Parameter // the return type for scalar functions
+	ReturnColumns []string  // the returned columns for table valued functions
+	References    []string  // the (schema.name) objects referenced by the body
+}
+
+// Trigger contains the definition for a DML trigger
+type Trigger struct {
+	Schema      string
+	Name        string
+	Table       string // the (schema.name) table or view that the trigger is on
+	Header      string // the CREATE TRIGGER ... AS header, if available
+	Body        string // the (T-SQL) trigger body
+	IsInsteadOf bool
+	OnInsert    bool
+	OnUpdate    bool
+	OnDelete    bool
+	References  []string // the (schema.name) objects referenced by the body
+}
+
+// routineKinds maps the model element types to the function kinds
+var routineKinds = map[string]string{
+	"SqlScalarFunction":                    ScalarFunction,
+	"SqlInlineTableValuedFunction":         InlineTableFunction,
+	"SqlMultiStatementTableValuedFunction": MultiStatementTableFunction,
+}
+
+// TypeName returns the T-SQL datatype of the parameter
+func (p Parameter) TypeName() string {
+	switch p.DataType {
+	case Char, Varchar, NChar, NVarchar, Binary, Varbinary:
+		if p.Length < 0 {
+			return p.DtStr + "(max)"
+		}
+		if p.Length > 0 {
+			return fmt.Sprintf("%s(%d)", p.DtStr, p.Length)
+		}
+	case Decimal, Numeric:
+		if p.Precision > 0 {
+			return fmt.Sprintf("%s(%d,%d)", p.DtStr, p.Precision, p.Scale)
+		}
+	case Datetime2, DatetimeOffset, Time:
+		if p.Scale > 0 {
+			return fmt.Sprintf("%s(%d)", p.DtStr, p.Scale)
+		}
+	}
+	return p.DtStr
+}
+
+// String returns the parameter as it would appear in a T-SQL header
+func (p Parameter) String() string {
+	s := p.Name + " " + p.TypeName()
+	if p.Default != "" {
+		s += " = " + p.Default
+	}
+	if p.IsOutput {
+		s += " OUTPUT"
+	}
+	return s
+}
+
+// Script returns the CREATE PROCEDURE script. When the original header
+// is not in the model then one is generated from the parameters.
+func (p Procedure) Script() string {
+	header := p.Header
+	if header == "" {
+		header = fmt.Sprintf("CREATE PROCEDURE [%s].[%s]%s\nAS", p.Schema, p.Name, paramList(p.Parameters, "\n    "))
+	}
+	return header + "\n" + p.Body
+}
+
+// Script returns the CREATE FUNCTION script. When the original header
+// is not in the model then one is generated from the parameters and
+// return type.
+func (f Function) Script() string {
+	header := f.Header
+	if header == "" {
+		returns := "TABLE"
+		if f.Kind == ScalarFunction {
+			returns = f.ReturnType.TypeName()
+		}
+		header = fmt.Sprintf("CREATE FUNCTION [%s].[%s] (%s )\nRETURNS %s\nAS", f.Schema, f.Name, paramList(f.Parameters, "\n    "), returns)
+	}
+	return header + "\n" + f.Body
+}
+
+// Script returns the CREATE TRIGGER script. When the original header
+// is not in the model then one is generated from the trigger events.
+func (t Trigger) Script() string {
+	header := t.Header
+	if header == "" {
+		var events []string
+		if t.OnInsert {
+			events = append(events, "INSERT")
+		}
+		if t.OnUpdate {
+			events = append(events, "UPDATE")
+		}
+		if t.OnDelete {
+			events = append(events, "DELETE")
+		}
+		timing := "AFTER"
+		if t.IsInsteadOf {
+			timing = "INSTEAD OF"
+		}
+		tab := strings.Replace(t.Table, ".", "].[", -1)
+		header = fmt.Sprintf("CREATE TRIGGER [%s].[%s] ON [%s]\n%s %s\nAS", t.Schema, t.Name, tab, timing, strings.Join(events, ", "))
+	}
+	return header + "\n" + t.Body
+}
+
+// paramList formats the parameters for a generated header
+func paramList(params []Parameter, sep string) string {
+	if len(params) == 0 {
+		return ""
+	}
+	var s []string
+	for _, p := range params {
+		s = append(s, p.String())
+	}
+	return sep + strings.Join(s, ","+sep)
+}
+
+// extractRoutines extracts the stored procedures, functions, and
+// triggers from the schema model
+func extractRoutines(doc DataSchemaModel) (procs map[string]Procedure, fcns map[string]Function, trigs map[string]Trigger) {
+
+	// <Element Type="SqlProcedure" Name="[dbo].[proc_name]">
+	//     <Property Name="BodyScript">
+	//         <Value><![CDATA[BEGIN ... END]]></Value>
+	//     </Property>
+	//     <Relationship Name="BodyDependencies">
+	//         <Entry>
+	//             <References Name="[dbo].[table]" />
+	//         </Entry>
+	//     ...
+	//     <Relationship Name="Parameters">
+	//         <Entry>
+	//             <Element Type="SqlSubroutineParameter" Name="[dbo].[proc_name].[@param]">
+	//                 <Property Name="IsOutput" Value="True" />
+	//                 <Relationship Name="Type">
+	//                     <Entry>
+	//                         <Element Type="SqlTypeSpecifier">
+	//                         ...
+	//     <Annotation Type="SysCommentsObjectAnnotation">
+	//         <Property Name="HeaderContents" Value="CREATE PROCEDURE ... AS" />
+	//     ...
+	//
+	// Functions keep the body in a nested SqlScriptFunctionImplementation
+	// element (the FunctionBody relationship) and triggers reference the
+	// table in the Parent relationship.
+
+	procs = make(map[string]Procedure)
+	fcns = make(map[string]Function)
+	trigs = make(map[string]Trigger)
+
+	for _, element := range doc.Model.Element {
+
+		kind, isFcn := routineKinds[element.Type]
+		if !isFcn && element.Type != "SqlProcedure" && element.Type != "SqlDmlTrigger" {
+			continue
+		}
+
+		schema := extractQNToken(element.Name, 0)
+		name := extractQNToken(element.Name, 1)
+		self := strings.Join([]string{schema, name}, ".")
+
+		var header, body, table string
+		var params []Parameter
+		var retType Parameter
+		var retCols, refs []string
+		var trig Trigger
+
+		for _, a := range element.Annotation {
+			if a.Type != "SysCommentsObjectAnnotation" {
+				continue
+			}
+			for _, p := range a.Property {
+				if p.Name == "HeaderContents" {
+					header = strings.TrimSpace(p.Value)
+				}
+			}
+		}
+
+		for _, p := range element.Property {
+			switch p.Name {
+			case "BodyScript":
+				body = strings.TrimSpace(p.Value.Text)
+			case "IsInsertTrigger":
+				trig.OnInsert = p.AttrValue == "True"
+			case "IsUpdateTrigger":
+				trig.OnUpdate = p.AttrValue == "True"
+			case "IsDeleteTrigger":
+				trig.OnDelete = p.AttrValue == "True"
+			case "SqlTriggerType":
+				trig.IsInsteadOf = p.AttrValue == "2"
+			}
+		}
+
+		deps := make(map[string]bool)
+		addDep := func(n, externalSource string) {
+			if n == "" || externalSource == "BuiltIns" {
+				return
+			}
+			tokens := strings.Split(normalizeQN(n), ".")
+			if len(tokens) < 2 {
+				return
+			}
+			dep := strings.Join(tokens[:2], ".")
+			if dep != self && !deps[dep] {
+				deps[dep] = true
+				refs = append(refs, dep)
+			}
+		}
+
+		for _, r := range element.Relationship {
+			switch r.Name {
+			case "BodyDependencies":
+				for _, e := range r.Entry {
+					addDep(e.References.Name, e.References.ExternalSource)
+				}
+			case "FunctionBody":
+				for _, e := range r.Entry {
+					for _, p := range e.Element.Property {
+						if p.Name == "BodyScript" {
+							body = strings.TrimSpace(p.Value.Text)
+						}
+					}
+					if e.Element.Relationship.Name == "BodyDependencies" {
+						for _, re := range e.Element.Relationship.Entry {
+							addDep(re.References.Name, re.References.ExternalSource)
+						}
+					}
+				}
+			case "Parameters":
+				for _, e := range r.Entry {
+					if e.Element.Type != "SqlSubroutineParameter" {
+						continue
+					}
+					var prm Parameter
+					prm.Name = extractQNToken(e.Element.Name, 2)
+					for _, p := range e.Element.Property {
+						switch p.Name {
+						case "IsOutput":
+							prm.IsOutput = p.AttrValue == "True"
+						case "DefaultExpressionScript":
+							prm.Default = strings.TrimSpace(p.Value.Text)
+						}
+					}
+					for _, re := range e.Element.Relationship.Entry {
+						if re.Element.Type != "SqlTypeSpecifier" {
+							continue
+						}
+						prm.DtStr = strings.TrimPrefix(normalizeQN(re.Element.Relationship.Entry.References.Name), "sys.")
+						prm.DataType = dtMap[prm.DtStr]
+						for _, p := range re.Element.Property {
+							switch p.Name {
+							case "Length":
+								prm.Length, _ = toInt([]byte(p.Value))
+							case "Precision":
+								prm.Precision, _ = toInt([]byte(p.Value))
+							case "Scale":
+								prm.Scale, _ = toInt([]byte(p.Value))
+							case "IsMax":
+								if p.Value == "True" {
+									prm.Length = -1
+								}
+							}
+						}
+					}
+					params = append(params, prm)
+				}
+			case "Type":
+				for _, e := range r.Entry {
+					if e.Element.Type != "SqlTypeSpecifier" {
+						continue
+					}
+					for _, re := range e.Element.Relationship.Entry {
+						retType.DtStr = strings.TrimPrefix(normalizeQN(re.References.Name), "sys.")
+						retType.DataType = dtMap[retType.DtStr]
+					}
+					for _, p := range e.Element.Property {
+						switch p.Name {
+						case "Length":
+							retType.Length, _ = toInt([]byte(p.AttrValue))
+						case "Precision":
+							retType.Precision, _ = toInt([]byte(p.AttrValue))
+						case "Scale":
+							retType.Scale, _ = toInt([]byte(p.AttrValue))
+						case "IsMax":
+							if p.AttrValue == "True" {
+								retType.Length = -1
+							}
+						}
+					}
+				}
+			case "Columns":
+				for _, e := range r.Entry {
+					if e.Element.Name != "" {
+						retCols = append(retCols, extractQNToken(e.Element.Name, 2))
+					}
+				}
+			case "Parent":
+				for _, e := range r.Entry {
+					table = normalizeQN(e.References.Name)
+				}
+			}
+		}
+
+		switch {
+		case isFcn:
+			fcns[self] = Function{
+				Schema:        schema,
+				Name:          name,
+				Kind:          kind,
+				Header:        header,
+				Body:          body,
+				Parameters:    params,
+				ReturnType:    retType,
+				ReturnColumns: retCols,
+				References:    refs,
+			}
+		case element.Type == "SqlProcedure":
+			procs[self] = Procedure{
+				Schema:     schema,
+				Name:       name,
+				Header:     header,
+				Body:       body,
+				Parameters: params,
+				References: refs,
+			}
+		default:
+			trig.Schema = schema
+			trig.Name = name
+			trig.Table = table
+			trig.Header = header
+			trig.Body = body
+			trig.References = refs
+			trigs[self] = trig
+		}
+	}
+
+	return procs, fcns, trigs
+}
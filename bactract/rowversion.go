@@ -0,0 +1,58 @@
+package bactract
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// readRowversion reads the value for a rowversion (timestamp) column.
+//
+// Note 1. A rowversion is stored as 8 bytes in big-endian order. The
+// value is translated to either a (lowercase) hex string or the
+// corresponding unsigned integer depending on the rowversionFormat.
+func readRowversion(r *tReader, tc TableColumn) (ec ExtractedColumn, err error) {
+
+	fn := "readRowversion"
+	defSz := 8
+	if debugFlag {
+		debOut(fmt.Sprintf("Func %s", fn))
+	}
+
+	// Determine how many bytes to read
+	var ss storedSize
+	ss, err = r.readStoredSize(tc, 1, defSz)
+	if err != nil {
+		return
+	}
+
+	// Check for nulls
+	if ss.isNull {
+		ec.IsNull = ss.isNull
+		return
+	}
+
+	// Assert: If not null then the stored size is the default
+	if ss.byteCount != defSz {
+		err = fmt.Errorf("%s byteCount too large for column %q (%d vs %d)", fn, tc.ColName, ss.byteCount, defSz)
+		return
+	}
+
+	// Read and translate the rowversion
+	var b []byte
+	b, err = r.readBytes(fn, ss.byteCount)
+	if err != nil {
+		return
+	}
+
+	if rowversionFormat == RowversionUint64 {
+		var z uint64
+		for _, sb := range b {
+			z = z<<8 | uint64(sb)
+		}
+		ec.Str = fmt.Sprint(z)
+		return
+	}
+
+	ec.Str = hex.EncodeToString(b)
+	return
+}
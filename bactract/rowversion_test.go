@@ -0,0 +1,74 @@
+package bactract
+
+import (
+	"testing"
+)
+
+func TestReadRowversion(t *testing.T) {
+
+	saved := rowversionFormat
+	defer func() { rowversionFormat = saved }()
+
+	// 0x00000000000007d1 (2001) and a value beyond the int64 range. The
+	// not null values have no size, the nullable ones a 1 byte size.
+	tests := []struct {
+		name     string
+		format   int
+		nullable bool
+		b        []byte
+		want     string
+	}{
+		{"hex", RowversionHex, false, []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x07, 0xd1}, "00000000000007d1"},
+		{"uint64", RowversionUint64, false, []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x07, 0xd1}, "2001"},
+		{"nullable hex", RowversionHex, true, []byte{0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x07, 0xd1}, "00000000000007d1"},
+		{"beyond int64", RowversionUint64, false, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe}, "18446744073709551614"},
+	}
+
+	for _, tt := range tests {
+		rowversionFormat = tt.format
+		tc := TableColumn{ColName: "rv", DataType: Rowversion, DtStr: "rowversion", IsNullable: tt.nullable}
+		ec, err := readRowversion(variantReader(tt.b), tc)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+		if ec.Str != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, ec.Str, tt.want)
+		}
+	}
+
+	tc := TableColumn{ColName: "rv", DataType: Rowversion, DtStr: "rowversion", IsNullable: true}
+
+	ec, err := readRowversion(variantReader([]byte{0xff}), tc)
+	if err != nil {
+		t.Fatalf("null: unexpected error: %s", err)
+	}
+	if !ec.IsNull {
+		t.Errorf("null: got %q, want null", ec.Str)
+	}
+
+	if _, err := readRowversion(variantReader([]byte{0x04, 0x00, 0x00, 0x07, 0xd1}), tc); err == nil {
+		t.Errorf("short value: expected an error")
+	}
+}
+
+func TestReadImage(t *testing.T) {
+
+	tc := TableColumn{ColName: "img", DataType: Image, DtStr: "image", IsNullable: true}
+
+	ec, err := readImage(variantReader([]byte{0x03, 0x00, 0x00, 0x00, 0xde, 0xad, 0x01}), tc)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ec.Str != "dead01" {
+		t.Errorf("got %q, want %q", ec.Str, "dead01")
+	}
+
+	ec, err = readImage(variantReader([]byte{0xff, 0xff, 0xff, 0xff}), tc)
+	if err != nil {
+		t.Fatalf("null: unexpected error: %s", err)
+	}
+	if !ec.IsNull {
+		t.Errorf("null: got %q, want null", ec.Str)
+	}
+}
@@ -0,0 +1,409 @@
+package bactract
+
+// Extract the schemas, sequences, and synonyms from the model and remap
+// the schema names for the output
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Schema contains the definition for a database schema
+type Schema struct {
+	Name  string
+	Owner string // the owning user or role
+}
+
+// Sequence contains the definition for a sequence. The values are kept
+// as strings as decimal sequences may exceed the range of an int64.
+type Sequence struct {
+	Schema     string
+	Name       string
+	DtStr      string // the datatype (bigint if not specified)
+	StartValue string
+	Increment  string
+	MinValue   string // empty for NO MINVALUE
+	MaxValue   string // empty for NO MAXVALUE
+	IsCycling  bool
+	CacheSize  string // empty for the default cache size
+	NoCache    bool
+}
+
+// Synonym contains the definition for a synonym
+type Synonym struct {
+	Schema     string
+	Name       string
+	Target     string // the (schema.name, or db.schema.name) object that the synonym is for
+	IsExternal bool   // the target is in another database or on another server
+}
+
+// LookupSchemaMap parses a comma separated list of source=target schema
+// mappings (dbo=public,sales=sales_data)
+func LookupSchemaMap(s string) (m map[string]string, err error) {
+
+	m = make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" || strings.TrimSpace(kv[1]) == "" {
+			return m, fmt.Errorf("invalid schema mapping %q", pair)
+		}
+		m[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return m, err
+}
+
+// MapTableName returns the (schema.table) table name with the schema
+// name mapped (see SetSchemaMap)
+func (b Bacpac) MapTableName(name string) string {
+	return mapQN(name)
+}
+
+// mapSchema returns the output name for a schema. Schema names are
+// matched case insensitively, as SQL Server does.
+func mapSchema(s string) string {
+	if t, ok := schemaMap[s]; ok {
+		return t
+	}
+	for k, t := range schemaMap {
+		if strings.EqualFold(k, s) {
+			return t
+		}
+	}
+	return s
+}
+
+// mapQN maps the schema of a (schema.name[.column]) qualified name
+func mapQN(qn string) string {
+	if len(schemaMap) == 0 {
+		return qn
+	}
+	tokens := strings.SplitN(qn, ".", 2)
+	if len(tokens) < 2 {
+		return qn
+	}
+	return mapSchema(tokens[0]) + "." + tokens[1]
+}
+
+// mapQNs maps the schemas of a list of qualified names
+func mapQNs(qns []string) []string {
+	for i, qn := range qns {
+		qns[i] = mapQN(qn)
+	}
+	return qns
+}
+
+// remapSchemas applies the schema map to the extracted model. The data
+// directories for the tables are not affected.
+func remapSchemas(m *ExtractedModel) {
+
+	if len(schemaMap) == 0 {
+		return
+	}
+
+	schemas := make(map[string]Schema)
+	for _, s := range m.Schemas {
+		s.Name = mapSchema(s.Name)
+		schemas[s.Name] = s
+	}
+	m.Schemas = schemas
+
+	tables := make(map[string]Table)
+	for _, t := range m.Tables {
+		t.Schema = mapSchema(t.Schema)
+		for i := range t.FKs {
+			t.FKs[i].RefTable = mapQN(t.FKs[i].RefTable)
+		}
+		for i, c := range t.Columns {
+			if c.UserType != "" {
+				t.Columns[i].UserType = mapQN(c.UserType)
+			}
+		}
+		if t.HistoryTable != "" {
+			t.HistoryTable = mapQN(t.HistoryTable)
+		}
+		if t.TemporalTable != "" {
+			t.TemporalTable = mapQN(t.TemporalTable)
+		}
+		tables[t.Schema+"."+t.TabName] = t
+	}
+	m.Tables = tables
+
+	uts := make(map[string]UserDefinedType)
+	for _, ut := range m.UserTypes {
+		if _, ok := m.UserTypes[ut.BaseType]; ok {
+			ut.BaseType = mapQN(ut.BaseType)
+		}
+		ut.Name = mapQN(ut.Name)
+		ut.Schema = mapSchema(ut.Schema)
+		uts[ut.Name] = ut
+	}
+	m.UserTypes = uts
+
+	tts := make(map[string]TableType)
+	for _, tt := range m.TableTypes {
+		tt.Schema = mapSchema(tt.Schema)
+		for i, c := range tt.Columns {
+			if c.UserType != "" {
+				tt.Columns[i].UserType = mapQN(c.UserType)
+			}
+		}
+		tts[tt.Schema+"."+tt.Name] = tt
+	}
+	m.TableTypes = tts
+
+	clrs := make(map[string]ClrType)
+	for _, ct := range m.ClrTypes {
+		ct.Schema = mapSchema(ct.Schema)
+		clrs[ct.Schema+"."+ct.Name] = ct
+	}
+	m.ClrTypes = clrs
+
+	views := make(map[string]View)
+	for _, vw := range m.Views {
+		vw.Schema = mapSchema(vw.Schema)
+		vw.Dependencies = mapQNs(vw.Dependencies)
+		vw.ColumnDeps = mapQNs(vw.ColumnDeps)
+		views[vw.Schema+"."+vw.Name] = vw
+	}
+	m.Views = views
+
+	procs := make(map[string]Procedure)
+	for _, p := range m.Procedures {
+		p.Schema = mapSchema(p.Schema)
+		p.References = mapQNs(p.References)
+		procs[p.Schema+"."+p.Name] = p
+	}
+	m.Procedures = procs
+
+	fcns := make(map[string]Function)
+	for _, f := range m.Functions {
+		f.Schema = mapSchema(f.Schema)
+		f.References = mapQNs(f.References)
+		fcns[f.Schema+"."+f.Name] = f
+	}
+	m.Functions = fcns
+
+	trigs := make(map[string]Trigger)
+	for _, t := range m.Triggers {
+		t.Schema = mapSchema(t.Schema)
+		t.Table = mapQN(t.Table)
+		t.References = mapQNs(t.References)
+		trigs[t.Schema+"."+t.Name] = t
+	}
+	m.Triggers = trigs
+
+	seqs := make(map[string]Sequence)
+	for _, s := range m.Sequences {
+		s.Schema = mapSchema(s.Schema)
+		seqs[s.Schema+"."+s.Name] = s
+	}
+	m.Sequences = seqs
+
+	syns := make(map[string]Synonym)
+	for _, s := range m.Synonyms {
+		s.Schema = mapSchema(s.Schema)
+		if !s.IsExternal {
+			s.Target = mapQN(s.Target)
+		}
+		syns[s.Schema+"."+s.Name] = s
+	}
+	m.Synonyms = syns
+
+	eps := make(map[string]map[string]string)
+	for k, p := range m.ExtendedProperties {
+		eps[mapQN(k)] = p
+	}
+	m.ExtendedProperties = eps
+
+	users := make(map[string]User)
+	for _, u := range m.Users {
+		if u.DefaultSchema != "" {
+			u.DefaultSchema = mapSchema(u.DefaultSchema)
+		}
+		users[u.Name] = u
+	}
+	m.Users = users
+
+	for i, p := range m.Permissions {
+		switch p.Class {
+		case SchemaClass:
+			m.Permissions[i].Object = mapSchema(p.Object)
+		case ObjectClass:
+			m.Permissions[i].Object = mapQN(p.Object)
+		}
+	}
+}
+
+// extractSchemas extracts the (user created) schemas from the schema model
+func extractSchemas(doc DataSchemaModel) (schemas map[string]Schema) {
+
+	// <Element Type="SqlSchema" Name="[sales]">
+	//     <Relationship Name="Authorizer">
+	//         <Entry>
+	//             <References ExternalSource="BuiltIns" Name="[dbo]" />
+	//         </Entry>
+	//     </Relationship>
+	// </Element>
+
+	schemas = make(map[string]Schema)
+
+	for _, element := range doc.Model.Element {
+		if element.Type != "SqlSchema" {
+			continue
+		}
+
+		var s Schema
+		s.Name = normalizeQN(element.Name)
+
+		for _, r := range element.Relationship {
+			if r.Name != "Authorizer" {
+				continue
+			}
+			for _, e := range r.Entry {
+				s.Owner = normalizeQN(e.References.Name)
+			}
+		}
+		schemas[s.Name] = s
+	}
+	return schemas
+}
+
+// extractSequences extracts the sequences from the schema model
+func extractSequences(doc DataSchemaModel) (seqs map[string]Sequence) {
+
+	// <Element Type="SqlSequence" Name="[dbo].[seq_name]">
+	//     <Property Name="IsCycling" Value="True" />
+	//     <Property Name="StartValue">
+	//         <Value><![CDATA[1]]></Value>
+	//     </Property>
+	//     <Property Name="IncrementValue">
+	//         <Value><![CDATA[1]]></Value>
+	//     </Property>
+	//     ...
+	//     <Relationship Name="Type">
+	//         <Entry>
+	//             <References ExternalSource="BuiltIns" Name="[bigint]" />
+	//         </Entry>
+	//     </Relationship>
+	// ...
+
+	seqs = make(map[string]Sequence)
+
+	for _, element := range doc.Model.Element {
+		if element.Type != "SqlSequence" {
+			continue
+		}
+
+		var s Sequence
+		s.Schema = extractQNToken(element.Name, 0)
+		s.Name = extractQNToken(element.Name, 1)
+		s.DtStr = "bigint"
+		s.StartValue = "1"
+		s.Increment = "1"
+
+		var noMin, noMax bool
+		for _, p := range element.Property {
+			val := strings.TrimSpace(p.AttrValue)
+			if val == "" {
+				val = strings.Trim(strings.TrimSpace(p.Value.Text), "()")
+			}
+			switch p.Name {
+			case "StartValue":
+				s.StartValue = val
+			case "IncrementValue":
+				s.Increment = val
+			case "MinValue":
+				s.MinValue = val
+			case "MaxValue":
+				s.MaxValue = val
+			case "NoMinValue":
+				noMin = val == "True"
+			case "NoMaxValue":
+				noMax = val == "True"
+			case "IsCycling":
+				s.IsCycling = val == "True"
+			case "CacheSize":
+				s.CacheSize = val
+			case "IsCached":
+				s.NoCache = val == "False"
+			case "NoCache":
+				s.NoCache = val == "True"
+			}
+		}
+		if noMin {
+			s.MinValue = ""
+		}
+		if noMax {
+			s.MaxValue = ""
+		}
+
+		for _, r := range element.Relationship {
+			if r.Name != "Type" {
+				continue
+			}
+			for _, e := range r.Entry {
+				n := e.References.Name
+				if n == "" && len(e.Element.Relationship.Entry) > 0 {
+					n = e.Element.Relationship.Entry[0].References.Name
+				}
+				s.DtStr = strings.TrimPrefix(normalizeQN(n), "sys.")
+			}
+		}
+
+		key := strings.Join([]string{s.Schema, s.Name}, ".")
+		seqs[key] = s
+	}
+	return seqs
+}
+
+// extractSynonyms extracts the synonyms from the schema model
+func extractSynonyms(doc DataSchemaModel) (syns map[string]Synonym) {
+
+	// <Element Type="SqlSynonym" Name="[dbo].[syn_name]">
+	//     <Property Name="ForObjectScript">
+	//         <Value><![CDATA[[otherdb].[dbo].[table]]]></Value>
+	//     </Property>
+	//     <Relationship Name="ForObject">
+	//         <Entry>
+	//             <References Name="[dbo].[table]" />
+	//         </Entry>
+	//     </Relationship>
+	// ...
+
+	syns = make(map[string]Synonym)
+
+	for _, element := range doc.Model.Element {
+		if element.Type != "SqlSynonym" {
+			continue
+		}
+
+		var s Synonym
+		s.Schema = extractQNToken(element.Name, 0)
+		s.Name = extractQNToken(element.Name, 1)
+
+		for _, p := range element.Property {
+			if p.Name == "ForObjectScript" {
+				s.Target = normalizeQN(strings.TrimSpace(p.Value.Text))
+			}
+		}
+		for _, r := range element.Relationship {
+			if r.Name != "ForObject" {
+				continue
+			}
+			for _, e := range r.Entry {
+				if e.References.Name != "" && e.References.ExternalSource == "" {
+					s.Target = normalizeQN(e.References.Name)
+				}
+			}
+		}
+		s.IsExternal = strings.Count(s.Target, ".") > 1
+
+		key := strings.Join([]string{s.Schema, s.Name}, ".")
+		syns[key] = s
+	}
+	return syns
+}
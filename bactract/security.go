@@ -0,0 +1,253 @@
+package bactract
+
+// Extract the security objects (users, roles, role memberships, and
+// permissions) from the model
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Permission classes
+const (
+	DatabaseClass = "DATABASE"
+	SchemaClass   = "SCHEMA"
+	ObjectClass   = "OBJECT"
+)
+
+// User contains the definition for a database user
+type User struct {
+	Name               string
+	Login              string // the server login, if any
+	DefaultSchema      string
+	AuthenticationType string // Instance, Database, Windows, External, or None
+	IsCertificate      bool   // mapped to a certificate or asymmetric key
+}
+
+// Role contains the definition for a (user defined) database role
+type Role struct {
+	Name  string
+	Owner string
+}
+
+// RoleMembership contains a member (user or role) of a database role.
+// The role may be a fixed database role (db_datareader, etc.).
+type RoleMembership struct {
+	Role   string
+	Member string
+}
+
+// Permission contains a permission statement
+type Permission struct {
+	State      string // GRANT, GRANT WITH GRANT OPTION, DENY, or REVOKE
+	Permission string // SELECT, EXECUTE, VIEW DEFINITION, etc.
+	Class      string // DatabaseClass, SchemaClass, or ObjectClass
+	Object     string // the (schema.name) object or schema name, empty for the database
+	Grantee    string
+	Grantor    string
+}
+
+// extractUsers extracts the database users from the schema model
+func extractUsers(doc DataSchemaModel) (users map[string]User) {
+
+	// <Element Type="SqlUser" Name="[user_name]">
+	//     <Property Name="AuthenticationType" Value="1" />
+	//     <Relationship Name="DefaultSchema">
+	//         <Entry>
+	//             <References ExternalSource="BuiltIns" Name="[dbo]" />
+	//         </Entry>
+	//     </Relationship>
+	//     <Relationship Name="Login">
+	//         <Entry>
+	//             <References ExternalSource="UnresolvedEntity" Name="[login_name]" />
+	//         </Entry>
+	//     </Relationship>
+	// </Element>
+
+	users = make(map[string]User)
+
+	for _, element := range doc.Model.Element {
+		if element.Type != "SqlUser" {
+			continue
+		}
+
+		var u User
+		u.Name = normalizeQN(element.Name)
+
+		for _, p := range element.Property {
+			switch p.Name {
+			case "AuthenticationType":
+				u.AuthenticationType = authenticationType(p.AttrValue)
+			case "WithoutLogin":
+				if p.AttrValue == "True" {
+					u.AuthenticationType = "None"
+				}
+			}
+		}
+
+		for _, r := range element.Relationship {
+			for _, e := range r.Entry {
+				switch r.Name {
+				case "Login":
+					u.Login = normalizeQN(e.References.Name)
+				case "DefaultSchema":
+					u.DefaultSchema = normalizeQN(e.References.Name)
+				case "Certificate", "AsymmetricKey":
+					u.IsCertificate = true
+				}
+			}
+		}
+		users[u.Name] = u
+	}
+	return users
+}
+
+// authenticationType maps the (numeric) user authentication type
+func authenticationType(s string) string {
+	switch s {
+	case "0":
+		return "None"
+	case "1":
+		return "Instance"
+	case "2":
+		return "Database"
+	case "3":
+		return "Windows"
+	case "4":
+		return "External"
+	}
+	return s
+}
+
+// extractRoles extracts the (user defined) roles and the role
+// memberships from the schema model
+func extractRoles(doc DataSchemaModel) (roles map[string]Role, members []RoleMembership) {
+
+	// <Element Type="SqlRole" Name="[role_name]">
+	//     <Relationship Name="Authorizer">
+	//         <Entry>
+	//             <References ExternalSource="BuiltIns" Name="[dbo]" />
+	//         </Entry>
+	//     </Relationship>
+	// </Element>
+	// <Element Type="SqlRoleMembership">
+	//     <Relationship Name="Member">
+	//         <Entry>
+	//             <References Name="[user_name]" />
+	//         </Entry>
+	//     </Relationship>
+	//     <Relationship Name="Role">
+	//         <Entry>
+	//             <References ExternalSource="BuiltIns" Name="[db_datareader]" />
+	//         </Entry>
+	//     </Relationship>
+	// </Element>
+
+	roles = make(map[string]Role)
+
+	for _, element := range doc.Model.Element {
+		switch element.Type {
+		case "SqlRole":
+			var r Role
+			r.Name = normalizeQN(element.Name)
+			for _, rel := range element.Relationship {
+				if rel.Name != "Authorizer" {
+					continue
+				}
+				for _, e := range rel.Entry {
+					r.Owner = normalizeQN(e.References.Name)
+				}
+			}
+			roles[r.Name] = r
+
+		case "SqlRoleMembership":
+			var m RoleMembership
+			for _, rel := range element.Relationship {
+				for _, e := range rel.Entry {
+					switch rel.Name {
+					case "Member":
+						m.Member = normalizeQN(e.References.Name)
+					case "Role":
+						m.Role = normalizeQN(e.References.Name)
+					}
+				}
+			}
+			if m.Role != "" && m.Member != "" {
+				members = append(members, m)
+			}
+		}
+	}
+	return roles, members
+}
+
+// extractPermissions extracts the permission statements from the schema model
+func extractPermissions(doc DataSchemaModel) (perms []Permission) {
+
+	// <Element Type="SqlPermissionStatement" Name="[Grant.Select.Object].[user_name].[dbo].[dbo].[table]">
+	//     <Relationship Name="Grantee">
+	//         <Entry>
+	//             <References Name="[user_name]" />
+	//         </Entry>
+	//     </Relationship>
+	//     <Relationship Name="Grantor">
+	//         <Entry>
+	//             <References ExternalSource="BuiltIns" Name="[dbo]" />
+	//         </Entry>
+	//     </Relationship>
+	//     <Relationship Name="SecuredObject">
+	//         <Entry>
+	//             <References Name="[dbo].[table]" />
+	//         </Entry>
+	//     </Relationship>
+	// </Element>
+	//
+	// The state, permission, and class are taken from the first part of
+	// the element name.
+
+	for _, element := range doc.Model.Element {
+		if element.Type != "SqlPermissionStatement" {
+			continue
+		}
+
+		var p Permission
+		parts := strings.Split(extractQNToken(element.Name, 0), ".")
+		if len(parts) < 2 {
+			continue
+		}
+		p.State = splitCamelCase(parts[0])
+		p.Permission = splitCamelCase(strings.Join(parts[1:len(parts)-1], ""))
+		p.Class = strings.ToUpper(parts[len(parts)-1])
+		if len(parts) == 2 {
+			p.Permission = splitCamelCase(parts[1])
+			p.Class = DatabaseClass
+		}
+
+		for _, r := range element.Relationship {
+			for _, e := range r.Entry {
+				switch r.Name {
+				case "Grantee":
+					p.Grantee = normalizeQN(e.References.Name)
+				case "Grantor":
+					p.Grantor = normalizeQN(e.References.Name)
+				case "SecuredObject":
+					p.Object = normalizeQN(e.References.Name)
+				}
+			}
+		}
+		perms = append(perms, p)
+	}
+	return perms
+}
+
+// splitCamelCase splits, and uppercases, the camel case permission
+// names (ViewDefinition becomes VIEW DEFINITION)
+func splitCamelCase(s string) string {
+	var sb strings.Builder
+	for i, r := range s {
+		if i > 0 && unicode.IsUpper(r) {
+			sb.WriteRune(' ')
+		}
+		sb.WriteRune(unicode.ToUpper(r))
+	}
+	return sb.String()
+}
@@ -7,8 +7,12 @@ import (
 
 // readSmallDatetime reads the value for a small-datetime column.
 //
-// Note 1. A smalldatetime appears to be stored as two int16 values,
+// Note 1. A smalldatetime appears to be stored as two uint16 values,
 // one for days since 1900-01-01 and the other for minutes since midnight
+//
+// Note 2. As a smalldatetime only has minute resolution the seconds are
+// always zero and there are never any fractional seconds, regardless of
+// the output precision.
 func readSmallDatetime(r *tReader, tc TableColumn) (ec ExtractedColumn, err error) {
 
 	fn := "readSmallDatetime"
@@ -60,15 +64,19 @@ func readSmallDatetime(r *tReader, tc TableColumn) (ec ExtractedColumn, err erro
 			days |= int(sb) << uint(8*i)
 		}
 
+		// 60 * 24 minutes per day
+		if mins >= 1440 {
+			err = fmt.Errorf("%s invalid minutes (%d) for column %q", fn, mins, tc.ColName)
+			return
+		}
+
 		start := time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC)
 		d := start.AddDate(0, 0, days)
 
 		// Add the time portion
-		m, _ := time.ParseDuration(fmt.Sprintf("%dm", mins))
-		dt := d.Add(m)
-
-		ec.Str = dt.Format("2006-01-02 15:04:05")
+		dt := d.Add(time.Duration(mins) * time.Minute)
 
+		ec.Str = dt.Format(calcDatetimeFormat(0))
 	}
 
 	return
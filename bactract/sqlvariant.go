@@ -0,0 +1,179 @@
+package bactract
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// variantType contains the information needed for parsing the value
+// of a sql_variant having a given base type
+type variantType struct {
+	dataType int
+	dtStr    string
+	fcn      fn
+}
+
+// variantTypes maps the sql_variant base type byte to the base type.
+// The base type bytes are the same as the TDS type identifiers.
+var variantTypes = map[byte]variantType{
+	0x24: {UniqueIdentifier, "uniqueidentifier", readUniqueIdentifier},
+	0x28: {Date, "date", readDate},
+	0x29: {Time, "time", readTime},
+	0x2a: {Datetime2, "datetime2", readDatetime2},
+	0x30: {TinyInt, "tinyint", readInteger},
+	0x32: {Bit, "bit", readBit},
+	0x34: {SmallInt, "smallint", readInteger},
+	0x38: {Int, "int", readInteger},
+	0x3a: {SmallDatetime, "smalldatetime", readSmallDatetime},
+	0x3b: {Real, "real", readReal},
+	0x3c: {Money, "money", readMoney},
+	0x3d: {Datetime, "datetime", readDatetime},
+	0x3e: {Float, "float", readFloat},
+	0x6a: {Decimal, "decimal", readDecimal},
+	0x6c: {Numeric, "numeric", readDecimal},
+	0x7a: {SmallMoney, "smallmoney", readSmallMoney},
+	0x7f: {BigInt, "bigint", readInteger},
+	0xa5: {Varbinary, "varbinary", nil},
+	0xa7: {Varchar, "varchar", nil},
+	0xad: {Binary, "binary", nil},
+	0xaf: {Char, "char", nil},
+	0xe7: {NVarchar, "nvarchar", nil},
+	0xef: {NChar, "nchar", nil},
+}
+
+// readSQLVariant reads the value for a sql_variant column.
+//
+// Note 1. The value is stored as a base type byte, a property length
+// byte, the type specific properties (if any) and then the value
+// itself. The properties are:
+//
+//	decimal, numeric           -> precision, scale
+//	time, datetime2            -> scale
+//	binary, varbinary          -> max length (2 bytes)
+//	char, varchar, nchar, ...  -> collation (5 bytes), max length (2 bytes)
+//
+// Note 2. The value of a non-unicode string is stored using the single
+// byte code page of the collation rather than as UTF-16.
+//
+// Note 3. The size prefix is 8 bytes, the prefix length documented for
+// sql_variant in the bcp native format ("Specify Prefix Length in Data
+// Files by Using bcp"). This has yet to be checked against the data
+// from an exported bacpac.
+func readSQLVariant(r *tReader, tc TableColumn) (ec ExtractedColumn, err error) {
+
+	fn := "readSQLVariant"
+	if debugFlag {
+		debOut(fmt.Sprintf("Func %s", fn))
+	}
+
+	// Determine how many bytes to read
+	var ss storedSize
+	ss, err = r.readStoredSize(tc, 8, 0)
+	if err != nil {
+		return
+	}
+
+	// Check for nulls
+	if ss.isNull || ss.byteCount == 0 {
+		ec.IsNull = true
+		return
+	}
+
+	var b []byte
+	b, err = r.readBytes(fn, ss.byteCount)
+	if err != nil {
+		return
+	}
+
+	if len(b) < 2 || len(b) < 2+int(b[1]) {
+		err = fmt.Errorf("%s invalid byteCount (%d) for column %q", fn, ss.byteCount, tc.ColName)
+		return
+	}
+
+	baseType := b[0]
+	props := b[2 : 2+int(b[1])]
+	value := b[2+int(b[1]):]
+
+	vt, ok := variantTypes[baseType]
+	if !ok {
+		err = fmt.Errorf("%s unsupported base type (0x%02x) for column %q", fn, baseType, tc.ColName)
+		return
+	}
+
+	if debugFlag {
+		debOut(fmt.Sprintf("%s: base type %s", fn, vt.dtStr))
+	}
+
+	ec.VariantType = vt.dtStr
+
+	// The not-null base type "column" to parse the value as
+	vc := TableColumn{
+		ColName:  tc.ColName,
+		DataType: vt.dataType,
+		DtStr:    vt.dtStr,
+	}
+
+	switch vt.dataType {
+	case Binary, Varbinary:
+		ec.Str = hex.EncodeToString(value)
+		return
+	case Char, Varchar:
+		// The properties are the 5 byte collation and the max length
+		ec.Str, err = decodeCodePage(value, collationBytesToCodePage(props))
+		if err != nil {
+			err = fmt.Errorf("%s %s for column %q", fn, err, tc.ColName)
+		}
+		return
+	case NChar, NVarchar:
+		ec.Str, err = utf16ToString(value)
+		if err != nil {
+			err = fmt.Errorf("%s %s for column %q", fn, err, tc.ColName)
+		}
+		return
+	case Decimal, Numeric:
+		if len(props) < 2 {
+			err = fmt.Errorf("%s missing precision and scale for column %q", fn, tc.ColName)
+			return
+		}
+		vc.Precision = int(props[0])
+		vc.Scale = int(props[1])
+
+		// The decimal decoder expects the size byte, precision, and
+		// scale to preceed the sign and value bytes
+		stream := []byte{byte(len(props) + len(value))}
+		stream = append(stream, props...)
+		value = append(stream, value...)
+	case Time, Datetime2:
+		if len(props) < 1 {
+			err = fmt.Errorf("%s missing scale for column %q", fn, tc.ColName)
+			return
+		}
+		vc.Scale = int(props[0])
+	case Float:
+		vc.Precision = 53
+	}
+
+	var vec ExtractedColumn
+	vec, err = vt.fcn(variantReader(value), vc)
+	if err == io.EOF {
+		err = fmt.Errorf("%s truncated %s value for column %q", fn, vt.dtStr, tc.ColName)
+	}
+	if err != nil {
+		return
+	}
+
+	ec.Str = vec.Str
+	return
+}
+
+// variantReader returns a tReader for reading the value bytes of a
+// sql_variant with the base type decoders
+func variantReader(b []byte) *tReader {
+	mr := buffFileReader{
+		buff: b,
+		bct:  len(b),
+		err:  io.EOF,
+	}
+	return &tReader{reader: &mr}
+}
@@ -0,0 +1,122 @@
+package bactract
+
+import (
+	"testing"
+)
+
+// variantBytes returns the stored form of a sql_variant value: the 8
+// byte size, the base type, the property length, the properties, and
+// the value
+func variantBytes(baseType byte, props, value []byte) []byte {
+	n := 2 + len(props) + len(value)
+	b := []byte{byte(n), byte(n >> 8), byte(n >> 16), byte(n >> 24), 0, 0, 0, 0, baseType, byte(len(props))}
+	b = append(b, props...)
+	return append(b, value...)
+}
+
+func TestReadSQLVariant(t *testing.T) {
+
+	// SQL_Latin1_General_CP1_CI_AS (sort ID 52, code page 1252) and
+	// Cyrillic_General_CI_AS (LCID 0x0419, code page 1251), each
+	// followed by the max length
+	latin1 := []byte{0x09, 0x04, 0xd0, 0x00, 0x34, 0x0a, 0x00}
+	cyrillic := []byte{0x19, 0x04, 0xd0, 0x00, 0x00, 0x0a, 0x00}
+
+	tests := []struct {
+		name        string
+		b           []byte
+		variantType string
+		want        string
+	}{
+		{"int", variantBytes(0x38, nil, []byte{0x2a, 0x00, 0x00, 0x00}), "int", "42"},
+		{"negative bigint", variantBytes(0x7f, nil, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}), "bigint", "-1"},
+		{"smallint", variantBytes(0x34, nil, []byte{0x39, 0x30}), "smallint", "12345"},
+		{"bit", variantBytes(0x32, nil, []byte{0x01}), "bit", "1"},
+		{"decimal(5,2)", variantBytes(0x6a, []byte{0x05, 0x02}, []byte{0x01, 0x39, 0x30, 0x00, 0x00}), "decimal", "123.45"},
+		{"negative numeric(5,2)", variantBytes(0x6c, []byte{0x05, 0x02}, []byte{0x00, 0x39, 0x30, 0x00, 0x00}), "numeric", "-123.45"},
+		{"date", variantBytes(0x28, nil, []byte{0x90, 0x40, 0x0b}), "date", "2020-01-01"},
+		{"varbinary", variantBytes(0xa5, []byte{0x08, 0x00}, []byte{0xde, 0xad, 0xbe, 0xef}), "varbinary", "deadbeef"},
+		{"nvarchar", variantBytes(0xe7, latin1, []byte{0x68, 0x00, 0xe9, 0x00}), "nvarchar", "hé"},
+		{"varchar cp1252", variantBytes(0xa7, latin1, []byte{0x63, 0x61, 0x66, 0xe9}), "varchar", "café"},
+		{"varchar cp1251", variantBytes(0xa7, cyrillic, []byte{0xe9}), "varchar", "й"},
+	}
+
+	tc := TableColumn{ColName: "v", DataType: SQLVariant, DtStr: "sql_variant", IsNullable: true}
+
+	for _, tt := range tests {
+		ec, err := readSQLVariant(variantReader(tt.b), tc)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+		if ec.IsNull {
+			t.Errorf("%s: unexpected null", tt.name)
+		}
+		if ec.VariantType != tt.variantType {
+			t.Errorf("%s: variant type is %q, want %q", tt.name, ec.VariantType, tt.variantType)
+		}
+		if ec.Str != tt.want {
+			t.Errorf("%s: value is %q, want %q", tt.name, ec.Str, tt.want)
+		}
+	}
+}
+
+func TestReadSQLVariantNull(t *testing.T) {
+
+	tc := TableColumn{ColName: "v", DataType: SQLVariant, DtStr: "sql_variant", IsNullable: true}
+
+	ec, err := readSQLVariant(variantReader([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}), tc)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !ec.IsNull {
+		t.Errorf("value is %q, want null", ec.Str)
+	}
+}
+
+func TestReadSQLVariantErrors(t *testing.T) {
+
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{"unsupported base type", variantBytes(0x99, nil, []byte{0x01})},
+		{"truncated int", variantBytes(0x38, nil, []byte{0x2a, 0x00})},
+		{"missing decimal properties", variantBytes(0x6a, nil, []byte{0x01, 0x39, 0x30, 0x00, 0x00})},
+		{"property length too long", []byte{0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x38, 0x05}},
+	}
+
+	tc := TableColumn{ColName: "v", DataType: SQLVariant, DtStr: "sql_variant", IsNullable: true}
+
+	for _, tt := range tests {
+		if _, err := readSQLVariant(variantReader(tt.b), tc); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestTypedJSON(t *testing.T) {
+
+	tests := []struct {
+		ec   ExtractedColumn
+		want string
+	}{
+		{ExtractedColumn{DtStr: "sql_variant", VariantType: "int", Str: "42"}, `{"type":"int","value":42}`},
+		{ExtractedColumn{DtStr: "sql_variant", VariantType: "decimal", Str: "123."}, `{"type":"decimal","value":123}`},
+		{ExtractedColumn{DtStr: "sql_variant", VariantType: "float", Str: "NaN"}, `{"type":"float","value":"NaN"}`},
+		{ExtractedColumn{DtStr: "sql_variant", VariantType: "nvarchar", Str: "a \"b\""}, `{"type":"nvarchar","value":"a \"b\""}`},
+		{ExtractedColumn{DtStr: "sql_variant", VariantType: "int", IsNull: true}, `{"type":"int","value":null}`},
+		{ExtractedColumn{DtStr: "varbinary", LobFile: "x.bin"}, `{"type":"varbinary","file":"x.bin"}`},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.ec.TypedJSON()
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", tt.ec.Str, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.ec.Str, got, tt.want)
+		}
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"fmt"
 )
 
-// readString reads the value for a string {char, text, varchar} column
+// readString reads the value for a string {char, nchar, text, varchar} column
 func readString(r *tReader, tc TableColumn) (ec ExtractedColumn, err error) {
 
 	fn := "readString"
@@ -18,7 +18,7 @@ func readString(r *tReader, tc TableColumn) (ec ExtractedColumn, err error) {
 	switch tc.DataType {
 	case Text:
 		sz = 4
-	case Char:
+	case Char, NChar:
 		defSz = tc.Length * 2
 	case Varchar:
 		// If the size is not specified then it appears to be up to maxsize?
@@ -42,7 +42,7 @@ func readString(r *tReader, tc TableColumn) (ec ExtractedColumn, err error) {
 	}
 
 	// Check the stored size vs. the column size
-	if tc.DataType == Char || tc.DataType == Varchar {
+	if tc.DataType == Char || tc.DataType == NChar || tc.DataType == Varchar {
 		if tc.Length > 0 && ss.byteCount > tc.Length*2 {
 			err = fmt.Errorf("%s byteCount too large for column %q (%d vs %d)", fn, tc.ColName, ss.byteCount, tc.Length*2)
 			return
@@ -55,6 +55,12 @@ func readString(r *tReader, tc TableColumn) (ec ExtractedColumn, err error) {
 		return
 	}
 
+	// Stream large values
+	if r.isStreamed(tc, ss.byteCount) {
+		ec.LobFile, err = r.streamLob(fn, tc, ss.byteCount, lobPaddedText)
+		return
+	}
+
 	// Read the chars
 	var b []byte
 	b, err = r.readBytes(fn, ss.byteCount)
@@ -69,7 +75,7 @@ func readString(r *tReader, tc TableColumn) (ec ExtractedColumn, err error) {
 	// probably safe to assume that this is a case of "not null char
 	// with size bytes". 9 bytes because the first printable character
 	// is the tab -- chr (9)
-	if tc.DataType == Char && !tc.IsNullable && ss.byteCount < 18 {
+	if (tc.DataType == Char || tc.DataType == NChar) && !tc.IsNullable && ss.byteCount < 18 {
 		var z int16
 		for i, sb := range stripTrailingNulls(b[0:2]) {
 			z |= int16(sb) << uint(8*i)
@@ -112,6 +118,9 @@ func readString(r *tReader, tc TableColumn) (ec ExtractedColumn, err error) {
 		}
 	}
 
-	ec.Str = string(toRunes(b))
+	ec.Str, err = utf16ToString(b)
+	if err != nil {
+		err = fmt.Errorf("%s %s for column %q", fn, err, tc.ColName)
+	}
 	return
 }
@@ -0,0 +1,97 @@
+package bactract
+
+import (
+	"testing"
+)
+
+func TestUTF16ToString(t *testing.T) {
+
+	saved := surrogatePolicy
+	defer func() { surrogatePolicy = saved }()
+
+	// "a", U+1F600 (as the surrogate pair D83D DE00), "b"
+	pair := []byte{0x61, 0x00, 0x3d, 0xd8, 0x00, 0xde, 0x62, 0x00}
+	// "a", an unpaired high surrogate, "b"
+	loneHigh := []byte{0x61, 0x00, 0x3d, 0xd8, 0x62, 0x00}
+	// "a", an unpaired low surrogate, "b"
+	loneLow := []byte{0x61, 0x00, 0x00, 0xde, 0x62, 0x00}
+	// "a", a trailing high surrogate
+	trailingHigh := []byte{0x61, 0x00, 0x3d, 0xd8}
+	// two high surrogates followed by a low surrogate
+	highHighLow := []byte{0x3d, 0xd8, 0x3d, 0xd8, 0x00, 0xde}
+
+	tests := []struct {
+		name   string
+		policy int
+		b      []byte
+		want   string
+	}{
+		{"pair", SurrogateReplace, pair, "a\U0001F600b"},
+		{"pair", SurrogateDrop, pair, "a\U0001F600b"},
+		{"pair", SurrogateError, pair, "a\U0001F600b"},
+		{"BMP", SurrogateError, []byte{0xe9, 0x00, 0x16, 0x04}, "éЖ"},
+		{"lone high replaced", SurrogateReplace, loneHigh, "a\ufffdb"},
+		{"lone high dropped", SurrogateDrop, loneHigh, "ab"},
+		{"lone low replaced", SurrogateReplace, loneLow, "a\ufffdb"},
+		{"lone low dropped", SurrogateDrop, loneLow, "ab"},
+		{"trailing high replaced", SurrogateReplace, trailingHigh, "a\ufffd"},
+		{"trailing high dropped", SurrogateDrop, trailingHigh, "a"},
+		{"high high low replaced", SurrogateReplace, highHighLow, "\ufffd\U0001F600"},
+		{"high high low dropped", SurrogateDrop, highHighLow, "\U0001F600"},
+	}
+
+	for _, tt := range tests {
+		surrogatePolicy = tt.policy
+		got, err := utf16ToString(tt.b)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	surrogatePolicy = SurrogateError
+	for _, b := range [][]byte{loneHigh, loneLow, trailingHigh, highHighLow} {
+		if got, err := utf16ToString(b); err == nil {
+			t.Errorf("% x: expected an error, got %q", b, got)
+		}
+	}
+}
+
+func TestReadNCharAndNVarchar(t *testing.T) {
+
+	// nchar(3) is stored as 6 bytes of UTF-16 (no size for not null
+	// columns), nvarchar(10) as a 2 byte size followed by the UTF-16
+	tests := []struct {
+		name string
+		tc   TableColumn
+		b    []byte
+		want string
+	}{
+		{"nchar", TableColumn{ColName: "c", DataType: NChar, DtStr: "nchar", Length: 3},
+			[]byte{0x61, 0x00, 0x62, 0x00, 0x20, 0x00}, "ab "},
+		{"nullable nchar", TableColumn{ColName: "c", DataType: NChar, DtStr: "nchar", Length: 3, IsNullable: true},
+			[]byte{0x06, 0x00, 0x16, 0x04, 0x3d, 0xd8, 0x00, 0xde}, "Ж\U0001F600"},
+		{"nvarchar", TableColumn{ColName: "c", DataType: NVarchar, DtStr: "nvarchar", Length: 10},
+			[]byte{0x06, 0x00, 0x3d, 0xd8, 0x00, 0xde, 0x21, 0x00}, "\U0001F600!"},
+		{"nvarchar(max)", TableColumn{ColName: "c", DataType: NVarchar, DtStr: "nvarchar"},
+			nvarcharMaxBytes("café \U0001F600"), "café \U0001F600"},
+	}
+
+	for _, tt := range tests {
+		read := readString
+		if tt.tc.DataType == NVarchar {
+			read = readNVarchar
+		}
+		ec, err := read(variantReader(tt.b), tt.tc)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+		if ec.Str != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, ec.Str, tt.want)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package bactract
 // Read/parse the bacpac BCP data files.
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -12,22 +13,30 @@ import (
 )
 
 type tReader struct {
-	reader *buffFileReader
-	//Rownum int
-	table Table
+	reader         *buffFileReader
+	rownum         uint64
+	table          Table
+	lobThreshold   int              // the size above which large values are streamed
+	lobWriter      LobWriterFunc    // the source of writers to stream large values to
+	identityValues map[string]int64 // the high-water values of the identity columns
+	identityErrs   map[string]bool  // the identity columns having values that could not be tracked
+	history        *tReader         // the reader for the history data, when combining temporal tables
+	inHistory      bool             // the table data has been read and the history data is being read
 }
 
 // ExtractedColumn contains the data/metadata for a column extracted from a row of data.
 type ExtractedColumn struct {
-	ColName    string
-	DataType   int
-	DtStr      string
-	Length     int
-	Scale      int
-	Precision  int
-	IsNullable bool
-	IsNull     bool
-	Str        string
+	ColName     string
+	DataType    int
+	DtStr       string
+	Length      int
+	Scale       int
+	Precision   int
+	IsNullable  bool
+	IsNull      bool
+	Str         string
+	VariantType string // the effective base type for sql_variant columns
+	LobFile     string // the file (or reference) that a streamed large value was written to
 }
 
 type storedSize struct {
@@ -49,23 +58,99 @@ var dt = map[int]fn{
 	Decimal:          readDecimal,
 	Float:            readFloat,
 	Geography:        readGeography,
+	HierarchyID:      readHierarchyID,
+	Image:            readImage,
 	Int:              readInteger,
 	Money:            readMoney,
+	NChar:            readString,
 	NText:            readNText,
 	Numeric:          readDecimal,
 	NVarchar:         readNVarchar,
 	Real:             readReal,
+	Rowversion:       readRowversion,
 	SmallDatetime:    readSmallDatetime,
 	SmallInt:         readInteger,
 	SmallMoney:       readSmallMoney,
+	SQLVariant:       readSQLVariant,
 	Text:             readString,
 	Time:             readTime,
 	TinyInt:          readInteger,
 	UniqueIdentifier: readUniqueIdentifier,
 	Varbinary:        readVarbinary,
 	Varchar:          readString,
-	//NChar:            readNChar,
-	//SQLVariant:       readSQLVariant,
+	Xml:              readXml,
+}
+
+// TypedJSON returns the extracted value as a JSON object containing
+// the (effective base) type and value of the column, such as
+// {"type":"int","value":5}. Numeric values are output as JSON numbers
+// (falling back to JSON strings for values that are not valid JSON
+// numbers) and all others as JSON strings. Streamed large values are
+// output as {"type":"varbinary","file":"<LobFile>"}.
+func (ec ExtractedColumn) TypedJSON() (s string, err error) {
+
+	dtStr := ec.DtStr
+	dataType := ec.DataType
+	if ec.VariantType != "" {
+		dtStr = ec.VariantType
+		dataType = dtMap[dtStr]
+	}
+
+	if ec.LobFile != "" {
+		tf := struct {
+			Type string `json:"type"`
+			File string `json:"file"`
+		}{dtStr, ec.LobFile}
+
+		b, err := json.Marshal(tf)
+		return string(b), err
+	}
+
+	var value []byte
+	switch {
+	case ec.IsNull:
+		value = []byte("null")
+	case isNumeric(dataType) && ec.Str != "":
+		// decimal and numeric values with a scale of 0 have a trailing
+		// decimal point
+		value = []byte(strings.TrimSuffix(ec.Str, "."))
+		if !json.Valid(value) {
+			value, err = json.Marshal(ec.Str)
+		}
+	default:
+		value, err = json.Marshal(ec.Str)
+	}
+	if err != nil {
+		return s, err
+	}
+
+	tv := struct {
+		Type  string          `json:"type"`
+		Value json.RawMessage `json:"value"`
+	}{dtStr, value}
+
+	b, err := json.Marshal(tv)
+	return string(b), err
+}
+
+// isNumeric returns true for those datatypes that have numeric values
+func isNumeric(dataType int) bool {
+	switch dataType {
+	case BigInt, Bit, Decimal, Float, Int, Money, Numeric, Real, SmallInt, SmallMoney, TinyInt:
+		return true
+	}
+	return false
+}
+
+// IsInBCP returns true for those columns that have data in the BCP
+// files. Computed columns, FILESTREAM columns, and column sets are not
+// exported. NB that persisted computed columns are excluded on the basis
+// that the bacpac import bulk loads the BCP data and SQL Server does not
+// accept values for computed columns, persisted or not, so the export
+// cannot include them. This has not been checked against a bacpac with
+// persisted computed columns.
+func (c TableColumn) IsInBCP() bool {
+	return !c.IsComputed && !c.IsFileStream && !c.IsColumnSet
 }
 
 // DataReader creates a multi-file-reader on the data files for the specified table
@@ -90,14 +175,46 @@ func (t *Table) DataReader() (reader tReader, err error) {
 	reader.reader = BuffFileReader(0, bcpFiles)
 	reader.table = *t
 
+	if historyMode == HistoryCombine && t.history != nil {
+		err = reader.appendHistory(t.history)
+	}
+
 	return reader, err
 }
 
 // ReadNextRow reads the next table row from the BCP file and ...
 func (r *tReader) ReadNextRow() (row []ExtractedColumn, err error) {
 
+	if !r.inHistory {
+		row, err = r.readRow()
+		if err != io.EOF || r.history == nil {
+			return row, err
+		}
+		r.inHistory = true
+		r.history.lobThreshold = r.lobThreshold
+		r.history.lobWriter = r.lobWriter
+		// The history rows continue the row numbering of the table so
+		// that the large value files (named by row number) of the
+		// history rows do not overwrite those of the table rows
+		r.history.rownum = r.rownum - 1
+	}
+
+	return r.readHistoryRow()
+}
+
+// readRow reads the next table row from the BCP file
+func (r *tReader) readRow() (row []ExtractedColumn, err error) {
+
+	r.rownum++
+
 	for _, tc := range r.table.Columns {
 
+		// Computed columns, persisted or not, are not exported (nor
+		// are FILESTREAM columns or column sets)
+		if !tc.IsInBCP() {
+			continue
+		}
+
 		if debugFlag {
 			debOut(fmt.Sprintf("%q %s %d, %d, %d, %v", tc.ColName, tc.DtStr, tc.Length, tc.Precision, tc.Scale, tc.IsNullable))
 		}
@@ -130,6 +247,8 @@ func (r *tReader) ReadNextRow() (row []ExtractedColumn, err error) {
 			ec.IsNullable = tc.IsNullable
 			ec.DtStr = tc.DtStr
 
+			r.trackIdentity(tc, ec)
+
 			if debugFlag {
 				if len(ec.Str) > debugLen && debugLen > 10 {
 					s := fmt.Sprintf("%s ... %s", ec.Str[0:debugLen-6], ec.Str[len(ec.Str)-4:])
@@ -142,6 +261,9 @@ func (r *tReader) ReadNextRow() (row []ExtractedColumn, err error) {
 			}
 
 			row = append(row, ec)
+		} else if tc.IsClrType {
+			err = fmt.Errorf("Column %q is of the CLR type %s, which cannot be extracted", tc.ColName, tc.DtStr)
+			return row, err
 		} else {
 			err = fmt.Errorf("No parser defined for column %q (datatype %s)", tc.ColName, tc.DtStr)
 			return row, err
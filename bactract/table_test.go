@@ -0,0 +1,60 @@
+package bactract
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadRowSkipsComputedColumns(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "bactract")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The BCP data only has the Id and Doc columns, the (persisted)
+	// computed columns are not in the data
+	var b []byte
+	b = append(b, 0x2a, 0x00, 0x00, 0x00)
+	b = append(b, nvarcharMaxBytes("first")...)
+	b = append(b, 0x2b, 0x00, 0x00, 0x00)
+	b = append(b, nvarcharMaxBytes("second")...)
+	if err := ioutil.WriteFile(filepath.Join(dir, "TableData-000-00001.BCP"), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tab := Table{DataDir: dir, Schema: "dbo", TabName: "T", Columns: []TableColumn{
+		{ColName: "Id", DataType: Int, DtStr: "int"},
+		{ColName: "Twice", DataType: Int, DtStr: "int", IsComputed: true, IsPersisted: true, Expression: "([Id]*(2))"},
+		{ColName: "Doc", DataType: NVarchar, DtStr: "nvarchar"},
+		{ColName: "DocLen", DataType: Int, DtStr: "int", IsComputed: true, Expression: "(len([Doc]))"},
+	}}
+
+	r, err := tab.DataReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{{"42", "first"}, {"43", "second"}}
+	for i, w := range want {
+		row, err := r.ReadNextRow()
+		if err != nil {
+			t.Fatalf("row %d: unexpected error: %s", i+1, err)
+		}
+		if len(row) != len(w) {
+			t.Fatalf("row %d: got %d columns, want %d", i+1, len(row), len(w))
+		}
+		for j := range w {
+			if row[j].Str != w[j] {
+				t.Errorf("row %d, column %s: got %q, want %q", i+1, row[j].ColName, row[j].Str, w[j])
+			}
+		}
+	}
+
+	if _, err := r.ReadNextRow(); err == nil {
+		t.Errorf("expected the end of the data after %d rows", len(want))
+	}
+}
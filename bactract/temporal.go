@@ -0,0 +1,92 @@
+package bactract
+
+// Support for temporal (system-versioned) tables and their history tables
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// LookupHistoryMode returns the history table extraction mode for a
+// name (include, exclude, or combine)
+func LookupHistoryMode(name string) (m int, err error) {
+
+	switch strings.ToLower(name) {
+	case "", "include":
+		return HistoryInclude, err
+	case "exclude":
+		return HistoryExclude, err
+	case "combine":
+		return HistoryCombine, err
+	}
+	return m, fmt.Errorf("unsupported history mode %q", name)
+}
+
+// IsExtracted returns false for those tables whose data is not extracted
+// as a table of its own. History tables are not extracted when the
+// history mode is HistoryExclude, or HistoryCombine (as the history data
+// is appended to the data for the temporal table).
+func (t Table) IsExtracted() bool {
+	return !t.IsHistoryTable || historyMode == HistoryInclude
+}
+
+// appendHistory chains the data reader for a history table to the
+// reader for the temporal table. A history table without exported data
+// is quietly ignored.
+func (r *tReader) appendHistory(h *Table) error {
+
+	if _, err := os.Stat(h.DataDir); os.IsNotExist(err) {
+		return nil
+	}
+
+	hr, err := h.DataReader()
+	if err != nil {
+		return err
+	}
+	r.history = &hr
+	return nil
+}
+
+// readHistoryRow reads the next row from the history table and maps the
+// columns, by name, to the columns of the temporal table. Columns that
+// are not in the history table are returned as null.
+func (r *tReader) readHistoryRow() (row []ExtractedColumn, err error) {
+
+	hrow, err := r.history.ReadNextRow()
+	if err != nil {
+		if err != io.EOF {
+			err = fmt.Errorf("history table %s.%s: %s", r.history.table.Schema, r.history.table.TabName, err)
+		}
+		return row, err
+	}
+
+	values := make(map[string]ExtractedColumn)
+	for _, ec := range hrow {
+		values[strings.ToLower(ec.ColName)] = ec
+	}
+
+	for _, tc := range r.table.Columns {
+		if !tc.IsInBCP() {
+			continue
+		}
+
+		ec, ok := values[strings.ToLower(tc.ColName)]
+		if !ok {
+			ec = ExtractedColumn{IsNull: true}
+		}
+
+		ec.ColName = tc.ColName
+		ec.DataType = tc.DataType
+		ec.Length = tc.Length
+		ec.Scale = tc.Scale
+		ec.Precision = tc.Precision
+		ec.IsNullable = tc.IsNullable
+		ec.DtStr = tc.DtStr
+
+		row = append(row, ec)
+	}
+
+	return row, nil
+}
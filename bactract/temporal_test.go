@@ -0,0 +1,104 @@
+package bactract
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+)
+
+// nvarcharMaxBytes returns the stored form of a not null nvarchar(max)
+// value: the 8 byte size followed by the UTF-16 characters
+func nvarcharMaxBytes(s string) []byte {
+	var v []byte
+	for _, c := range utf16.Encode([]rune(s)) {
+		v = append(v, byte(c), byte(c>>8))
+	}
+	n := len(v)
+	b := []byte{byte(n), byte(n >> 8), byte(n >> 16), byte(n >> 24), 0, 0, 0, 0}
+	return append(b, v...)
+}
+
+// writeBCP writes the rows of a single not null nvarchar(max) column to
+// a BCP file in dir
+func writeBCP(t *testing.T, dir string, values ...string) {
+	var b []byte
+	for _, v := range values {
+		b = append(b, nvarcharMaxBytes(v)...)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "TableData-000-00001.BCP"), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCombinedHistoryLobFiles(t *testing.T) {
+
+	saved := historyMode
+	historyMode = HistoryCombine
+	defer func() { historyMode = saved }()
+
+	base, err := ioutil.TempDir("", "bactract")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+
+	cols := []TableColumn{{ColName: "Doc", DataType: NVarchar, DtStr: "nvarchar"}}
+
+	hist := Table{DataDir: filepath.Join(base, "dbo.DocHist"), Schema: "dbo", TabName: "DocHist", Columns: cols, IsHistoryTable: true}
+	tab := Table{DataDir: filepath.Join(base, "dbo.Doc"), Schema: "dbo", TabName: "Doc", Columns: cols, history: &hist}
+
+	writeBCP(t, tab.DataDir, "current 1", "current 2")
+	writeBCP(t, hist.DataDir, "history 1", "history 2", "history 3")
+
+	lobDir := filepath.Join(base, "lobs")
+	if err := os.MkdirAll(lobDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := tab.DataReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetLobFiles(0, lobDir)
+
+	want := []string{"current 1", "current 2", "history 1", "history 2", "history 3"}
+	files := make(map[string]bool)
+	var refs []string
+
+	for {
+		row, err := r.ReadNextRow()
+		if err != nil {
+			break
+		}
+		if len(row) != 1 || row[0].LobFile == "" {
+			t.Fatalf("row %d: expected a streamed value, got %+v", len(refs)+1, row)
+		}
+		if files[row[0].LobFile] {
+			t.Errorf("row %d: the file %s is used by more than one row", len(refs)+1, row[0].LobFile)
+		}
+		files[row[0].LobFile] = true
+		refs = append(refs, row[0].LobFile)
+	}
+
+	if len(refs) != len(want) {
+		t.Fatalf("read %d rows, want %d", len(refs), len(want))
+	}
+
+	// Check the file contents once all rows have been read so that any
+	// overwritten files are caught
+	for i, ref := range refs {
+		b, err := ioutil.ReadFile(ref)
+		if err != nil {
+			t.Errorf("row %d: %s", i+1, err)
+			continue
+		}
+		if string(b) != want[i] {
+			t.Errorf("row %d: the file %s contains %q, want %q", i+1, ref, string(b), want[i])
+		}
+	}
+}
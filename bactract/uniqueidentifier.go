@@ -4,6 +4,7 @@ package bactract
 //uniqueidentifier
 
 import (
+	"encoding/hex"
 	"fmt"
 	"strings"
 )
@@ -44,39 +45,7 @@ func readUniqueIdentifier(r *tReader, tc TableColumn) (ec ExtractedColumn, err e
 		return
 	}
 
-	var s []string
-	var z1 int64
-	for i, sb := range b[0:4] {
-		z1 |= int64(sb) << uint(8*i)
-	}
-	s = append(s, fmt.Sprintf("%08X", z1))
-
-	var z2 int64
-	for i, sb := range b[4:6] {
-		z2 |= int64(sb) << uint(8*i)
-	}
-	s = append(s, fmt.Sprintf("%04X", z2))
-
-	var z3 int64
-	for i, sb := range b[6:8] {
-		z3 |= int64(sb) << uint(8*i)
-	}
-	s = append(s, fmt.Sprintf("%04X", z3))
-
-	var z4 []string
-	for _, sb := range b[8:10] {
-		z4 = append(z4, fmt.Sprintf("%02X", sb))
-	}
-	s = append(s, strings.Join(z4, ""))
-
-	var z5 []string
-	for _, sb := range b[10:] {
-		z5 = append(z5, fmt.Sprintf("%02X", sb))
-	}
-	s = append(s, strings.Join(z5, ""))
-
-	//ec.Str = strings.Join(s, "-")
-	ec.Str = strings.Join(s, "")
+	ec.Str = formatGUID(b, guidFormat)
 
 	/*
 	   https://bornsql.ca/blog/how-sql-server-stores-data-types-guid/
@@ -97,3 +66,60 @@ func readUniqueIdentifier(r *tReader, tc TableColumn) (ec ExtractedColumn, err e
 
 	return
 }
+
+// LookupGUIDFormat returns the uniqueidentifier output format for a
+// comma separated list of options (upper, nodash, braces, raw). An
+// empty list (or "canonical") is the lowercase 8-4-4-4-12 form.
+func LookupGUIDFormat(opts string) (f int, err error) {
+
+	for _, opt := range strings.Split(opts, ",") {
+		switch strings.ToLower(strings.TrimSpace(opt)) {
+		case "", "canonical", "lower":
+		case "upper":
+			f |= GUIDUpper
+		case "nodash", "nodashes":
+			f |= GUIDNoDashes
+		case "braces":
+			f |= GUIDBraces
+		case "raw":
+			f |= GUIDRaw
+		default:
+			return f, fmt.Errorf("unsupported uniqueidentifier format option %q", opt)
+		}
+	}
+	return f, err
+}
+
+// formatGUID translates the 16 stored GUID bytes to a string. The first
+// three segments are stored little-endian and are reversed unless the
+// raw (as stored) bytes are requested.
+func formatGUID(b []byte, f int) string {
+
+	var s string
+	if f&GUIDRaw != 0 {
+		s = hex.EncodeToString(b)
+	} else {
+		u := []byte{
+			b[3], b[2], b[1], b[0],
+			b[5], b[4],
+			b[7], b[6],
+		}
+		u = append(u, b[8:16]...)
+
+		h := hex.EncodeToString(u)
+		sep := "-"
+		if f&GUIDNoDashes != 0 {
+			sep = ""
+		}
+		s = strings.Join([]string{h[0:8], h[8:12], h[12:16], h[16:20], h[20:]}, sep)
+
+		if f&GUIDBraces != 0 {
+			s = "{" + s + "}"
+		}
+	}
+
+	if f&GUIDUpper != 0 {
+		s = strings.ToUpper(s)
+	}
+	return s
+}
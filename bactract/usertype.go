@@ -0,0 +1,98 @@
+package bactract
+
+// Resolve the alias types and extract the table types and CLR types
+// from the model
+
+import (
+	"strings"
+)
+
+// TableType contains the definition for a user defined table type
+type TableType struct {
+	Schema  string
+	Name    string
+	Columns []TableColumn
+}
+
+// ClrType contains the definition for a (user defined) CLR type. The
+// values of CLR type columns cannot be extracted.
+type ClrType struct {
+	Schema    string
+	Name      string
+	Assembly  string
+	ClassName string
+}
+
+// resolveUserType resolves the base type of an alias type that is
+// defined on another alias type. The length, precision, and scale are
+// inherited when not specified and the type is not nullable when any
+// type in the chain is not nullable.
+func resolveUserType(name string, uts map[string]UserDefinedType, clrTypes map[string]ClrType, seen map[string]bool) UserDefinedType {
+
+	t := uts[name]
+	if _, ok := clrTypes[t.BaseType]; ok {
+		t.IsClrType = true
+		return t
+	}
+
+	if _, ok := uts[t.BaseType]; !ok || seen[name] {
+		return t
+	}
+	seen[name] = true
+
+	base := resolveUserType(t.BaseType, uts, clrTypes, seen)
+	t.DtStr = base.DtStr
+	t.DataType = base.DataType
+	t.IsClrType = base.IsClrType
+	if t.Length == 0 {
+		t.Length = base.Length
+	}
+	if t.Precision == 0 {
+		t.Precision = base.Precision
+		t.Scale = base.Scale
+	}
+	t.IsNullable = t.IsNullable && base.IsNullable
+	return t
+}
+
+// extractClrTypes extracts the (user defined) CLR types from the schema model
+func extractClrTypes(doc DataSchemaModel) (rt map[string]ClrType) {
+
+	// <Element Type="SqlUserDefinedType" Name="[dbo].[Point]">
+	//     <Property Name="ClassName" Value="Point" />
+	//     <Relationship Name="Assembly">
+	//         <Entry>
+	//             <References Name="[PointAssembly]" />
+	//         </Entry>
+	//     </Relationship>
+	// ...
+
+	rt = make(map[string]ClrType)
+
+	for _, element := range doc.Model.Element {
+		if element.Type != "SqlUserDefinedType" {
+			continue
+		}
+
+		var t ClrType
+		t.Schema = extractQNToken(element.Name, 0)
+		t.Name = extractQNToken(element.Name, 1)
+
+		for _, p := range element.Property {
+			if p.Name == "ClassName" {
+				t.ClassName = p.AttrValue
+			}
+		}
+		for _, r := range element.Relationship {
+			if r.Name != "Assembly" {
+				continue
+			}
+			for _, e := range r.Entry {
+				t.Assembly = normalizeQN(e.References.Name)
+			}
+		}
+
+		rt[strings.Join([]string{t.Schema, t.Name}, ".")] = t
+	}
+	return rt
+}
@@ -8,6 +8,8 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf16"
 )
 
 // toInt converts a byte array (string) of digits to its corresponding
@@ -41,20 +43,46 @@ func toInt(b []byte) (ret int, err error) {
 	return ret, nil
 }
 
-// toRunes translates a [character] byte slice to the corresponding rune slice
-func toRunes(b []byte) (ret []rune) {
+// utf16ToString translates a little-endian UTF-16 byte slice to the
+// corresponding string. Surrogate pairs are combined into the
+// corresponding supplementary-plane characters while unpaired
+// surrogates are handled as per the surrogatePolicy.
+func utf16ToString(b []byte) (ret string, err error) {
 
-	var j int
-	ret = make([]rune, len(b)/2)
-	for i := 0; i < len(b); i = i + 2 {
-		z := int32(b[i])
-		if b[i+1] != 0x00 {
-			z |= int32(b[i+1]) << uint(8)
+	var sb strings.Builder
+	sb.Grow(len(b) / 2)
+
+	for i := 0; i+1 < len(b); i = i + 2 {
+		r1 := rune(b[i]) | rune(b[i+1])<<8
+
+		if !utf16.IsSurrogate(r1) {
+			sb.WriteRune(r1)
+			continue
+		}
+
+		// A high surrogate followed by a low surrogate makes a pair
+		if r1 < 0xdc00 && i+3 < len(b) {
+			r2 := rune(b[i+2]) | rune(b[i+3])<<8
+			r := utf16.DecodeRune(r1, r2)
+			if r != unicode.ReplacementChar {
+				sb.WriteRune(r)
+				i = i + 2
+				continue
+			}
+		}
+
+		switch surrogatePolicy {
+		case SurrogateError:
+			err = fmt.Errorf("unpaired surrogate (0x%04x) at byte %d", r1, i)
+			return ret, err
+		case SurrogateDrop:
+			continue
+		default:
+			sb.WriteRune(unicode.ReplacementChar)
 		}
-		ret[j] = z
-		j++
 	}
-	return ret
+
+	return sb.String(), err
 }
 
 // stripTrailingNulls removes the null bytes from the end of a byte slice
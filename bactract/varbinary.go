@@ -23,6 +23,12 @@ func readVarbinary(r *tReader, tc TableColumn) (ec ExtractedColumn, err error) {
 		return
 	}
 
+	// Stream large values
+	if r.isStreamed(tc, ss.byteCount) {
+		ec.LobFile, err = r.streamLob(fn, tc, ss.byteCount, lobBinary)
+		return
+	}
+
 	// Read and translate the varbinary
 	// TODO
 	_, err = r.readBytes(fn, ss.byteCount)
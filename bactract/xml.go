@@ -0,0 +1,778 @@
+package bactract
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// Binary XML tokens (see [MS-BINXML]). The atomic value tokens are in
+// the 0x01 - 0x8c range.
+const (
+	bxNmFlush  = 0xe9 // flush the name and qname dictionaries
+	bxExtn     = 0xea // extension
+	bxEndNest  = 0xeb // end of nested document
+	bxNest     = 0xec // start of nested document
+	bxXMLText  = 0xed // text
+	bxQName    = 0xef // qname definition
+	bxName     = 0xf0 // name definition
+	bxCDataEnd = 0xf1 // end of CDATA section
+	bxCData    = 0xf2 // CDATA section
+	bxComment  = 0xf3 // comment
+	bxPI       = 0xf4 // processing instruction
+	bxEndAttrs = 0xf5 // end of attributes
+	bxAttr     = 0xf6 // attribute
+	bxEndElem  = 0xf7 // end of element
+	bxElement  = 0xf8 // element
+	bxEncoding = 0xfd // XML declaration encoding
+	bxXMLDecl  = 0xfe // XML declaration
+	bxDocType  = 0xb4 // document type declaration
+	bxSystem   = 0xb5 // document type system id
+	bxPublic   = 0xb6 // document type public id
+	bxSubset   = 0xb7 // document type internal subset
+)
+
+// binXMLAtom contains the information needed for parsing the fixed
+// length SQL atomic values found in binary XML using the column decoders
+type binXMLAtom struct {
+	dataType int
+	size     int
+	fcn      fn
+}
+
+var binXMLAtoms = map[byte]binXMLAtom{
+	0x01: {SmallInt, 2, readInteger},
+	0x02: {Int, 4, readInteger},
+	0x03: {Real, 4, readReal},
+	0x04: {Float, 8, readFloat},
+	0x05: {Money, 8, readMoney},
+	0x08: {BigInt, 8, readInteger},
+	0x09: {UniqueIdentifier, 16, readUniqueIdentifier},
+	0x12: {Datetime, 8, readDatetime},
+	0x13: {SmallDatetime, 4, readSmallDatetime},
+	0x14: {SmallMoney, 4, readSmallMoney},
+}
+
+// bxQNameDef is a binary XML qname definition
+type bxQNameDef struct {
+	nsURI  string
+	prefix string
+	local  string
+}
+
+func (q bxQNameDef) String() string {
+	if q.prefix != "" {
+		return q.prefix + ":" + q.local
+	}
+	return q.local
+}
+
+// binXMLParser translates the SQL Server binary XML format to text
+type binXMLParser struct {
+	b      []byte
+	pos    int
+	names  []string            // the name dictionary
+	qnames []bxQNameDef        // the qname dictionary
+	scopes []map[string]string // the in-scope namespace prefixes
+	elems  []string            // the currently open elements
+	sb     strings.Builder
+}
+
+var xmlTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+var xmlAttrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\"", "&quot;")
+
+// readXml reads the value for an xml column.
+//
+// Note 1. Depending on how the bacpac was exported the value is either
+// UTF-16 text or the SQL Server binary XML format. Binary XML starts
+// with 0xDF 0xFF, the version (1 or 2), and the UTF-16 code page (0xB0
+// 0x04) followed by the token stream.
+//
+// Note 2. I have no suitable bacpac for testing so the size bytes are
+// assumed to be the same as for the other (max) datatypes.
+func readXml(r *tReader, tc TableColumn) (ec ExtractedColumn, err error) {
+
+	fn := "readXml"
+	if debugFlag {
+		debOut(fmt.Sprintf("Func %s", fn))
+	}
+
+	// Determine how many bytes to read
+	var ss storedSize
+	ss, err = r.readStoredSize(tc, 8, 0)
+	if err != nil {
+		return
+	}
+
+	// Check for nulls
+	if ss.isNull {
+		ec.IsNull = ss.isNull
+		return
+	}
+
+	var b []byte
+	b, err = r.readBytes(fn, ss.byteCount)
+	if err != nil {
+		return
+	}
+
+	if isBinXML(b) {
+		if debugFlag {
+			debOut(fmt.Sprintf("%s: binary XML version %d", fn, b[2]))
+		}
+		p := binXMLParser{b: b, pos: 5}
+		ec.Str, err = p.parse()
+		if err != nil {
+			err = fmt.Errorf("%s %s for column %q", fn, err, tc.ColName)
+		}
+		return
+	}
+
+	// Strip any byte order mark
+	if len(b) > 1 && b[0] == 0xff && b[1] == 0xfe {
+		b = b[2:]
+	}
+
+	// Assert: The stored size is an even number of bytes?
+	if len(b)%2 != 0 {
+		err = fmt.Errorf("%s invalid byteCount (%d) for column %q", fn, ss.byteCount, tc.ColName)
+		return
+	}
+
+	ec.Str, err = utf16ToString(b)
+	if err != nil {
+		err = fmt.Errorf("%s %s for column %q", fn, err, tc.ColName)
+	}
+	return
+}
+
+// isBinXML checks for the binary XML signature, version, and code page
+func isBinXML(b []byte) bool {
+	if len(b) < 5 {
+		return false
+	}
+	if b[0] != 0xdf || b[1] != 0xff {
+		return false
+	}
+	if b[2] != 0x01 && b[2] != 0x02 {
+		return false
+	}
+	return b[3] == 0xb0 && b[4] == 0x04
+}
+
+// parse translates the binary XML token stream to text
+func (p *binXMLParser) parse() (s string, err error) {
+
+	p.resetNames()
+	p.scopes = append(p.scopes, map[string]string{"xml": "http://www.w3.org/XML/1998/namespace"})
+
+	for p.pos < len(p.b) {
+
+		tok := p.b[p.pos]
+		p.pos++
+
+		switch tok {
+		case bxXMLDecl:
+			err = p.xmlDecl()
+		case bxDocType:
+			err = p.docType()
+		case bxName:
+			var n string
+			n, err = p.readText()
+			p.names = append(p.names, n)
+		case bxQName:
+			err = p.qnameDef()
+		case bxNmFlush:
+			p.resetNames()
+		case bxExtn:
+			var n int
+			n, err = p.readMB32()
+			if err == nil {
+				_, err = p.readBytes(n)
+			}
+		case bxNest, bxEndNest:
+			// The tokens of nested documents continue to use the same
+			// dictionaries so there is nothing to do
+		case bxElement:
+			err = p.element()
+		case bxEndElem:
+			if len(p.elems) == 0 {
+				err = errors.New("unbalanced end element in binary XML")
+				break
+			}
+			p.sb.WriteString("</" + p.elems[len(p.elems)-1] + ">")
+			p.elems = p.elems[:len(p.elems)-1]
+			p.scopes = p.scopes[:len(p.scopes)-1]
+		case bxComment:
+			var t string
+			t, err = p.readText()
+			p.sb.WriteString("<!--" + t + "-->")
+		case bxPI:
+			err = p.processingInstruction()
+		case bxCData:
+			var t string
+			t, err = p.readText()
+			p.sb.WriteString("<![CDATA[" + t + "]]>")
+		case bxCDataEnd:
+			// The CDATA sections are closed as they are written
+		case bxXMLText:
+			var t string
+			t, err = p.readText()
+			p.sb.WriteString(xmlTextEscaper.Replace(t))
+		default:
+			if !isBinXMLValue(tok) {
+				err = fmt.Errorf("unknown binary XML token (0x%02x) at byte %d", tok, p.pos-1)
+				break
+			}
+			var t string
+			t, err = p.value(tok)
+			p.sb.WriteString(xmlTextEscaper.Replace(t))
+		}
+
+		if err != nil {
+			return s, err
+		}
+	}
+
+	if len(p.elems) > 0 {
+		return s, fmt.Errorf("unclosed element %q in binary XML", p.elems[len(p.elems)-1])
+	}
+
+	return p.sb.String(), err
+}
+
+// resetNames (re-)initializes the name and qname dictionaries. Entry 0
+// of each is the empty name.
+func (p *binXMLParser) resetNames() {
+	p.names = []string{""}
+	p.qnames = []bxQNameDef{{}}
+}
+
+// xmlDecl writes the XML declaration
+func (p *binXMLParser) xmlDecl() (err error) {
+
+	var version, encoding string
+	version, err = p.readText()
+	if err != nil {
+		return err
+	}
+
+	if p.peek() == bxEncoding {
+		p.pos++
+		encoding, err = p.readText()
+		if err != nil {
+			return err
+		}
+	}
+
+	var standalone byte
+	standalone, err = p.readByte()
+	if err != nil {
+		return err
+	}
+
+	p.sb.WriteString(fmt.Sprintf("<?xml version=%q", version))
+	if encoding != "" {
+		p.sb.WriteString(fmt.Sprintf(" encoding=%q", encoding))
+	}
+	switch standalone {
+	case 1:
+		p.sb.WriteString(" standalone=\"yes\"")
+	case 2:
+		p.sb.WriteString(" standalone=\"no\"")
+	}
+	p.sb.WriteString("?>")
+
+	return err
+}
+
+// docType writes the document type declaration
+func (p *binXMLParser) docType() (err error) {
+
+	var name string
+	name, err = p.readText()
+	if err != nil {
+		return err
+	}
+	p.sb.WriteString("<!DOCTYPE " + name)
+
+	for {
+		tok := p.peek()
+		if tok != bxSystem && tok != bxPublic && tok != bxSubset {
+			break
+		}
+		p.pos++
+
+		var t string
+		t, err = p.readText()
+		if err != nil {
+			return err
+		}
+
+		switch tok {
+		case bxSystem:
+			p.sb.WriteString(fmt.Sprintf(" SYSTEM %q", t))
+		case bxPublic:
+			p.sb.WriteString(fmt.Sprintf(" PUBLIC %q", t))
+		case bxSubset:
+			p.sb.WriteString(" [" + t + "]")
+		}
+	}
+	p.sb.WriteString(">")
+
+	return err
+}
+
+// qnameDef adds a qname definition to the qname dictionary
+func (p *binXMLParser) qnameDef() (err error) {
+
+	var ids [3]int
+	for i := range ids {
+		ids[i], err = p.readMB32()
+		if err != nil {
+			return err
+		}
+		if ids[i] >= len(p.names) {
+			return fmt.Errorf("undefined binary XML name (%d)", ids[i])
+		}
+	}
+
+	p.qnames = append(p.qnames, bxQNameDef{
+		nsURI:  p.names[ids[0]],
+		prefix: p.names[ids[1]],
+		local:  p.names[ids[2]],
+	})
+
+	return err
+}
+
+// qnameRef reads a reference to the qname dictionary
+func (p *binXMLParser) qnameRef() (q bxQNameDef, err error) {
+
+	var id int
+	id, err = p.readMB32()
+	if err != nil {
+		return q, err
+	}
+	if id == 0 || id >= len(p.qnames) {
+		return q, fmt.Errorf("undefined binary XML qname (%d)", id)
+	}
+	return p.qnames[id], err
+}
+
+// element writes the start tag, including the attributes and any
+// needed namespace declarations, for an element
+func (p *binXMLParser) element() (err error) {
+
+	var q bxQNameDef
+	q, err = p.qnameRef()
+	if err != nil {
+		return err
+	}
+
+	type attr struct {
+		q     bxQNameDef
+		value string
+	}
+
+	var attrs []attr
+	for p.peek() == bxAttr {
+		p.pos++
+
+		var a attr
+		a.q, err = p.qnameRef()
+		if err != nil {
+			return err
+		}
+
+		// The attribute value consists of zero or more atomic values
+		for isBinXMLValue(p.peek()) {
+			tok := p.b[p.pos]
+			p.pos++
+
+			var t string
+			t, err = p.value(tok)
+			if err != nil {
+				return err
+			}
+			a.value += t
+		}
+		attrs = append(attrs, a)
+	}
+	if p.peek() == bxEndAttrs {
+		p.pos++
+	}
+
+	// Determine the namespace scope for the element. Namespace
+	// declarations that are explicitly present are honored, any others
+	// needed by the element and attribute names are added.
+	scope := make(map[string]string)
+	for k, v := range p.scopes[len(p.scopes)-1] {
+		scope[k] = v
+	}
+
+	for _, a := range attrs {
+		switch {
+		case a.q.prefix == "xmlns":
+			scope[a.q.local] = a.value
+		case a.q.prefix == "" && a.q.local == "xmlns":
+			scope[""] = a.value
+		}
+	}
+
+	var decls []string
+	declare := func(prefix, uri string) {
+		if prefix == "xmlns" || prefix == "xml" {
+			return
+		}
+		if cur, ok := scope[prefix]; ok && cur == uri {
+			return
+		}
+		if _, ok := scope[prefix]; !ok && uri == "" {
+			return
+		}
+		scope[prefix] = uri
+		if prefix == "" {
+			decls = append(decls, fmt.Sprintf(" xmlns=\"%s\"", xmlAttrEscaper.Replace(uri)))
+		} else {
+			decls = append(decls, fmt.Sprintf(" xmlns:%s=\"%s\"", prefix, xmlAttrEscaper.Replace(uri)))
+		}
+	}
+
+	declare(q.prefix, q.nsURI)
+	for _, a := range attrs {
+		if a.q.prefix != "" {
+			declare(a.q.prefix, a.q.nsURI)
+		}
+	}
+
+	p.sb.WriteString("<" + q.String())
+	for _, d := range decls {
+		p.sb.WriteString(d)
+	}
+	for _, a := range attrs {
+		p.sb.WriteString(fmt.Sprintf(" %s=\"%s\"", a.q, xmlAttrEscaper.Replace(a.value)))
+	}
+
+	if p.peek() == bxEndElem {
+		p.pos++
+		p.sb.WriteString("/>")
+		return err
+	}
+
+	p.sb.WriteString(">")
+	p.elems = append(p.elems, q.String())
+	p.scopes = append(p.scopes, scope)
+
+	return err
+}
+
+// processingInstruction writes a processing instruction
+func (p *binXMLParser) processingInstruction() (err error) {
+
+	var id int
+	id, err = p.readMB32()
+	if err != nil {
+		return err
+	}
+	if id >= len(p.names) {
+		return fmt.Errorf("undefined binary XML name (%d)", id)
+	}
+
+	var t string
+	t, err = p.readText()
+	if err != nil {
+		return err
+	}
+
+	if t != "" {
+		p.sb.WriteString("<?" + p.names[id] + " " + t + "?>")
+	} else {
+		p.sb.WriteString("<?" + p.names[id] + "?>")
+	}
+	return err
+}
+
+// isBinXMLValue returns true for those tokens that are atomic values
+func isBinXMLValue(tok byte) bool {
+	switch {
+	case tok >= 0x01 && tok <= 0x18:
+		return true
+	case tok == 0x1b:
+		return true
+	case tok >= 0x7a && tok <= 0x7f:
+		return true
+	case tok >= 0x81 && tok <= 0x8c:
+		return true
+	}
+	return false
+}
+
+// value reads the (unescaped) text of an atomic value
+func (p *binXMLParser) value(tok byte) (s string, err error) {
+
+	// The fixed length SQL types use the column decoders
+	if atom, ok := binXMLAtoms[tok]; ok {
+		var b []byte
+		b, err = p.readBytes(atom.size)
+		if err != nil {
+			return s, err
+		}
+
+		tc := TableColumn{DataType: atom.dataType, Precision: 53}
+		var ec ExtractedColumn
+		ec, err = atom.fcn(variantReader(b), tc)
+		if err != nil {
+			return s, err
+		}
+
+		switch atom.dataType {
+		case Datetime, SmallDatetime:
+			return strings.Replace(ec.Str, " ", "T", 1), err
+		}
+		return ec.Str, err
+	}
+
+	var b []byte
+
+	switch tok {
+	case 0x06: // SQL bit
+		b, err = p.readBytes(1)
+		if err == nil {
+			s = fmt.Sprint(b[0])
+		}
+	case 0x07: // SQL tinyint
+		b, err = p.readBytes(1)
+		if err == nil {
+			s = fmt.Sprint(b[0])
+		}
+	case 0x0a, 0x0b, 0x87: // SQL decimal, numeric, XSD decimal
+		b, err = p.readLenBytes()
+		if err == nil {
+			if len(b) < 3 {
+				return s, errors.New("invalid binary XML decimal")
+			}
+			s = parseDecimal(b)
+		}
+	case 0x0c, 0x0f, 0x17, 0x1b, 0x85: // SQL binary, varbinary, image, udt, XSD base64
+		b, err = p.readLenBytes()
+		if err == nil {
+			s = base64.StdEncoding.EncodeToString(b)
+		}
+	case 0x84: // XSD binhex
+		b, err = p.readLenBytes()
+		if err == nil {
+			s = strings.ToUpper(hex.EncodeToString(b))
+		}
+	case 0x0d, 0x10, 0x16: // SQL char, varchar, text
+		// The length includes the 4 byte code page
+		b, err = p.readLenBytes()
+		if err == nil {
+			if len(b) < 4 {
+				return s, errors.New("invalid binary XML char value")
+			}
+			cp := int(b[0]) | int(b[1])<<8 | int(b[2])<<16 | int(b[3])<<24
+			s, err = decodeCodePage(b[4:], cp)
+		}
+	case 0x0e, 0x11, 0x18: // SQL nchar, nvarchar, ntext
+		s, err = p.readText()
+	case 0x7a, 0x7b, 0x7c, 0x7d, 0x7e, 0x7f: // XSD (katmai) temporal types
+		s, err = p.katmai(tok)
+	case 0x86: // XSD boolean
+		b, err = p.readBytes(1)
+		if err == nil {
+			s = "false"
+			if b[0] != 0 {
+				s = "true"
+			}
+		}
+	case 0x88: // XSD byte
+		b, err = p.readBytes(1)
+		if err == nil {
+			s = fmt.Sprint(int8(b[0]))
+		}
+	case 0x89, 0x8a, 0x8b: // XSD unsigned short, int, long
+		n := map[byte]int{0x89: 2, 0x8a: 4, 0x8b: 8}[tok]
+		b, err = p.readBytes(n)
+		if err == nil {
+			var z uint64
+			for i, sb := range b {
+				z |= uint64(sb) << uint(8*i)
+			}
+			s = fmt.Sprint(z)
+		}
+	case 0x8c: // XSD qname
+		var q bxQNameDef
+		q, err = p.qnameRef()
+		if err == nil {
+			s = q.String()
+		}
+	default:
+		err = fmt.Errorf("unsupported binary XML value type (0x%02x)", tok)
+	}
+
+	return s, err
+}
+
+// katmai reads the value for the XSD date, time, datetime, and
+// *offset types. These consist of the scale, the time (for the time
+// types), the date (for the date types), and the offset in minutes
+// (for the offset types). The time and date are UTC.
+func (p *binXMLParser) katmai(tok byte) (s string, err error) {
+
+	hasTime := tok == 0x7a || tok == 0x7b || tok == 0x7d || tok == 0x7e
+	hasDate := tok == 0x7b || tok == 0x7c || tok == 0x7e || tok == 0x7f
+	hasOffset := tok == 0x7a || tok == 0x7b || tok == 0x7c
+
+	var sc byte
+	sc, err = p.readByte()
+	if err != nil {
+		return s, err
+	}
+	scale := int(sc)
+
+	var b []byte
+	var m time.Duration
+	if hasTime {
+		var n int
+		n, err = calcTimeSize(scale)
+		if err != nil {
+			return s, err
+		}
+
+		b, err = p.readBytes(n)
+		if err != nil {
+			return s, err
+		}
+
+		var ticks uint64
+		for i, sb := range b {
+			ticks |= uint64(sb) << uint(8*i)
+		}
+
+		m, err = calcTimeDuration(scale, ticks)
+		if err != nil {
+			return s, err
+		}
+	}
+
+	d := time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC)
+	if hasDate {
+		b, err = p.readBytes(3)
+		if err != nil {
+			return s, err
+		}
+
+		var days int
+		for i, sb := range b {
+			days |= int(sb) << uint(8*i)
+		}
+		d = d.AddDate(0, 0, days)
+	}
+
+	t := d.Add(m)
+
+	if hasOffset {
+		b, err = p.readBytes(2)
+		if err != nil {
+			return s, err
+		}
+		offset := int16(b[0]) | int16(b[1])<<8
+		t = t.In(time.FixedZone("", int(offset)*60))
+	}
+
+	var f string
+	switch {
+	case hasDate && hasTime:
+		f = "2006-01-02T" + calcTimeFormat(scale)
+	case hasDate:
+		f = "2006-01-02"
+	default:
+		f = calcTimeFormat(scale)
+	}
+	if hasOffset {
+		f += "Z07:00"
+	}
+
+	return t.Format(f), err
+}
+
+func (p *binXMLParser) peek() byte {
+	if p.pos < len(p.b) {
+		return p.b[p.pos]
+	}
+	return 0
+}
+
+func (p *binXMLParser) readByte() (b byte, err error) {
+	if p.pos >= len(p.b) {
+		return b, io.ErrUnexpectedEOF
+	}
+	b = p.b[p.pos]
+	p.pos++
+	return b, err
+}
+
+func (p *binXMLParser) readBytes(n int) (b []byte, err error) {
+	if n < 0 || p.pos+n > len(p.b) {
+		return b, io.ErrUnexpectedEOF
+	}
+	b = p.b[p.pos : p.pos+n]
+	p.pos += n
+	return b, err
+}
+
+// readMB32 reads a multi-byte (7 bits per byte, least significant
+// group first) unsigned 32-bit integer
+func (p *binXMLParser) readMB32() (n int, err error) {
+
+	var u uint64
+	for i := 0; i < 5; i++ {
+		var b byte
+		b, err = p.readByte()
+		if err != nil {
+			return n, err
+		}
+		u |= uint64(b&0x7f) << uint(7*i)
+		if b < 0x80 {
+			if u > math.MaxInt32 {
+				return n, errors.New("invalid binary XML length")
+			}
+			return int(u), err
+		}
+	}
+	return n, errors.New("invalid binary XML length")
+}
+
+// readLenBytes reads a length (in bytes) prefixed byte slice
+func (p *binXMLParser) readLenBytes() (b []byte, err error) {
+
+	var n int
+	n, err = p.readMB32()
+	if err != nil {
+		return b, err
+	}
+	return p.readBytes(n)
+}
+
+// readText reads a length (in characters) prefixed UTF-16 string
+func (p *binXMLParser) readText() (s string, err error) {
+
+	var n int
+	n, err = p.readMB32()
+	if err != nil {
+		return s, err
+	}
+
+	var b []byte
+	b, err = p.readBytes(n * 2)
+	if err != nil {
+		return s, err
+	}
+	return utf16ToString(b)
+}
@@ -0,0 +1,269 @@
+package bactract
+
+import (
+	"testing"
+	"unicode/utf16"
+)
+
+// bxText returns the binary XML form of a string: the length (in
+// characters) followed by the UTF-16 characters
+func bxText(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := []byte{byte(len(u))}
+	for _, c := range u {
+		b = append(b, byte(c), byte(c>>8))
+	}
+	return b
+}
+
+// bxDoc returns a binary XML document made of the signature, version,
+// code page, and the token stream parts
+func bxDoc(parts ...[]byte) []byte {
+	b := []byte{0xdf, 0xff, 0x01, 0xb0, 0x04}
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	return b
+}
+
+// tok returns a token followed by its arguments
+func tok(t byte, args ...[]byte) []byte {
+	b := []byte{t}
+	for _, a := range args {
+		b = append(b, a...)
+	}
+	return b
+}
+
+// parseBinXML parses a binary XML document
+func parseBinXML(b []byte) (string, error) {
+	p := binXMLParser{b: b, pos: 5}
+	return p.parse()
+}
+
+func TestParseBinXML(t *testing.T) {
+
+	// The name and qname definitions for <root a="..."> as qnames 1 and 2
+	rootDefs := [][]byte{
+		tok(bxName, bxText("root")),
+		tok(bxName, bxText("a")),
+		tok(bxQName, []byte{0x00, 0x00, 0x01}),
+		tok(bxQName, []byte{0x00, 0x00, 0x02}),
+	}
+	withRoot := func(parts ...[]byte) []byte {
+		return bxDoc(append(append([][]byte{}, rootDefs...), parts...)...)
+	}
+
+	tests := []struct {
+		name string
+		b    []byte
+		want string
+	}{
+		{"empty element", withRoot(
+			tok(bxElement, []byte{0x01}), tok(bxEndAttrs), tok(bxEndElem)),
+			"<root/>"},
+		{"text is escaped", withRoot(
+			tok(bxElement, []byte{0x01}), tok(bxEndAttrs),
+			tok(bxXMLText, bxText("a < b & c")),
+			tok(bxEndElem)),
+			"<root>a &lt; b &amp; c</root>"},
+		{"attribute", withRoot(
+			tok(bxElement, []byte{0x01}),
+			tok(bxAttr, []byte{0x02}, tok(0x11, bxText("say \"hi\""))),
+			tok(bxEndAttrs), tok(bxEndElem)),
+			`<root a="say &quot;hi&quot;"/>`},
+		{"int and bigint values", withRoot(
+			tok(bxElement, []byte{0x01}), tok(bxEndAttrs),
+			tok(0x02, []byte{0x2a, 0x00, 0x00, 0x00}),
+			tok(0x08, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}),
+			tok(bxEndElem)),
+			"<root>42-1</root>"},
+		{"decimal value", withRoot(
+			tok(bxElement, []byte{0x01}), tok(bxEndAttrs),
+			tok(0x0a, []byte{0x07, 0x05, 0x02, 0x01, 0x39, 0x30, 0x00, 0x00}),
+			tok(bxEndElem)),
+			"<root>123.45</root>"},
+		{"cp1252 char value", withRoot(
+			tok(bxElement, []byte{0x01}), tok(bxEndAttrs),
+			tok(0x10, []byte{0x08, 0xe4, 0x04, 0x00, 0x00, 0x63, 0x61, 0x66, 0xe9}),
+			tok(bxEndElem)),
+			"<root>café</root>"},
+		{"base64 value", withRoot(
+			tok(bxElement, []byte{0x01}), tok(bxEndAttrs),
+			tok(0x0f, []byte{0x03, 0x01, 0x02, 0x03}),
+			tok(bxEndElem)),
+			"<root>AQID</root>"},
+		{"xsd date value", withRoot(
+			tok(bxElement, []byte{0x01}), tok(bxEndAttrs),
+			tok(0x7f, []byte{0x00, 0x90, 0x40, 0x0b}),
+			tok(bxEndElem)),
+			"<root>2020-01-01</root>"},
+		{"xsd boolean value", withRoot(
+			tok(bxElement, []byte{0x01}), tok(bxEndAttrs),
+			tok(0x86, []byte{0x01}),
+			tok(bxEndElem)),
+			"<root>true</root>"},
+		{"nested elements", withRoot(
+			tok(bxElement, []byte{0x01}), tok(bxEndAttrs),
+			tok(bxElement, []byte{0x01}), tok(bxEndAttrs), tok(bxEndElem),
+			tok(bxEndElem)),
+			"<root><root/></root>"},
+		{"comment and CDATA", withRoot(
+			tok(bxElement, []byte{0x01}), tok(bxEndAttrs),
+			tok(bxComment, bxText(" c ")),
+			tok(bxCData, bxText("<x>")), tok(bxCDataEnd),
+			tok(bxEndElem)),
+			"<root><!-- c --><![CDATA[<x>]]></root>"},
+		{"xml declaration", withRoot(
+			tok(bxXMLDecl, bxText("1.0"), tok(bxEncoding, bxText("utf-16")), []byte{0x01}),
+			tok(bxElement, []byte{0x01}), tok(bxEndAttrs), tok(bxEndElem)),
+			`<?xml version="1.0" encoding="utf-16" standalone="yes"?><root/>`},
+		{"namespace prefix", bxDoc(
+			tok(bxName, bxText("urn:x")),
+			tok(bxName, bxText("p")),
+			tok(bxName, bxText("e")),
+			tok(bxQName, []byte{0x01, 0x02, 0x03}),
+			tok(bxElement, []byte{0x01}), tok(bxEndAttrs),
+			tok(bxElement, []byte{0x01}), tok(bxEndAttrs), tok(bxEndElem),
+			tok(bxEndElem)),
+			`<p:e xmlns:p="urn:x"><p:e/></p:e>`},
+		{"default namespace", bxDoc(
+			tok(bxName, bxText("urn:x")),
+			tok(bxName, bxText("e")),
+			tok(bxQName, []byte{0x01, 0x00, 0x02}),
+			tok(bxElement, []byte{0x01}), tok(bxEndAttrs), tok(bxEndElem)),
+			`<e xmlns="urn:x"/>`},
+		{"processing instruction", withRoot(
+			tok(bxPI, []byte{0x01}, bxText("x=1")),
+			tok(bxElement, []byte{0x01}), tok(bxEndAttrs), tok(bxEndElem)),
+			"<?root x=1?><root/>"},
+		{"name flush", bxDoc(
+			tok(bxName, bxText("a")),
+			tok(bxQName, []byte{0x00, 0x00, 0x01}),
+			tok(bxNmFlush),
+			tok(bxName, bxText("b")),
+			tok(bxQName, []byte{0x00, 0x00, 0x01}),
+			tok(bxElement, []byte{0x01}), tok(bxEndAttrs), tok(bxEndElem)),
+			"<b/>"},
+	}
+
+	for _, tt := range tests {
+		got, err := parseBinXML(tt.b)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseBinXMLErrors(t *testing.T) {
+
+	defs := [][]byte{
+		tok(bxName, bxText("root")),
+		tok(bxQName, []byte{0x00, 0x00, 0x01}),
+	}
+	withDefs := func(parts ...[]byte) []byte {
+		return bxDoc(append(append([][]byte{}, defs...), parts...)...)
+	}
+
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{"unbalanced end element", withDefs(tok(bxEndElem))},
+		{"unclosed element", withDefs(tok(bxElement, []byte{0x01}), tok(bxEndAttrs))},
+		{"undefined qname", withDefs(tok(bxElement, []byte{0x05}))},
+		{"undefined name", bxDoc(tok(bxQName, []byte{0x00, 0x00, 0x03}))},
+		{"unknown token", withDefs(tok(0xff))},
+		{"truncated text", withDefs(tok(bxXMLText, []byte{0x05, 0x61, 0x00}))},
+		{"truncated int", withDefs(tok(0x02, []byte{0x2a, 0x00}))},
+		{"invalid length", withDefs(tok(bxXMLText, []byte{0xff, 0xff, 0xff, 0xff, 0xff}))},
+	}
+
+	for _, tt := range tests {
+		if _, err := parseBinXML(tt.b); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestReadMB32(t *testing.T) {
+
+	tests := []struct {
+		b    []byte
+		want int
+	}{
+		{[]byte{0x00}, 0},
+		{[]byte{0x7f}, 127},
+		{[]byte{0x80, 0x01}, 128},
+		{[]byte{0xff, 0x7f}, 16383},
+		{[]byte{0x80, 0x80, 0x01}, 16384},
+	}
+
+	for _, tt := range tests {
+		p := binXMLParser{b: tt.b}
+		got, err := p.readMB32()
+		if err != nil {
+			t.Errorf("% x: unexpected error: %s", tt.b, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("% x: got %d, want %d", tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestReadXml(t *testing.T) {
+
+	// The 8 byte size followed by the value
+	stored := func(b []byte) []byte {
+		n := len(b)
+		s := []byte{byte(n), byte(n >> 8), 0, 0, 0, 0, 0, 0}
+		return append(s, b...)
+	}
+
+	text := []byte{0xff, 0xfe}
+	for _, c := range utf16.Encode([]rune("<a>é</a>")) {
+		text = append(text, byte(c), byte(c>>8))
+	}
+
+	binary := bxDoc(
+		tok(bxName, bxText("a")),
+		tok(bxQName, []byte{0x00, 0x00, 0x01}),
+		tok(bxElement, []byte{0x01}), tok(bxEndAttrs),
+		tok(bxXMLText, bxText("é")),
+		tok(bxEndElem))
+
+	tests := []struct {
+		name string
+		b    []byte
+		want string
+	}{
+		{"UTF-16 text", stored(text), "<a>é</a>"},
+		{"binary XML", stored(binary), "<a>é</a>"},
+	}
+
+	tc := TableColumn{ColName: "x", DataType: Xml, DtStr: "xml", IsNullable: true}
+
+	for _, tt := range tests {
+		ec, err := readXml(variantReader(tt.b), tc)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+		if ec.Str != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, ec.Str, tt.want)
+		}
+	}
+
+	ec, err := readXml(variantReader([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}), tc)
+	if err != nil {
+		t.Fatalf("null: unexpected error: %s", err)
+	}
+	if !ec.IsNull {
+		t.Errorf("null: got %q, want null", ec.Str)
+	}
+}
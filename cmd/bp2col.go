@@ -82,7 +82,8 @@ func doDump(v params) {
 	fmt.Println(strings.Join([]string{"table_schema",
 		"table_name", "column_name", "ordinal_position", "is_nullable",
 		"data_type", "character_maximum_length", "numeric_precision",
-		"numeric_scale"}, "\t"))
+		"numeric_scale", "description", "collation_name", "is_sparse",
+		"is_filestream", "is_rowguidcol", "in_bcp", "is_clr_type"}, "\t"))
 
 	for _, table := range tables {
 		t, ok := model.Tables[table]
@@ -112,6 +113,22 @@ func doDump(v params) {
 
 				attr = append(attr, fmt.Sprintf("%d", c.Precision))
 				attr = append(attr, fmt.Sprintf("%d", c.Scale))
+				attr = append(attr, cleanDescription(c.Description))
+
+				// The collation is only listed for the character columns
+				collation := ""
+				if isChar(c.DtStr) {
+					collation = c.Collation
+					if collation == "" {
+						collation = model.DatabaseCollation
+					}
+				}
+				attr = append(attr, collation)
+				attr = append(attr, yesNo(c.IsSparse))
+				attr = append(attr, yesNo(c.IsFileStream))
+				attr = append(attr, yesNo(c.IsRowGuidCol))
+				attr = append(attr, yesNo(c.IsInBCP()))
+				attr = append(attr, yesNo(c.IsClrType))
 
 				fmt.Println(strings.Join(attr, "\t"))
 			}
@@ -119,6 +136,20 @@ func doDump(v params) {
 	}
 }
 
+// cleanDescription collapses the whitespace (tabs, line breaks) in a
+// description so that it does not break the tab-separated output
+func cleanDescription(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// yesNo formats a flag as YES or NO
+func yesNo(b bool) string {
+	if b {
+		return "YES"
+	}
+	return "NO"
+}
+
 func isChar(dt string) (b bool) {
 	switch dt {
 	case "char", "varchar", "text", "nchar", "nvarchar", "ntext":
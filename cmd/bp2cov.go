@@ -0,0 +1,128 @@
+// Generate a model coverage report (the element types and properties consumed, or ignored, by bac-tract) from an unzipped bacpac file
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+
+	//
+	bp "github.com/gsiems/bac-tract/bactract"
+)
+
+type params struct {
+	baseDir    string
+	format     string
+	findings   bool
+	ignored    bool
+	maxObjects int
+	cpuprofile string
+	memprofile string
+	debug      bool
+}
+
+func main() {
+
+	var v params
+
+	flag.StringVar(&v.baseDir, "b", "", "The directory containing the unzipped bacpac file.")
+	flag.StringVar(&v.format, "format", "csv", "The format of the coverage report [csv|json].")
+	flag.BoolVar(&v.findings, "findings", false, "Write the objects that will not migrate as is (computed columns, columns of unknown datatype, etc.) rather than the element type and property counts.")
+	flag.BoolVar(&v.ignored, "ignored", false, "Only write the element types and properties that are ignored.")
+	flag.IntVar(&v.maxObjects, "n", 0, "The maximum number of objects to list per ignored element type or property. Defaults to listing all objects.")
+	flag.StringVar(&v.cpuprofile, "cpuprofile", "", "The filename to write cpu profile information to")
+	//flag.StringVar(&v.memprofile, "memprofile", "", The filename to write memory profile information to")
+
+	flag.Parse()
+
+	if v.cpuprofile != "" {
+		f, err := os.Create(v.cpuprofile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = pprof.StartCPUProfile(f)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer pprof.StopCPUProfile()
+	}
+
+	doDump(v)
+}
+
+func doDump(v params) {
+
+	p, _ := bp.New(v.baseDir)
+
+	cov, err := p.GetCoverage("")
+	dieOnErrf("GetCoverage failed: %q", err)
+
+	var items []bp.CoverageItem
+	for _, ci := range cov.Items {
+		if v.ignored && ci.IsConsumed {
+			continue
+		}
+		if v.maxObjects > 0 && len(ci.Objects) > v.maxObjects {
+			ci.Objects = ci.Objects[:v.maxObjects]
+		}
+		items = append(items, ci)
+	}
+
+	switch strings.ToLower(v.format) {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if v.findings {
+			dieOnErr(enc.Encode(cov.Findings))
+			return
+		}
+		dieOnErr(enc.Encode(items))
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		if v.findings {
+			err = w.Write([]string{"object", "issue"})
+			dieOnErr(err)
+			for _, f := range cov.Findings {
+				err = w.Write([]string{f.Object, f.Issue})
+				dieOnErr(err)
+			}
+		} else {
+			err = w.Write([]string{"element_type", "property", "count", "status", "objects"})
+			dieOnErr(err)
+			for _, ci := range items {
+				err = w.Write([]string{ci.ElementType, ci.Property, strconv.Itoa(ci.Count), status(ci), strings.Join(ci.Objects, ", ")})
+				dieOnErr(err)
+			}
+		}
+		w.Flush()
+		dieOnErr(w.Error())
+	default:
+		log.Fatalf("Unsupported report format %q", v.format)
+	}
+}
+
+// status returns the consumed/ignored status of a coverage item
+func status(ci bp.CoverageItem) string {
+	if ci.IsConsumed {
+		return "consumed"
+	}
+	return "ignored"
+}
+
+func dieOnErrf(s string, err error) {
+	if err != nil {
+		log.Fatalf(s, err)
+	}
+}
+
+func dieOnErr(err error) {
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -18,13 +18,26 @@ import (
 )
 
 type params struct {
-	baseDir    string
-	tableName  string
-	tablesFile string
-	rowLimit   uint64
-	cpuprofile string
-	memprofile string
-	debug      bool
+	baseDir     string
+	tableName   string
+	tablesFile  string
+	schemaMap   string
+	history     string
+	partitions  bool
+	rowLimit    uint64
+	timePrec    int
+	variantJSON bool
+	rvUint      bool
+	guidFormat  string
+	lobDir      string
+	lobSize     int
+	charset     string
+	unmappable  string
+	cs          bp.Charset
+	csPolicy    int
+	cpuprofile  string
+	memprofile  string
+	debug       bool
 }
 
 func main() {
@@ -34,7 +47,18 @@ func main() {
 	flag.StringVar(&v.baseDir, "b", "", "The directory containing the unzipped bacpac file.")
 	flag.StringVar(&v.tableName, "t", "", "The table to extract data from. When not specified then extract all tables")
 	flag.StringVar(&v.tablesFile, "f", "", "The file to read the list of tables to extract from, one table per line")
+	flag.StringVar(&v.schemaMap, "schema-map", "", "The schema name mappings to apply to the output, comma separated source=target pairs (dbo=public).")
+	flag.StringVar(&v.history, "history", "include", "How to extract the history tables for temporal tables (include, exclude, or combine). Combine appends the history data to the data for the temporal table, which is then only loadable into the tables created by bp2ddl -history combine (no primary key or unique constraints).")
+	flag.BoolVar(&v.partitions, "partitions", false, "Write the data for partitioned tables to one file per partition (<schema>.<table>.p<N>.csv).")
 	flag.Uint64Var(&v.rowLimit, "c", 0, "The number of rows to extract. When 0 extract all rows.")
+	flag.IntVar(&v.timePrec, "p", -1, "The number of fractional second digits to output for datetime, datetime2, and time values. When negative use the column scale.")
+	flag.BoolVar(&v.variantJSON, "variantjson", false, "Write sql_variant values as JSON objects containing the base type and value.")
+	flag.BoolVar(&v.rvUint, "rvuint", false, "Write rowversion (timestamp) values as unsigned integers rather than as hex.")
+	flag.StringVar(&v.guidFormat, "guid", "", "The uniqueidentifier output format options, comma separated (upper, nodash, braces, raw). When not specified then write lowercase 8-4-4-4-12 UUIDs.")
+	flag.StringVar(&v.lobDir, "lobdir", "", "The directory to write large values to, one file per value. When not specified then large values are written to the CSV file.")
+	flag.IntVar(&v.lobSize, "lobsize", 1048576, "The size, in bytes, above which large values are written to the lobdir.")
+	flag.StringVar(&v.charset, "charset", "UTF8", "The character set to write the CSV files in (Oracle, PostgreSQL, or IANA name).")
+	flag.StringVar(&v.unmappable, "unmappable", "replace", "How to deal with characters that cannot be written in the charset (replace, drop, or error).")
 	flag.BoolVar(&v.debug, "debug", false, "Write debug information to STDOUT.")
 	flag.StringVar(&v.cpuprofile, "cpuprofile", "", "The filename to write cpu profile information to")
 	//flag.StringVar(&v.memprofile, "memprofile", "", The filename to write memory profile information to")
@@ -61,13 +85,34 @@ func doDump(v params) {
 	p, _ := bp.New(v.baseDir)
 
 	p.SetDebug(v.debug)
+	p.SetTimePrecision(v.timePrec)
+	if v.rvUint {
+		p.SetRowversionFormat(bp.RowversionUint64)
+	}
+
+	gf, err := bp.LookupGUIDFormat(v.guidFormat)
+	dieOnErrf("GUID format lookup failed: %q", err)
+	p.SetGUIDFormat(gf)
+
+	v.cs, err = bp.LookupCharset(v.charset)
+	dieOnErrf("Charset lookup failed: %q", err)
+	v.csPolicy, err = bp.LookupUnmappablePolicy(v.unmappable)
+	dieOnErrf("Unmappable policy lookup failed: %q", err)
+
+	sm, err := bp.LookupSchemaMap(v.schemaMap)
+	dieOnErrf("Schema map lookup failed: %q", err)
+	p.SetSchemaMap(sm)
+
+	hm, err := bp.LookupHistoryMode(v.history)
+	dieOnErrf("History mode lookup failed: %q", err)
+	p.SetHistoryMode(hm)
 
 	model, err := p.GetModel("")
 	dieOnErrf("GetModel failed: %q", err)
 
 	var tables []string
 	if v.tableName != "" {
-		tables = append(tables, v.tableName)
+		tables = append(tables, p.MapTableName(v.tableName))
 	} else if v.tablesFile != "" {
 
 		content, err := ioutil.ReadFile(v.tablesFile)
@@ -75,7 +120,7 @@ func doDump(v params) {
 
 		x := bytes.Split(content, []byte("\n"))
 		for _, z := range x {
-			tables = append(tables, string(z))
+			tables = append(tables, p.MapTableName(string(z)))
 		}
 	} else {
 		tables, err = p.ExportedTables()
@@ -84,7 +129,7 @@ func doDump(v params) {
 
 	for _, table := range tables {
 		t, ok := model.Tables[table]
-		if ok {
+		if ok && t.IsExtracted() {
 			hasBinary := false
 			for _, c := range t.Columns {
 				if c.DataType == bp.Binary || c.DataType == bp.Varbinary {
@@ -105,12 +150,27 @@ func mkFile(t bp.Table, v params) {
 	r, err := t.DataReader()
 	dieOnErrf("DataReader failed: %q", err)
 
-	target := fmt.Sprintf("%s.%s.csv", t.Schema, t.TabName)
-	f := openOutput(target)
-	defer deferredClose(f)
-	w := csv.NewWriter(f)
+	if v.lobDir != "" {
+		err = os.MkdirAll(v.lobDir, 0755)
+		dieOnErrf("Lob directory create failed: %q", err)
+		r.SetLobFiles(v.lobSize, v.lobDir)
+	}
+
+	// The output files, by partition number (0 for the whole table)
+	files := make(map[int]*csvFile)
+	defer func() {
+		for _, cf := range files {
+			cf.w.Flush()
+			dieOnErr(cf.w.Error())
+			deferredClose(cf.f)
+		}
+	}()
+
+	split := v.partitions && t.IsPartitioned()
+	if !split {
+		files[0] = newCSVFile(fmt.Sprintf("%s.%s.csv", t.Schema, t.TabName), v)
+	}
 
-	writeHdr := true
 	var i uint64
 	for {
 
@@ -128,30 +188,58 @@ func mkFile(t bp.Table, v params) {
 			break
 		}
 
-		if writeHdr {
+		part := 0
+		if split {
+			part = t.PartitionNumber(row)
+		}
+		cf, ok := files[part]
+		if !ok {
+			cf = newCSVFile(fmt.Sprintf("%s.%s.p%d.csv", t.Schema, t.TabName, part), v)
+			files[part] = cf
+		}
+
+		if cf.writeHdr {
 			var cols []string
 			for _, ec := range row {
 				cols = append(cols, ec.ColName)
 			}
-			err = w.Write(cols)
+			err = cf.w.Write(cols)
 			dieOnErr(err)
-			writeHdr = false
+			cf.writeHdr = false
 		}
 
 		var cols []string
 		for _, ec := range row {
 
-			if ec.DataType == bp.Varbinary || ec.IsNull {
+			if ec.LobFile != "" {
+				cols = append(cols, ec.LobFile)
+			} else if ec.DataType == bp.Varbinary || ec.IsNull {
 				cols = append(cols, "")
+			} else if ec.DataType == bp.SQLVariant && v.variantJSON {
+				tj, err := ec.TypedJSON()
+				dieOnErrf("TypedJSON failed: %q", err)
+				cols = append(cols, tj)
 			} else {
 				cols = append(cols, ec.Str)
 			}
 		}
-		err = w.Write(cols)
+		err = cf.w.Write(cols)
 		dieOnErr(err)
 	}
-	w.Flush()
-	dieOnErr(w.Error())
+}
+
+// csvFile is an output file for the data of a table, or of a partition
+// of a table
+type csvFile struct {
+	f        *os.File
+	w        *csv.Writer
+	writeHdr bool
+}
+
+// newCSVFile opens a CSV output file
+func newCSVFile(target string, v params) *csvFile {
+	f := openOutput(target)
+	return &csvFile{f, csv.NewWriter(v.cs.NewWriter(f, v.csPolicy)), true}
 }
 
 // openOutput opens the appropriate target for writing output, or dies trying
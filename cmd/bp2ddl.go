@@ -3,15 +3,22 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"flag"
 	"fmt"
+	"hash/fnv"
 	"io/ioutil"
 	"log"
 	"os"
+	"regexp"
 	"runtime/pprof"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	//
 	bp "github.com/gsiems/bac-tract/bactract"
@@ -20,24 +27,47 @@ import (
 )
 
 type params struct {
-	baseDir    string
-	tableName  string
-	tablesFile string
-	dbDialect  dialect.DbDialect
-	cpuprofile string
-	memprofile string
-	debug      bool
+	baseDir     string
+	tableName   string
+	tablesFile  string
+	schemaMap   string
+	schemas     map[string]string
+	dbDialect   dialect.DbDialect
+	ltree       bool
+	rvUint      bool
+	indexFile   string
+	materialize bool
+	views       bool
+	versioning  bool
+	collations  bool
+	citext      bool
+	history     int
+	dbCollation string
+	cpuprofile  string
+	memprofile  string
+	debug       bool
 }
 
 func main() {
 
 	var v params
 	var dd string
+	var hist string
 
 	flag.StringVar(&v.baseDir, "b", "", "The directory containing the unzipped bacpac file.")
 	flag.StringVar(&dd, "d", "Std", "The DDL dialect to output [Ora|Pg|Std].")
 	flag.StringVar(&v.tableName, "t", "", "The table to generate the CREATE TABLE command for. When not specified then generate the DDL for all tables.")
 	flag.StringVar(&v.tablesFile, "f", "", "The file to read the list of tables to extract from, one table per line")
+	flag.StringVar(&v.schemaMap, "schema-map", "", "The schema name mappings to apply to the output, comma separated source=target pairs (dbo=public).")
+	flag.BoolVar(&v.ltree, "ltree", false, "Map hierarchyid columns to the ltree datatype (Pg only).")
+	flag.StringVar(&v.indexFile, "indexes", "", "The file to write the (post-load) index creation DDL to. When not specified then no index DDL is generated.")
+	flag.BoolVar(&v.materialize, "materialize", false, "Create computed columns as plain (materialized) columns rather than as generated/virtual columns.")
+	flag.BoolVar(&v.views, "views", false, "Generate the CREATE VIEW DDL for the views (in dependency order) rather than the table DDL.")
+	flag.BoolVar(&v.versioning, "versioning", false, "Generate a trigger-based system versioning template for the temporal tables (Pg only).")
+	flag.BoolVar(&v.collations, "collations", false, "Map the case and accent insensitive column collations (ICU collations for Pg, BINARY_CI/BINARY_AI for Oracle).")
+	flag.BoolVar(&v.citext, "citext", false, "Map the case insensitive columns to citext rather than to ICU collations (Pg only, implies -collations).")
+	flag.StringVar(&hist, "history", "include", "How the history tables for temporal tables are extracted (include, exclude, or combine). For exclude and combine the history tables are not created. For combine the primary key and unique constraints of the temporal tables are not created (and unique indexes are created as non-unique) as the data for the temporal tables includes the history rows.")
+	flag.BoolVar(&v.rvUint, "rvuint", false, "Map rowversion (timestamp) columns to a numeric datatype rather than a binary datatype.")
 	flag.StringVar(&v.cpuprofile, "cpuprofile", "", "The filename to write cpu profile information to")
 	//flag.StringVar(&v.memprofile, "memprofile", "", The filename to write memory profile information to")
 
@@ -61,95 +91,1491 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 
+	hm, err := bp.LookupHistoryMode(hist)
+	dieOnErrf("History mode lookup failed: %q", err)
+	v.history = hm
+
 	doDump(v)
 }
 
-func doDump(v params) {
+func doDump(v params) {
+
+	p, _ := bp.New(v.baseDir)
+
+	sm, err := bp.LookupSchemaMap(v.schemaMap)
+	dieOnErrf("Schema map lookup failed: %q", err)
+	p.SetSchemaMap(sm)
+	p.SetHistoryMode(v.history)
+	v.schemas = sm
+
+	model, err := p.GetModel("")
+	dieOnErrf("GetModel failed: %q", err)
+	v.dbCollation = model.DatabaseCollation
+	if v.citext {
+		v.collations = true
+	}
+
+	if v.views {
+		mkViewScript(v, model)
+		return
+	}
+
+	var tables []string
+	if v.tableName != "" {
+		tables = append(tables, p.MapTableName(v.tableName))
+	} else if v.tablesFile != "" {
+
+		content, err := ioutil.ReadFile(v.tablesFile)
+		dieOnErrf("File read failed: %q", err)
+
+		x := bytes.Split(content, []byte("\n"))
+		for _, z := range x {
+			tables = append(tables, p.MapTableName(string(z)))
+		}
+	} else {
+		for t, _ := range model.Tables {
+			tables = append(tables, t)
+		}
+		sort.Strings(tables)
+	}
+	tables = pairTemporal(tables, model)
+
+	if v.ltree && v.dbDialect.Dialect() == dialect.PostgreSQL {
+		fmt.Print("CREATE EXTENSION IF NOT EXISTS ltree ;\n\n")
+	}
+
+	// The schemas, sequences, and (Oracle) synonyms precede the tables.
+	// The sequences and synonyms are only generated when generating the
+	// DDL for all tables.
+	allTables := v.tableName == "" && v.tablesFile == ""
+	mkSchemaDDL(v, model, tables, allTables)
+	mkCollationDDL(v, model, tables)
+	if allTables {
+		mkSequenceDDL(v, model)
+		mkTypeDDL(v, model)
+		if v.dbDialect.Dialect() == dialect.Oracle {
+			mkSynonymDDL(v, model, false)
+		}
+	}
+
+	for _, table := range tables {
+		t, ok := model.Tables[table]
+
+		if ok {
+			x := newExprTranslator(t, v)
+
+			combined := isCombined(t, model, v)
+			warnings := temporalNotes(t, v)
+			if combined {
+				warnings = append(warnings, "--     the history data is combined with the table data (-history combine) so the primary key and unique constraints are not created\n")
+			}
+			warnings = append(warnings, partitionNotes(t, v.dbDialect)...)
+			warnings = append(warnings, columnNotes(t)...)
+			var colDefs []string
+
+			for _, c := range t.Columns {
+
+				colType := convDatatype(c.DtStr, c.Length, c.Precision, c.Scale, v.dbDialect)
+				if c.DataType == bp.HierarchyID && v.ltree && v.dbDialect.Dialect() == dialect.PostgreSQL {
+					colType = "ltree"
+				}
+				if c.DataType == bp.Rowversion && v.rvUint {
+					colType = convDatatype("decimal", 0, 20, 0, v.dbDialect)
+				}
+
+				if c.IsColumnSet {
+					continue
+				}
+
+				collate, note := collateClause(c, v)
+				if collate != "" {
+					colType = collate
+				} else if allTables && isDomain(c, model, v.dbDialect) {
+					colType = formatQN(c.UserType, v.dbDialect)
+				}
+				if note != "" {
+					warnings = append(warnings, fmt.Sprintf("-- NB %s.%s.%s: %s\n", t.Schema, t.TabName, c.ColName, note))
+				}
+
+				if c.IsComputed {
+					colDef, note := computedColDef(t, c, colType, x, v)
+					colDefs = append(colDefs, colDef)
+					if note != "" {
+						warnings = append(warnings, note)
+					}
+					continue
+				}
+
+				// Pg only allows identity columns for the integer types
+				identity := c.IsIdentity
+				if identity && v.dbDialect.Dialect() == dialect.PostgreSQL && (c.DataType == bp.Decimal || c.DataType == bp.Numeric) {
+					if c.Scale == 0 && c.Precision <= 18 {
+						colType = "bigint"
+					} else {
+						identity = false
+						warnings = append(warnings, fmt.Sprintf("-- NB %s.%s.%s: the %s(%d,%d) identity column is created without the identity as it does not fit a bigint\n", t.Schema, t.TabName, c.ColName, c.DtStr, c.Precision, c.Scale))
+					}
+				}
+
+				colDef := formatIdent(c.ColName, v.dbDialect) + " " + colType
+				if identity {
+					colDef += fmt.Sprintf(" GENERATED BY DEFAULT AS IDENTITY ( START WITH %d INCREMENT BY %d )", c.IdentitySeed, c.IdentityIncr)
+				}
+				if c.Default != "" {
+					def, ok := x.translateDefault(c)
+					if ok {
+						colDef += " DEFAULT " + def
+					} else {
+						warnings = append(warnings, fmt.Sprintf("-- WARNING: could not translate the default for %s.%s.%s: %s\n", t.Schema, t.TabName, c.ColName, c.Default))
+					}
+				}
+				if c.Period != "" && t.IsSystemVersioned && !combined && v.dbDialect.Dialect() == dialect.StandardSQL {
+					colDef += " GENERATED ALWAYS AS " + c.Period
+				}
+				if c.IsNullable {
+					colDefs = append(colDefs, colDef)
+				} else {
+					colDefs = append(colDefs, colDef+" NOT NULL")
+				}
+
+			}
+			// Check Constraints
+			var checkDefs []string
+			for _, c := range t.Checks {
+				expr, ok := x.translate(unwrapParens(c.Expression))
+				if !ok {
+					label := "unnamed check constraint"
+					if c.ConsName != "" {
+						label = "check constraint " + c.ConsName
+					}
+					warnings = append(warnings, fmt.Sprintf("-- WARNING: could not translate the %s on %s.%s: %s\n", label, t.Schema, t.TabName, c.Expression))
+					continue
+				}
+				if c.ConsName != "" {
+					checkDefs = append(checkDefs, fmt.Sprintf("CONSTRAINT %s CHECK ( %s )", formatIdent(c.ConsName, v.dbDialect), expr))
+				} else {
+					checkDefs = append(checkDefs, fmt.Sprintf("CHECK ( %s )", expr))
+				}
+			}
+
+			fmt.Print(strings.Join(warnings, ""))
+			createTable := "CREATE TABLE"
+			if t.Durability == "SCHEMA_ONLY" && v.dbDialect.Dialect() == dialect.PostgreSQL {
+				createTable = "CREATE UNLOGGED TABLE"
+			}
+			fmt.Printf("%s %s.%s (\n    ", createTable, formatIdent(t.Schema, v.dbDialect), formatIdent(t.TabName, v.dbDialect))
+			fmt.Printf("%s", strings.Join(colDefs, ",\n    "))
+
+			// Primary Key
+			pkCols := joinCols(t.PK.Columns, v.dbDialect)
+			if pkCols != "" && !combined {
+				consname := fmt.Sprintf("pk_%s", t.TabName)
+				pk_name := formatIdent(consname, v.dbDialect)
+				fmt.Printf(",\n    CONSTRAINT %s PRIMARY KEY ( %s )", pk_name, pkCols)
+			}
+
+			// Unique Constraints
+			for _, c := range t.Unique {
+				uCols := joinCols(c.Columns, v.dbDialect)
+				if uCols != "" && !combined {
+					consname := formatIdent(c.ConsName, v.dbDialect)
+					fmt.Printf(",\n    CONSTRAINT %s UNIQUE ( %s )", consname, uCols)
+				}
+			}
+
+			for _, c := range checkDefs {
+				fmt.Printf(",\n    %s", c)
+			}
+
+			isVersioned := t.IsSystemVersioned && !combined && t.PeriodStart != "" && v.dbDialect.Dialect() == dialect.StandardSQL
+			if isVersioned {
+				fmt.Printf(",\n    PERIOD FOR SYSTEM_TIME ( %s )", joinCols([]string{t.PeriodStart, t.PeriodEnd}, v.dbDialect))
+			}
+			fmt.Print(" )")
+			if isVersioned {
+				fmt.Print("\n    WITH SYSTEM VERSIONING")
+			}
+			fmt.Print(partitionClause(t, v.dbDialect))
+			fmt.Print(" ;\n\n")
+			fmt.Print(partitionDDL(t, v.dbDialect))
+			fmt.Print(commentDDL(t, v.dbDialect))
+		}
+	}
+
+	for _, table := range tables {
+		t, ok := model.Tables[table]
+
+		if ok {
+
+			// Foreign Key Constraints
+			for _, c := range t.FKs {
+
+				fkCols := joinCols(c.Columns, v.dbDialect)
+				refCols := joinCols(c.RefColumns, v.dbDialect)
+
+				rt, ok2 := model.Tables[c.RefTable]
+				if ok2 && (isCombined(t, model, v) || isCombined(rt, model, v)) {
+					fmt.Printf("-- NB the foreign key %s on %s.%s is not created as the history data is combined with the table data (-history combine)\n\n", c.ConsName, t.Schema, t.TabName)
+					continue
+				}
+				if ok2 {
+					fmt.Printf("ALTER TABLE %s.%s\n", formatIdent(t.Schema, v.dbDialect), formatIdent(t.TabName, v.dbDialect))
+					fmt.Printf("    ADD CONSTRAINT %s FOREIGN KEY ( %s )\n", formatIdent(c.ConsName, v.dbDialect), fkCols)
+					fmt.Printf("    REFERENCES %s.%s ( %s )", formatIdent(rt.Schema, v.dbDialect), formatIdent(rt.TabName, v.dbDialect), refCols)
+					fmt.Print(fkOptions(c, v.dbDialect))
+					fmt.Print(" ;\n\n")
+				}
+			}
+		}
+	}
+
+	if v.versioning && v.dbDialect.Dialect() == dialect.PostgreSQL {
+		for _, table := range tables {
+			t, ok := model.Tables[table]
+			if !ok || !t.IsSystemVersioned {
+				continue
+			}
+			h, ok := model.Tables[t.HistoryTable]
+			if ok && h.IsExtracted() && t.PeriodStart != "" && t.PeriodEnd != "" {
+				fmt.Print(versioningDDL(t, h, v.dbDialect))
+			}
+		}
+	}
+
+	// For Pg and Std the synonyms for tables become views of the tables
+	if allTables && v.dbDialect.Dialect() != dialect.Oracle {
+		mkSynonymDDL(v, model, false)
+	}
+
+	if v.indexFile != "" {
+		mkIndexScript(v, model, tables)
+	}
+}
+
+// icuCollations are the ICU (nondeterministic) collations used for
+// mapping the case and/or accent insensitive collations for Pg
+var icuCollations = map[string]string{
+	"ci_as": "und-u-ks-level2",
+	"ci_ai": "und-u-ks-level1",
+	"cs_ai": "und-u-ks-level1-kc-true",
+}
+
+// isCharType returns true for the character datatypes
+func isCharType(dataType int) bool {
+	switch dataType {
+	case bp.Char, bp.Varchar, bp.Text, bp.NChar, bp.NVarchar, bp.NText:
+		return true
+	}
+	return false
+}
+
+// columnCollation returns the comparison semantics of the (column or
+// database) collation for a character column
+func columnCollation(c bp.TableColumn, v params) (ci bp.CollationInfo, ok bool) {
+	if !v.collations || !isCharType(c.DataType) {
+		return ci, false
+	}
+	name := c.Collation
+	if name == "" {
+		name = v.dbCollation
+	}
+	if name == "" {
+		return ci, false
+	}
+	ci = bp.ParseCollation(name)
+	return ci, !ci.IsCaseSensitive || !ci.IsAccentSensitive
+}
+
+// pgCollationName returns the name of the ICU collation for a case
+// and/or accent insensitive collation
+func pgCollationName(ci bp.CollationInfo) string {
+	switch {
+	case !ci.IsCaseSensitive && ci.IsAccentSensitive:
+		return "ci_as"
+	case !ci.IsCaseSensitive:
+		return "ci_ai"
+	}
+	return "cs_ai"
+}
+
+// collateClause returns the column type, with the COLLATE clause, for
+// the case and/or accent insensitive columns (when mapping collations).
+// As the Pg and Oracle defaults are case and accent sensitive nothing is
+// returned for case and accent sensitive (or binary) collations.
+func collateClause(c bp.TableColumn, v params) (colType, note string) {
+
+	ci, ok := columnCollation(c, v)
+	if !ok {
+		return "", ""
+	}
+
+	baseType := convDatatype(c.DtStr, c.Length, c.Precision, c.Scale, v.dbDialect)
+
+	switch v.dbDialect.Dialect() {
+	case dialect.PostgreSQL:
+		if v.citext && !ci.IsCaseSensitive {
+			if !ci.IsAccentSensitive {
+				note = fmt.Sprintf("citext does not support the accent insensitivity of %s", ci.Name)
+			}
+			return "citext", note
+		}
+		return fmt.Sprintf("%s COLLATE %s", baseType, pgCollationName(ci)), ""
+
+	case dialect.Oracle:
+		switch {
+		case !ci.IsCaseSensitive && ci.IsAccentSensitive:
+			return baseType + " COLLATE BINARY_CI", ""
+		case !ci.IsCaseSensitive:
+			return baseType + " COLLATE BINARY_AI", ""
+		}
+		return "", fmt.Sprintf("there is no case sensitive, accent insensitive equivalent for %s", ci.Name)
+	}
+	return "", ""
+}
+
+// mkCollationDDL writes the ICU collation (or citext extension) creation
+// DDL needed for the case and/or accent insensitive columns (Pg only)
+func mkCollationDDL(v params, model bp.ExtractedModel, tables []string) {
+
+	if !v.collations || v.dbDialect.Dialect() != dialect.PostgreSQL {
+		return
+	}
+
+	needed := make(map[string]bool)
+	useCitext := false
+	for _, table := range tables {
+		t, ok := model.Tables[table]
+		if !ok {
+			continue
+		}
+		for _, c := range t.Columns {
+			ci, ok := columnCollation(c, v)
+			if !ok {
+				continue
+			}
+			if v.citext && !ci.IsCaseSensitive {
+				useCitext = true
+			} else {
+				needed[pgCollationName(ci)] = true
+			}
+		}
+	}
+
+	if useCitext {
+		fmt.Print("CREATE EXTENSION IF NOT EXISTS citext ;\n\n")
+	}
+
+	var names []string
+	for name := range needed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("CREATE COLLATION IF NOT EXISTS %s ( provider = icu, locale = '%s', deterministic = false ) ;\n", name, icuCollations[name])
+	}
+	if len(names) > 0 {
+		fmt.Print("\n")
+	}
+}
+
+// mkTypeDDL writes the DDL for the user defined types. For Pg the alias
+// types that are not nullable become domains and the table types become
+// composite types. The CLR types, which have no equivalent, are noted.
+func mkTypeDDL(v params, model bp.ExtractedModel) {
+
+	var clrNames []string
+	for k := range model.ClrTypes {
+		clrNames = append(clrNames, k)
+	}
+	sort.Strings(clrNames)
+	for _, k := range clrNames {
+		ct := model.ClrTypes[k]
+		fmt.Printf("-- NB %s is a CLR type (%s from %s) and is not created\n", k, ct.ClassName, ct.Assembly)
+	}
+	if len(clrNames) > 0 {
+		fmt.Print("\n")
+	}
+
+	if v.dbDialect.Dialect() != dialect.PostgreSQL {
+		return
+	}
+
+	// The alias types that are not nullable become domains, which are
+	// then used for the columns of those types (see isDomain)
+	var utNames []string
+	for k, ut := range model.UserTypes {
+		if !ut.IsNullable && !ut.IsClrType {
+			utNames = append(utNames, k)
+		}
+	}
+	sort.Strings(utNames)
+	for _, k := range utNames {
+		ut := model.UserTypes[k]
+		typ := convDatatype(ut.DtStr, ut.Length, ut.Precision, ut.Scale, v.dbDialect)
+		fmt.Printf("CREATE DOMAIN %s AS %s NOT NULL ;\n\n", formatQN(k, v.dbDialect), typ)
+	}
+
+	var ttNames []string
+	for k := range model.TableTypes {
+		ttNames = append(ttNames, k)
+	}
+	sort.Strings(ttNames)
+	for _, k := range ttNames {
+		tt := model.TableTypes[k]
+		var cols []string
+		for _, c := range tt.Columns {
+			if c.IsComputed {
+				continue
+			}
+			cols = append(cols, formatIdent(c.ColName, v.dbDialect)+" "+convDatatype(c.DtStr, c.Length, c.Precision, c.Scale, v.dbDialect))
+		}
+		fmt.Printf("-- NB the table type %s is created as a composite type (without the constraints)\n", k)
+		fmt.Printf("CREATE TYPE %s AS (\n    %s ) ;\n\n", formatQN(k, v.dbDialect), strings.Join(cols, ",\n    "))
+	}
+}
+
+// isDomain returns true if the column is of an alias type that is
+// created as a domain by mkTypeDDL
+func isDomain(c bp.TableColumn, model bp.ExtractedModel, dbDialect dialect.DbDialect) bool {
+	if c.UserType == "" || dbDialect.Dialect() != dialect.PostgreSQL {
+		return false
+	}
+	ut, ok := model.UserTypes[c.UserType]
+	return ok && !ut.IsNullable && !ut.IsClrType
+}
+
+// formatQN formats a (schema.name) qualified name
+func formatQN(qn string, dbDialect dialect.DbDialect) string {
+	tokens := strings.SplitN(qn, ".", 2)
+	if len(tokens) < 2 {
+		return formatIdent(qn, dbDialect)
+	}
+	return formatIdent(tokens[0], dbDialect) + "." + formatIdent(tokens[1], dbDialect)
+}
+
+// columnNotes generates the notes for the sparse, FILESTREAM, and column
+// set columns of a table
+func columnNotes(t bp.Table) (notes []string) {
+	for _, c := range t.Columns {
+		qn := fmt.Sprintf("%s.%s.%s", t.Schema, t.TabName, c.ColName)
+		switch {
+		case c.IsColumnSet:
+			notes = append(notes, fmt.Sprintf("-- NB %s is the column set for the sparse columns and is not created\n", qn))
+		case c.IsFileStream:
+			notes = append(notes, fmt.Sprintf("-- NB %s was a FILESTREAM column, the data is not in the bacpac\n", qn))
+		case c.IsSparse:
+			notes = append(notes, fmt.Sprintf("-- NB %s was a SPARSE column\n", qn))
+		case c.IsClrType:
+			notes = append(notes, fmt.Sprintf("-- NB %s is of the CLR type %s, the data cannot be extracted\n", qn, c.DtStr))
+		case c.DataType == bp.SQLVariant:
+			notes = append(notes, fmt.Sprintf("-- NB %s was a sql_variant column, the values are the text form of the value (or JSON objects with the base type when extracted with -variantjson)\n", qn))
+		}
+	}
+	return notes
+}
+
+// pairTemporal orders the tables so that the history table for a
+// temporal table immediately follows the temporal table. The history
+// table is added when only the temporal table is requested, and is
+// dropped when the history tables are not extracted as tables of their
+// own (-history exclude or combine).
+func pairTemporal(tables []string, model bp.ExtractedModel) (paired []string) {
+
+	requested := make(map[string]bool)
+	for _, table := range tables {
+		requested[table] = true
+	}
+
+	done := make(map[string]bool)
+	for _, table := range tables {
+		if done[table] {
+			continue
+		}
+		t, ok := model.Tables[table]
+		if ok && t.IsHistoryTable && (requested[t.TemporalTable] || !t.IsExtracted()) {
+			continue
+		}
+		paired = append(paired, table)
+		done[table] = true
+
+		if ok && t.IsSystemVersioned && !done[t.HistoryTable] {
+			if h, ok := model.Tables[t.HistoryTable]; ok && h.IsExtracted() {
+				paired = append(paired, t.HistoryTable)
+				done[t.HistoryTable] = true
+			}
+		}
+	}
+	return paired
+}
+
+// isCombined returns true for the temporal tables that have the data for
+// the history table appended to their data (-history combine)
+func isCombined(t bp.Table, model bp.ExtractedModel, v params) bool {
+	if v.history != bp.HistoryCombine || !t.IsSystemVersioned {
+		return false
+	}
+	_, ok := model.Tables[t.HistoryTable]
+	return ok
+}
+
+// temporalNotes generates the notes for temporal (system-versioned),
+// history, and memory-optimized tables
+func temporalNotes(t bp.Table, v params) (notes []string) {
+
+	tabName := t.Schema + "." + t.TabName
+
+	if t.IsSystemVersioned {
+		notes = append(notes, fmt.Sprintf("-- NB %s is a system-versioned (temporal) table with the period columns %s and %s and the history table %s\n", tabName, t.PeriodStart, t.PeriodEnd, t.HistoryTable))
+		switch v.dbDialect.Dialect() {
+		case dialect.PostgreSQL:
+			if !v.versioning {
+				notes = append(notes, "--     the period columns are plain columns (see the -versioning option for a trigger-based versioning template)\n")
+			}
+		case dialect.Oracle:
+			notes = append(notes, "--     the period columns are plain columns (consider a Flashback Data Archive for the versioning)\n")
+		}
+	}
+	if t.IsHistoryTable {
+		notes = append(notes, fmt.Sprintf("-- NB %s is the history table for %s\n", tabName, t.TemporalTable))
+	}
+	if t.IsMemoryOptimized {
+		notes = append(notes, fmt.Sprintf("-- NB %s was memory-optimized (DURABILITY = %s)\n", tabName, t.Durability))
+	}
+	return notes
+}
+
+// versioningDDL generates a trigger-based system versioning template
+// (Pg only). On update or delete the old row is copied to the history
+// table with the period end set to the current time, and inserted or
+// updated rows get a new period start.
+func versioningDDL(t, h bp.Table, dbDialect dialect.DbDialect) string {
+
+	hCols := make(map[string]bool)
+	for _, c := range h.Columns {
+		hCols[strings.ToLower(c.ColName)] = true
+	}
+
+	var cols, vals []string
+	for _, c := range t.Columns {
+		if c.IsComputed || !hCols[strings.ToLower(c.ColName)] {
+			continue
+		}
+		col := formatIdent(c.ColName, dbDialect)
+		cols = append(cols, col)
+		if c.ColName == t.PeriodEnd {
+			vals = append(vals, "now ()")
+		} else {
+			vals = append(vals, "OLD."+col)
+		}
+	}
+
+	tabName := fmt.Sprintf("%s.%s", formatIdent(t.Schema, dbDialect), formatIdent(t.TabName, dbDialect))
+	histName := fmt.Sprintf("%s.%s", formatIdent(h.Schema, dbDialect), formatIdent(h.TabName, dbDialect))
+	fcnName := fmt.Sprintf("%s.%s", formatIdent(t.Schema, dbDialect), formatIdent(t.TabName+"_versioning", dbDialect))
+	trigName := formatIdent(t.TabName+"_versioning", dbDialect)
+	pStart := formatIdent(t.PeriodStart, dbDialect)
+	pEnd := formatIdent(t.PeriodEnd, dbDialect)
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("-- TODO: review the system versioning for %s.%s (history in %s.%s)\n", t.Schema, t.TabName, h.Schema, h.TabName))
+	sb.WriteString(fmt.Sprintf("CREATE OR REPLACE FUNCTION %s ()\n", fcnName))
+	sb.WriteString("RETURNS trigger\nLANGUAGE plpgsql\nAS $$\nBEGIN\n")
+	sb.WriteString("    IF TG_OP IN ( 'UPDATE', 'DELETE' ) THEN\n")
+	sb.WriteString(fmt.Sprintf("        INSERT INTO %s (\n                %s )\n", histName, strings.Join(cols, ",\n                ")))
+	sb.WriteString(fmt.Sprintf("            VALUES (\n                %s ) ;\n", strings.Join(vals, ",\n                ")))
+	sb.WriteString("    END IF ;\n")
+	sb.WriteString("    IF TG_OP = 'DELETE' THEN\n        RETURN OLD ;\n    END IF ;\n")
+	sb.WriteString(fmt.Sprintf("    NEW.%s := now () ;\n", pStart))
+	sb.WriteString(fmt.Sprintf("    NEW.%s := '9999-12-31 23:59:59.999999' ;\n", pEnd))
+	sb.WriteString("    RETURN NEW ;\nEND ;\n$$ ;\n\n")
+	sb.WriteString(fmt.Sprintf("CREATE TRIGGER %s\n", trigName))
+	sb.WriteString(fmt.Sprintf("    BEFORE INSERT OR UPDATE OR DELETE ON %s\n", tabName))
+	sb.WriteString(fmt.Sprintf("    FOR EACH ROW EXECUTE FUNCTION %s () ;\n\n", fcnName))
+	return sb.String()
+}
+
+// partitionNotes generates the notes for partitioned tables
+func partitionNotes(t bp.Table, dbDialect dialect.DbDialect) (notes []string) {
+
+	if !t.IsPartitioned() {
+		return notes
+	}
+
+	pf := t.PartitionFunc
+	rangeType := "LEFT"
+	if pf.IsRangeRight {
+		rangeType = "RIGHT"
+	}
+	notes = append(notes, fmt.Sprintf("-- NB %s.%s is partitioned on %s (%s RANGE %s, %d partitions)\n", t.Schema, t.TabName, t.PartitionColumn, pf.Name, rangeType, t.PartitionCount()))
+
+	switch dbDialect.Dialect() {
+	case dialect.PostgreSQL, dialect.Oracle:
+		if !pf.IsRangeRight {
+			notes = append(notes, "--     the boundary values belong to the lower partition (RANGE LEFT) in SQL Server and to the upper partition here\n")
+		}
+		if dbDialect.Dialect() == dialect.PostgreSQL && len(t.PK.Columns) > 0 && !containsFold(t.PK.Columns, t.PartitionColumn) {
+			notes = append(notes, "--     the primary key does not include the partitioning column, which Pg requires\n")
+		}
+	default:
+		notes = append(notes, "--     the partitioning is not supported for the Std dialect\n")
+	}
+	return notes
+}
+
+// partitionClause generates the PARTITION BY clause for partitioned
+// tables. Oracle uses interval partitioning when the boundaries are
+// evenly spaced and range partitioning otherwise.
+func partitionClause(t bp.Table, dbDialect dialect.DbDialect) string {
+
+	if !t.IsPartitioned() {
+		return ""
+	}
+
+	pf := t.PartitionFunc
+	col := formatIdent(t.PartitionColumn, dbDialect)
+
+	switch dbDialect.Dialect() {
+	case dialect.PostgreSQL:
+		return fmt.Sprintf("\n    PARTITION BY RANGE ( %s )", col)
+
+	case dialect.Oracle:
+		var sb strings.Builder
+		sb.WriteString(fmt.Sprintf("\n    PARTITION BY RANGE ( %s )", col))
+		interval := partitionInterval(pf)
+		if interval != "" {
+			sb.WriteString(fmt.Sprintf("\n    INTERVAL ( %s )", interval))
+		}
+		sb.WriteString(" (")
+		for i, b := range pf.Boundaries {
+			if i > 0 {
+				sb.WriteString(",")
+			}
+			sb.WriteString(fmt.Sprintf("\n        PARTITION p%d VALUES LESS THAN ( %s )", i+1, boundaryLiteral(b, pf.DtStr, dbDialect)))
+		}
+		if interval == "" {
+			if len(pf.Boundaries) > 0 {
+				sb.WriteString(",")
+			}
+			sb.WriteString(fmt.Sprintf("\n        PARTITION p%d VALUES LESS THAN ( MAXVALUE )", len(pf.Boundaries)+1))
+		}
+		sb.WriteString(" )")
+		return sb.String()
+	}
+	return ""
+}
+
+// partitionDDL generates the child partition tables for partitioned
+// tables (Pg only). Tables with a nullable partitioning column also get
+// a default partition for the null values.
+func partitionDDL(t bp.Table, dbDialect dialect.DbDialect) string {
+
+	if !t.IsPartitioned() || dbDialect.Dialect() != dialect.PostgreSQL {
+		return ""
+	}
+
+	pf := t.PartitionFunc
+	schema := formatIdent(t.Schema, dbDialect)
+	parent := fmt.Sprintf("%s.%s", schema, formatIdent(t.TabName, dbDialect))
+
+	var sb strings.Builder
+	lower := "MINVALUE"
+	for i := 0; i <= len(pf.Boundaries); i++ {
+		upper := "MAXVALUE"
+		if i < len(pf.Boundaries) {
+			upper = boundaryLiteral(pf.Boundaries[i], pf.DtStr, dbDialect)
+		}
+		child := formatIdent(fmt.Sprintf("%s_p%d", t.TabName, i+1), dbDialect)
+		sb.WriteString(fmt.Sprintf("CREATE TABLE %s.%s PARTITION OF %s\n    FOR VALUES FROM ( %s ) TO ( %s ) ;\n", schema, child, parent, lower, upper))
+		lower = upper
+	}
+
+	for _, c := range t.Columns {
+		if c.ColName == t.PartitionColumn && c.IsNullable {
+			child := formatIdent(t.TabName+"_default", dbDialect)
+			sb.WriteString(fmt.Sprintf("CREATE TABLE %s.%s PARTITION OF %s DEFAULT ;\n", schema, child, parent))
+		}
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// isPartitionTime returns true for the date/time partitioning datatypes
+func isPartitionTime(dtStr string) bool {
+	switch dtStr {
+	case "date", "datetime", "datetime2", "smalldatetime":
+		return true
+	}
+	return false
+}
+
+// boundaryLiteral formats a partition boundary value as a literal
+func boundaryLiteral(b, dtStr string, dbDialect dialect.DbDialect) string {
+
+	switch dtStr {
+	case "bigint", "int", "smallint", "tinyint", "decimal", "numeric", "float", "real", "money", "smallmoney":
+		return b
+	}
+
+	if isPartitionTime(dtStr) {
+		if ts, ok := bp.ParseBoundaryTime(b); ok {
+			if dtStr == "date" {
+				b = ts.Format("2006-01-02")
+				if dbDialect.Dialect() == dialect.Oracle {
+					return "DATE " + quoteLiteral(b)
+				}
+				return quoteLiteral(b)
+			}
+			b = ts.Format("2006-01-02 15:04:05.999999999")
+			if dbDialect.Dialect() == dialect.Oracle {
+				return "TIMESTAMP " + quoteLiteral(b)
+			}
+		}
+	}
+	return quoteLiteral(b)
+}
+
+// partitionInterval returns the Oracle interval expression for evenly
+// spaced (daily, monthly, yearly, or integer) boundaries, if any
+func partitionInterval(pf bp.PartitionFunction) string {
+
+	if len(pf.Boundaries) < 2 || !pf.IsRangeRight {
+		return ""
+	}
+
+	if isPartitionTime(pf.DtStr) {
+		var times []time.Time
+		for _, b := range pf.Boundaries {
+			ts, ok := bp.ParseBoundaryTime(b)
+			if !ok {
+				return ""
+			}
+			times = append(times, ts)
+		}
+
+		steps := []struct {
+			years, months, days int
+			interval            string
+		}{
+			{0, 0, 1, "NUMTODSINTERVAL ( 1, 'DAY' )"},
+			{0, 1, 0, "NUMTOYMINTERVAL ( 1, 'MONTH' )"},
+			{0, 3, 0, "NUMTOYMINTERVAL ( 3, 'MONTH' )"},
+			{1, 0, 0, "NUMTOYMINTERVAL ( 1, 'YEAR' )"},
+		}
+		for _, step := range steps {
+			even := true
+			for i := 1; i < len(times); i++ {
+				if !times[i-1].AddDate(step.years, step.months, step.days).Equal(times[i]) {
+					even = false
+					break
+				}
+			}
+			if even {
+				return step.interval
+			}
+		}
+		return ""
+	}
+
+	switch pf.DtStr {
+	case "bigint", "int", "smallint", "tinyint":
+		var prev, step int64
+		for i, b := range pf.Boundaries {
+			n, err := strconv.ParseInt(b, 10, 64)
+			if err != nil {
+				return ""
+			}
+			if i == 1 {
+				step = n - prev
+			}
+			if i > 1 && n-prev != step {
+				return ""
+			}
+			prev = n
+		}
+		if step > 0 {
+			return strconv.FormatInt(step, 10)
+		}
+	}
+	return ""
+}
+
+// containsFold returns true if the list contains the string, ignoring case
+func containsFold(l []string, s string) bool {
+	for _, x := range l {
+		if strings.EqualFold(x, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// commentDDL generates the COMMENT ON DDL for the table and column
+// descriptions (Pg and Oracle only)
+func commentDDL(t bp.Table, dbDialect dialect.DbDialect) string {
+
+	switch dbDialect.Dialect() {
+	case dialect.PostgreSQL, dialect.Oracle:
+	default:
+		return ""
+	}
+
+	var sb strings.Builder
+	tabName := fmt.Sprintf("%s.%s", formatIdent(t.Schema, dbDialect), formatIdent(t.TabName, dbDialect))
+
+	if t.Description != "" {
+		sb.WriteString(fmt.Sprintf("COMMENT ON TABLE %s IS %s ;\n", tabName, quoteLiteral(t.Description)))
+	}
+	for _, c := range t.Columns {
+		if c.Description != "" {
+			sb.WriteString(fmt.Sprintf("COMMENT ON COLUMN %s.%s IS %s ;\n", tabName, formatIdent(c.ColName, dbDialect), quoteLiteral(c.Description)))
+		}
+	}
+	if sb.Len() > 0 {
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// quoteLiteral quotes a string literal
+func quoteLiteral(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// mkSchemaDDL writes the schema creation DDL for the schemas of the
+// tables. When generating the DDL for all tables then the schemas for
+// the other objects are also created.
+func mkSchemaDDL(v params, model bp.ExtractedModel, tables []string, all bool) {
+
+	schemas := make(map[string]bool)
+	for _, table := range tables {
+		if t, ok := model.Tables[table]; ok {
+			schemas[t.Schema] = true
+		}
+	}
+	if all {
+		for name := range model.Schemas {
+			schemas[name] = true
+		}
+		for _, s := range model.Sequences {
+			schemas[s.Schema] = true
+		}
+		for _, s := range model.Synonyms {
+			schemas[s.Schema] = true
+		}
+	}
+
+	var names []string
+	for name := range schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if len(names) > 0 && v.dbDialect.Dialect() == dialect.Oracle {
+		fmt.Print("-- NB Oracle schemas are users, these are created as schema only (no authentication) accounts\n")
+	}
+
+	for _, name := range names {
+		if owner := model.Schemas[name].Owner; owner != "" && owner != "dbo" {
+			fmt.Printf("-- The %s schema was owned by %s\n", name, owner)
+		}
+		switch v.dbDialect.Dialect() {
+		case dialect.PostgreSQL:
+			fmt.Printf("CREATE SCHEMA IF NOT EXISTS %s ;\n", formatIdent(name, v.dbDialect))
+		case dialect.Oracle:
+			fmt.Printf("CREATE USER %s NO AUTHENTICATION ;\n", formatIdent(name, v.dbDialect))
+		default:
+			fmt.Printf("CREATE SCHEMA %s ;\n", formatIdent(name, v.dbDialect))
+		}
+	}
+	if len(names) > 0 {
+		fmt.Print("\n")
+	}
+}
+
+// mkSequenceDDL writes the sequence creation DDL
+func mkSequenceDDL(v params, model bp.ExtractedModel) {
+
+	var names []string
+	for name := range model.Sequences {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Print(sequenceDDL(model.Sequences[name], v.dbDialect))
+	}
+}
+
+// sequenceDDL generates the DDL for creating a sequence. Pg only
+// supports integer sequences so the datatype is omitted (bigint) for
+// decimal and numeric sequences.
+func sequenceDDL(s bp.Sequence, dbDialect dialect.DbDialect) string {
+
+	d := dbDialect.Dialect()
+	var opts []string
+
+	switch d {
+	case dialect.PostgreSQL:
+		switch s.DtStr {
+		case "tinyint", "smallint":
+			opts = append(opts, "AS smallint")
+		case "int":
+			opts = append(opts, "AS integer")
+		case "bigint":
+			opts = append(opts, "AS bigint")
+		}
+	case dialect.StandardSQL:
+		opts = append(opts, "AS "+convDatatype(s.DtStr, 0, 38, 0, dbDialect))
+	}
+
+	opts = append(opts, "START WITH "+s.StartValue, "INCREMENT BY "+s.Increment)
+
+	no := "NO "
+	if d == dialect.Oracle {
+		no = "NO"
+	}
+	if s.MinValue != "" {
+		opts = append(opts, "MINVALUE "+s.MinValue)
+	} else {
+		opts = append(opts, no+"MINVALUE")
+	}
+	if s.MaxValue != "" {
+		opts = append(opts, "MAXVALUE "+s.MaxValue)
+	} else {
+		opts = append(opts, no+"MAXVALUE")
+	}
+	if s.IsCycling {
+		opts = append(opts, "CYCLE")
+	} else {
+		opts = append(opts, no+"CYCLE")
+	}
+
+	switch {
+	case d == dialect.StandardSQL:
+	case s.NoCache && d == dialect.Oracle:
+		opts = append(opts, "NOCACHE")
+	case s.NoCache:
+		opts = append(opts, "CACHE 1")
+	case s.CacheSize != "":
+		opts = append(opts, "CACHE "+s.CacheSize)
+	}
+
+	return fmt.Sprintf("CREATE SEQUENCE %s.%s\n    %s ;\n\n", formatIdent(s.Schema, dbDialect), formatIdent(s.Name, dbDialect), strings.Join(opts, "\n    "))
+}
+
+// mkSynonymDDL writes the synonym DDL. Oracle supports synonyms
+// directly. For Pg and Std the synonyms for tables (or for views, when
+// generating the view DDL) are created as views and notes are written
+// for the others.
+func mkSynonymDDL(v params, model bp.ExtractedModel, forViews bool) {
+
+	var names []string
+	for name := range model.Synonyms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	create := "CREATE OR REPLACE VIEW"
+	if v.dbDialect.Dialect() == dialect.StandardSQL {
+		create = "CREATE VIEW"
+	}
+
+	for _, name := range names {
+		s := model.Synonyms[name]
+		synName := fmt.Sprintf("%s.%s", formatIdent(s.Schema, v.dbDialect), formatIdent(s.Name, v.dbDialect))
+
+		_, isTable := model.Tables[s.Target]
+		_, isView := model.Views[s.Target]
+		if v.dbDialect.Dialect() != dialect.Oracle && forViews != isView {
+			continue
+		}
+
+		var target string
+		if t := strings.SplitN(s.Target, ".", 2); len(t) == 2 && !s.IsExternal {
+			target = fmt.Sprintf("%s.%s", formatIdent(t[0], v.dbDialect), formatIdent(t[1], v.dbDialect))
+		}
+
+		switch {
+		case s.IsExternal || target == "":
+			fmt.Printf("-- NB the synonym %s is for %s, which is not in this database, and was not created\n\n", synName, s.Target)
+		case v.dbDialect.Dialect() == dialect.Oracle:
+			fmt.Printf("CREATE OR REPLACE SYNONYM %s FOR %s ;\n\n", synName, target)
+		case isTable || isView:
+			fmt.Printf("-- The synonym %s for %s\n", synName, target)
+			fmt.Printf("%s %s\nAS\nSELECT * FROM %s ;\n\n", create, synName, target)
+		case v.dbDialect.Dialect() == dialect.PostgreSQL:
+			fmt.Printf("-- NB the synonym %s is for %s, which is not a table or view. Add the schema to the search_path or reference %s directly\n\n", synName, target, target)
+		default:
+			fmt.Printf("-- NB the synonym %s is for %s, which is not a table or view. Reference %s directly\n\n", synName, target, target)
+		}
+	}
+}
+
+// topClause matches the TOP clause of the outer SELECT of a view query
+var topClause = regexp.MustCompile(`(?is)^(\s*SELECT\s+(?:DISTINCT\s+)?)TOP\s*(?:\(\s*(\d+)\s*\)|(\d+))\s+`)
+
+// tableHints matches the NOLOCK (and similar) table hints
+var tableHints = regexp.MustCompile(`(?i)\s*WITH\s*\(\s*(NOLOCK|READUNCOMMITTED|NOWAIT)\s*\)`)
+
+// mkViewScript writes the view creation DDL. The view queries are
+// translated from T-SQL on a best-effort basis and anything that could
+// not be translated is marked with TODO comments.
+func mkViewScript(v params, model bp.ExtractedModel) {
+
+	create := "CREATE OR REPLACE VIEW"
+	if v.dbDialect.Dialect() == dialect.StandardSQL {
+		create = "CREATE VIEW"
+	}
+
+	for _, name := range orderViews(model) {
+		vw := model.Views[name]
+
+		query, ok := translateView(vw, model, v)
+		if !ok {
+			fmt.Printf("-- TODO: review the translation of view %s.%s\n", vw.Schema, vw.Name)
+		}
+		fmt.Printf("%s %s.%s\nAS\n%s ;\n\n", create, formatIdent(vw.Schema, v.dbDialect), formatIdent(vw.Name, v.dbDialect), query)
+	}
+
+	// For Pg and Std the synonyms for views become views of the views
+	if v.dbDialect.Dialect() != dialect.Oracle {
+		mkSynonymDDL(v, model, true)
+	}
+}
+
+// orderViews returns the names of the views sorted such that each view
+// follows the views that it depends on
+func orderViews(model bp.ExtractedModel) (ordered []string) {
+
+	var names []string
+	for name := range model.Views {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	done := make(map[string]bool)
+	visiting := make(map[string]bool)
+
+	var visit func(name string)
+	visit = func(name string) {
+		if done[name] {
+			return
+		}
+		if visiting[name] {
+			fmt.Printf("-- WARNING: circular dependency for view %s\n", name)
+			return
+		}
+		visiting[name] = true
+		for _, dep := range model.Views[name].Dependencies {
+			if _, ok := model.Views[dep]; ok && dep != name {
+				visit(dep)
+			}
+		}
+		visiting[name] = false
+		done[name] = true
+		ordered = append(ordered, name)
+	}
+
+	for _, name := range names {
+		visit(name)
+	}
+	return ordered
+}
+
+// translateView translates the query for a view. The TOP clause of the
+// outer SELECT becomes a LIMIT (Pg) or FETCH FIRST (Oracle, Std) clause
+// and table hints are dropped.
+func translateView(vw bp.View, model bp.ExtractedModel, v params) (s string, ok bool) {
+
+	x := exprTranslator{dbDialect: v.dbDialect, bitCols: make(map[string]bool), schemas: v.schemas, query: true}
+	for _, cd := range vw.ColumnDeps {
+		i := strings.LastIndex(cd, ".")
+		t, found := model.Tables[cd[:i]]
+		if !found {
+			continue
+		}
+		for _, c := range t.Columns {
+			if c.DataType == bp.Bit && c.ColName == cd[i+1:] {
+				x.bitCols[strings.ToLower(c.ColName)] = true
+			}
+		}
+	}
+
+	query := strings.TrimRight(strings.TrimSpace(vw.Query), ";")
+	query = tableHints.ReplaceAllString(query, "")
+
+	var limit string
+	if m := topClause.FindStringSubmatch(query); m != nil {
+		rest := strings.ToUpper(query[len(m[0]):])
+		if !strings.HasPrefix(rest, "PERCENT") && !strings.HasPrefix(rest, "WITH TIES") {
+			limit = m[2] + m[3]
+			query = m[1] + query[len(m[0]):]
+		}
+	}
+
+	s, ok = x.translate(query)
+
+	if limit != "" {
+		switch v.dbDialect.Dialect() {
+		case dialect.PostgreSQL:
+			s += "\nLIMIT " + limit
+		default:
+			s += "\nFETCH FIRST " + limit + " ROWS ONLY"
+		}
+	}
+	return s, ok
+}
+
+// mkIndexScript writes the index creation DDL to the index file. The
+// indexes are kept separate from the table DDL so that they can be
+// created after the data is loaded.
+//
+// SQL Server index names only need to be unique per table while Pg and
+// Oracle index names need to be unique per schema so the indexes having
+// names that are used on more than one table of the schema are prefixed
+// with the table name. The index names also share the namespace with
+// the primary key and unique constraints (which are backed by indexes
+// of the same name) and are limited in length, so the renamed, and
+// overly long, names are shortened and made unique as needed.
+func mkIndexScript(v params, model bp.ExtractedModel, tables []string) {
+
+	f := openOutput(v.indexFile)
+	defer deferredClose(f)
+	w := bufio.NewWriter(f)
+
+	maxLen := maxIdentLen(v.dbDialect)
+	nameKey := func(schema, name string) string {
+		return strings.ToLower(schema + "." + name)
+	}
+
+	nameCount := make(map[string]int)
+	for _, t := range model.Tables {
+		for _, ix := range t.Indexes {
+			nameCount[nameKey(t.Schema, ix.IdxName)]++
+		}
+	}
+
+	// The names that the renamed indexes need to avoid
+	used := make(map[string]bool)
+	for _, t := range model.Tables {
+		if len(t.PK.Columns) > 0 {
+			used[nameKey(t.Schema, "pk_"+t.TabName)] = true
+		}
+		for _, c := range t.Unique {
+			used[nameKey(t.Schema, c.ConsName)] = true
+		}
+		for _, ix := range t.Indexes {
+			if nameCount[nameKey(t.Schema, ix.IdxName)] == 1 && (maxLen == 0 || len(ix.IdxName) <= maxLen) {
+				used[nameKey(t.Schema, ix.IdxName)] = true
+			}
+		}
+	}
+
+	for _, table := range tables {
+		t, ok := model.Tables[table]
+		if !ok {
+			continue
+		}
+
+		x := newExprTranslator(t, v)
+		combined := isCombined(t, model, v)
+		for _, ix := range t.Indexes {
+			if ix.IsUnique && combined {
+				w.WriteString(fmt.Sprintf("-- NB unique index %s on %s.%s is created as non-unique as the history data is combined with the table data (-history combine)\n", ix.IdxName, t.Schema, t.TabName))
+				ix.IsUnique = false
+			}
+			var reason string
+			name := ix.IdxName
+			switch {
+			case nameCount[nameKey(t.Schema, ix.IdxName)] > 1:
+				name = t.TabName + "_" + ix.IdxName
+				reason = "the name is used on more than one table"
+				if maxLen > 0 && len(name) > maxLen {
+					reason += fmt.Sprintf(" (shortened as it is longer than %d bytes)", maxLen)
+				}
+			case maxLen > 0 && len(ix.IdxName) > maxLen:
+				reason = fmt.Sprintf("the name is longer than %d bytes", maxLen)
+			}
+			if reason != "" {
+				name = uniqueIdent(name, maxLen, func(n string) bool { return used[nameKey(t.Schema, n)] })
+				used[nameKey(t.Schema, name)] = true
+				w.WriteString(fmt.Sprintf("-- NB index %s on %s.%s is renamed to %s as %s\n", ix.IdxName, t.Schema, t.TabName, name, reason))
+				ix.IdxName = name
+			}
+			w.WriteString(indexDDL(t, ix, x, v.dbDialect))
+		}
+	}
+
+	err := w.Flush()
+	dieOnErr(err)
+}
+
+// maxIdentLen returns the maximum length, in bytes, of an identifier for
+// the dialect (Oracle 12.2 or later for Oracle), or 0 for no limit
+func maxIdentLen(dbDialect dialect.DbDialect) int {
+	switch dbDialect.Dialect() {
+	case dialect.PostgreSQL:
+		return 63
+	case dialect.Oracle:
+		return 128
+	}
+	return 0
+}
+
+// uniqueIdent returns name, shortened to maxLen bytes (when maxLen is
+// not 0) and made unique by appending a number. Names that are too long
+// are truncated and suffixed with a hash of the full name so that
+// distinct long names remain distinct.
+func uniqueIdent(name string, maxLen int, isUsed func(string) bool) string {
+
+	if maxLen > 0 && len(name) > maxLen {
+		h := fnv.New32a()
+		h.Write([]byte(name))
+		sfx := fmt.Sprintf("_%08x", h.Sum32())
+		name = truncateBytes(name, maxLen-len(sfx)) + sfx
+	}
+
+	ident := name
+	for i := 2; isUsed(ident); i++ {
+		sfx := fmt.Sprintf("_%d", i)
+		ident = name + sfx
+		if maxLen > 0 && len(ident) > maxLen {
+			ident = truncateBytes(name, maxLen-len(sfx)) + sfx
+		}
+	}
+	return ident
+}
+
+// truncateBytes truncates s to at most n bytes without splitting a
+// multi-byte character
+func truncateBytes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// indexDDL generates the DDL for creating an index. Pg supports included
+// columns and filtered (partial) indexes directly. For Oracle the
+// included columns of non-unique indexes are appended to the index keys
+// and filtered indexes become function-based indexes that only index
+// the rows matching the filter.
+func indexDDL(t bp.Table, ix bp.Index, x exprTranslator, dbDialect dialect.DbDialect) string {
+
+	d := dbDialect.Dialect()
+	tabName := fmt.Sprintf("%s.%s", formatIdent(t.Schema, dbDialect), formatIdent(t.TabName, dbDialect))
+	idxName := formatIdent(ix.IdxName, dbDialect)
+
+	var notes []string
+
+	var filter string
+	if ix.Filter != "" {
+		var ok bool
+		if d == dialect.StandardSQL {
+			return fmt.Sprintf("-- WARNING: filtered index %s on %s.%s is not supported: %s\n\n", ix.IdxName, t.Schema, t.TabName, ix.Filter)
+		}
+		filter, ok = x.translate(unwrapParens(ix.Filter))
+		if !ok {
+			return fmt.Sprintf("-- WARNING: could not translate the filter for index %s on %s.%s: %s\n\n", ix.IdxName, t.Schema, t.TabName, ix.Filter)
+		}
+	}
+
+	keyExpr := func(col string) string {
+		k := formatIdent(col, dbDialect)
+		if filter != "" && d == dialect.Oracle {
+			k = fmt.Sprintf("CASE WHEN %s THEN %s END", filter, k)
+		}
+		return k
+	}
+
+	var keys []string
+	for _, c := range ix.Columns {
+		k := keyExpr(c.ColName)
+		if c.IsDescending {
+			k += " DESC"
+		}
+		keys = append(keys, k)
+	}
+
+	var include string
+	if len(ix.Included) > 0 {
+		switch {
+		case d == dialect.PostgreSQL:
+			include = fmt.Sprintf(" INCLUDE ( %s )", joinCols(ix.Included, dbDialect))
+		case d == dialect.Oracle && !ix.IsUnique:
+			for _, c := range ix.Included {
+				keys = append(keys, keyExpr(c))
+			}
+		default:
+			notes = append(notes, fmt.Sprintf("-- NB the included columns ( %s ) of index %s are not supported and have been omitted\n", strings.Join(ix.Included, ", "), ix.IdxName))
+		}
+	}
+
+	var where string
+	if filter != "" {
+		switch d {
+		case dialect.PostgreSQL:
+			where = " WHERE " + filter
+		case dialect.Oracle:
+			notes = append(notes, fmt.Sprintf("-- NB index %s was filtered ( %s ), queries need to use the CASE expressions to use the index\n", ix.IdxName, ix.Filter))
+		}
+	}
 
-	p, _ := bp.New(v.baseDir)
+	unique := ""
+	if ix.IsUnique {
+		unique = "UNIQUE "
+	}
 
-	model, err := p.GetModel("")
-	dieOnErrf("GetModel failed: %q", err)
+	var sb strings.Builder
+	for _, n := range notes {
+		sb.WriteString(n)
+	}
+	sb.WriteString(fmt.Sprintf("CREATE %sINDEX %s ON %s ( %s )%s%s ;\n", unique, idxName, tabName, strings.Join(keys, ", "), include, where))
 
-	var tables []string
-	if v.tableName != "" {
-		tables = append(tables, v.tableName)
-	} else if v.tablesFile != "" {
+	if ix.IsClustered {
+		if d == dialect.PostgreSQL {
+			sb.WriteString(fmt.Sprintf("CLUSTER %s USING %s ;\n", tabName, idxName))
+		} else {
+			sb.WriteString(fmt.Sprintf("-- NB index %s was clustered\n", ix.IdxName))
+		}
+	}
+	sb.WriteString("\n")
 
-		content, err := ioutil.ReadFile(v.tablesFile)
-		dieOnErrf("File read failed: %q", err)
+	return sb.String()
+}
 
-		x := bytes.Split(content, []byte("\n"))
-		for _, z := range x {
-			tables = append(tables, string(z))
-		}
-	} else {
-		for t, _ := range model.Tables {
-			tables = append(tables, t)
+// computedColDef generates the column definition for a computed column.
+// Pg only supports stored generated columns and Oracle only supports
+// virtual columns so the persisted flag is not used. Computed columns
+// that are materialized, or that cannot be translated, are created as
+// plain columns along with a note containing the original expression.
+func computedColDef(t bp.Table, c bp.TableColumn, colType string, x exprTranslator, v params) (colDef, note string) {
+
+	d := v.dbDialect.Dialect()
+
+	// The model may not include the datatype for computed columns
+	if c.DtStr == "" {
+		switch d {
+		case dialect.PostgreSQL:
+			colType = "text"
+		case dialect.Oracle:
+			colType = ""
+		default:
+			colType = "character varying ( 4000 )"
 		}
-		sort.Strings(tables)
 	}
 
-	for _, table := range tables {
-		t, ok := model.Tables[table]
+	colDef = formatIdent(c.ColName, v.dbDialect)
+	if colType != "" {
+		colDef += " " + colType
+	}
 
-		if ok {
-			fmt.Printf("CREATE TABLE %s.%s (\n    ", formatIdent(t.Schema, v.dbDialect), formatIdent(t.TabName, v.dbDialect))
-			var colDefs []string
+	expr, ok := x.translate(unwrapParens(c.Expression))
 
-			for _, c := range t.Columns {
+	if !ok || v.materialize {
+		if colType == "" {
+			colDef += " varchar2 ( 4000 )"
+		}
+		if !ok {
+			note = fmt.Sprintf("-- WARNING: could not translate the computed column %s.%s.%s, created as a plain column: %s\n", t.Schema, t.TabName, c.ColName, c.Expression)
+		} else {
+			note = fmt.Sprintf("-- NB the computed column %s.%s.%s is materialized, populate it after loading the data using: %s\n", t.Schema, t.TabName, c.ColName, expr)
+		}
+		return colDef, note
+	}
 
-				colDef := formatIdent(c.ColName, v.dbDialect) + " " + convDatatype(c.DtStr, c.Length, c.Precision, c.Scale, v.dbDialect)
-				if c.IsNullable {
-					colDefs = append(colDefs, colDef)
-				} else {
-					colDefs = append(colDefs, colDef+" NOT NULL")
-				}
+	switch d {
+	case dialect.PostgreSQL:
+		colDef += fmt.Sprintf(" GENERATED ALWAYS AS ( %s ) STORED", expr)
+	case dialect.Oracle:
+		colDef += fmt.Sprintf(" GENERATED ALWAYS AS ( %s ) VIRTUAL", expr)
+	default:
+		colDef += fmt.Sprintf(" GENERATED ALWAYS AS ( %s )", expr)
+	}
 
-			}
-			fmt.Printf("%s", strings.Join(colDefs, ",\n    "))
+	if !c.IsNullable {
+		colDef += " NOT NULL"
+	}
+	return colDef, note
+}
 
-			// Primary Key
-			pkCols := joinCols(t.PK.Columns, v.dbDialect)
-			if pkCols != "" {
-				consname := fmt.Sprintf("pk_%s", t.TabName)
-				pk_name := formatIdent(consname, v.dbDialect)
-				fmt.Printf(",\n    CONSTRAINT %s PRIMARY KEY ( %s )", pk_name, pkCols)
-			}
+// fkOptions generates the referential actions and validation options for
+// a foreign key. Oracle does not support ON UPDATE actions or ON DELETE
+// SET DEFAULT so these are noted in comments. Untrusted (NOCHECK) and
+// disabled constraints are not validated against the existing data.
+func fkOptions(fk bp.ForeignKey, dbDialect dialect.DbDialect) string {
 
-			// Unique Constraints
-			for _, c := range t.Unique {
-				uCols := joinCols(c.Columns, v.dbDialect)
-				if uCols != "" {
-					consname := formatIdent(c.ConsName, v.dbDialect)
-					fmt.Printf(",\n    CONSTRAINT %s UNIQUE ( %s )", consname, uCols)
-				}
-			}
+	d := dbDialect.Dialect()
+
+	var opts []string
+	var notes []string
 
-			fmt.Print(" ) ;\n\n")
+	if fk.DeleteAction != "" && fk.DeleteAction != bp.FKNoAction {
+		if d == dialect.Oracle && fk.DeleteAction == bp.FKSetDefault {
+			notes = append(notes, "ON DELETE SET DEFAULT is not supported")
+		} else {
+			opts = append(opts, "ON DELETE "+fk.DeleteAction)
 		}
 	}
 
-	for _, table := range tables {
-		t, ok := model.Tables[table]
+	if fk.UpdateAction != "" && fk.UpdateAction != bp.FKNoAction {
+		if d == dialect.Oracle {
+			notes = append(notes, fmt.Sprintf("ON UPDATE %s is not supported", fk.UpdateAction))
+		} else {
+			opts = append(opts, "ON UPDATE "+fk.UpdateAction)
+		}
+	}
 
-		if ok {
+	switch d {
+	case dialect.PostgreSQL:
+		if fk.IsDisabled || fk.IsNotTrusted {
+			opts = append(opts, "NOT VALID")
+		}
+		if fk.IsDisabled {
+			notes = append(notes, "the constraint was disabled")
+		}
+	case dialect.Oracle:
+		if fk.IsDisabled {
+			opts = append(opts, "DISABLE NOVALIDATE")
+		} else if fk.IsNotTrusted {
+			opts = append(opts, "ENABLE NOVALIDATE")
+		}
+	default:
+		if fk.IsDisabled {
+			notes = append(notes, "the constraint was disabled")
+		} else if fk.IsNotTrusted {
+			notes = append(notes, "the constraint was not trusted (WITH NOCHECK)")
+		}
+	}
 
-			// Foreign Key Constraints
-			for _, c := range t.FKs {
+	if fk.IsNotForReplication {
+		notes = append(notes, "the constraint was NOT FOR REPLICATION")
+	}
 
-				fkCols := joinCols(c.Columns, v.dbDialect)
-				refCols := joinCols(c.RefColumns, v.dbDialect)
+	var sb strings.Builder
+	for _, o := range opts {
+		sb.WriteString("\n    " + o)
+	}
+	for _, n := range notes {
+		sb.WriteString("\n    -- NB " + n)
+	}
+	if len(notes) > 0 {
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
 
-				rt, ok2 := model.Tables[c.RefTable]
-				if ok2 {
-					fmt.Printf("ALTER TABLE %s.%s\n", formatIdent(t.Schema, v.dbDialect), formatIdent(t.TabName, v.dbDialect))
-					fmt.Printf("    ADD CONSTRAINT %s FOREIGN KEY ( %s )\n", formatIdent(c.ConsName, v.dbDialect), fkCols)
-					fmt.Printf("    REFERENCES %s.%s ( %s ) ;\n\n", formatIdent(rt.Schema, v.dbDialect), formatIdent(rt.TabName, v.dbDialect), refCols)
-				}
-			}
+// mapSchema returns the mapped name for a schema (case insensitive)
+func mapSchema(s string, schemas map[string]string) string {
+	for k, t := range schemas {
+		if strings.EqualFold(k, s) {
+			return t
 		}
 	}
+	return s
 }
 
 func joinCols(cols []string, dbDialect dialect.DbDialect) string {
@@ -200,21 +1626,26 @@ func stdType(dt string, len int) string {
 		"datetimeoffset":   "timestamp with timezone",
 		"decimal":          "decimal",
 		"float":            "float",
+		"hierarchyid":      "character varying",
+		"image":            "blob",
 		"int":              "int",
 		"money":            "decimal",
 		"nchar":            "national character",
 		"ntext":            "nclob",
 		"nvarchar":         "national character varying",
 		"real":             "real",
+		"rowversion":       "binary",
 		"smalldatetime":    "timestamp",
 		"smallint":         "smallint",
 		"smallmoney":       "decimal",
 		"text":             "clob",
 		"time":             "time",
+		"timestamp":        "binary",
 		"tinyint":          "smallint",
 		"uniqueidentifier": "uuid",
 		"varbinary":        "blob",
 		"varchar":          "character varying",
+		"xml":              "xml",
 	}
 
 	stdtype, ok := typeMap[dt]
@@ -228,6 +1659,10 @@ func stdType(dt string, len int) string {
 func stdColType(dt string, len, precision, scale int) string {
 
 	switch dt {
+	case "hierarchyid":
+		len = 4000
+	case "rowversion", "timestamp":
+		len = 8
 	case "money":
 		precision = 20
 		scale = 4
@@ -239,7 +1674,7 @@ func stdColType(dt string, len, precision, scale int) string {
 	datatype := stdType(dt, len)
 
 	switch datatype {
-	case "boolean", "blob", "clob", "smallint", "int", "bigint", "date", "time", "timestamp", "timestamp with timezone", "uuid":
+	case "boolean", "blob", "clob", "smallint", "int", "bigint", "date", "time", "timestamp", "timestamp with timezone", "uuid", "xml":
 		return datatype
 	}
 
@@ -270,21 +1705,27 @@ func pgType(dt string, len int) string {
 		"decimal":          "numeric",
 		"float":            "double precision",
 		"geography":        "varchar",
+		"hierarchyid":      "text",
+		"image":            "bytea",
 		"int":              "int",
 		"money":            "numeric",
 		"nchar":            "char",
 		"ntext":            "varchar",
 		"nvarchar":         "varchar",
 		"real":             "real",
+		"rowversion":       "bytea",
 		"smalldatetime":    "timestamp",
 		"smallint":         "smallint",
 		"smallmoney":       "numeric",
+		"sql_variant":      "text",
 		"text":             "text",
 		"time":             "time",
+		"timestamp":        "bytea",
 		"tinyint":          "smallint",
 		"uniqueidentifier": "uuid",
 		"varbinary":        "bytea",
 		"varchar":          "varchar",
+		"xml":              "xml",
 	}
 
 	pgtype, ok := typeMap[dt]
@@ -309,7 +1750,7 @@ func pgColType(dt string, len, precision, scale int) string {
 	datatype := pgType(dt, len)
 
 	switch datatype {
-	case "boolean", "bytea", "text", "smallint", "int", "bigint", "date", "time", "timestamp", "timestamp with timezone", "uuid":
+	case "boolean", "bytea", "text", "smallint", "int", "bigint", "date", "time", "timestamp", "timestamp with timezone", "uuid", "xml":
 		return datatype
 	}
 
@@ -333,26 +1774,33 @@ func oraType(dt string, len int) string {
 		"binary":           "raw",
 		"bit":              "number",
 		"char":             "char",
+		"date":             "date",
 		"datetime2":        "timestamp",
 		"datetime":         "timestamp",
 		"decimal":          "number",
 		"float":            "float",
 		"geography":        "varchar2",
+		"hierarchyid":      "varchar2",
+		"image":            "blob",
 		"int":              "number",
 		"money":            "number",
 		"nchar":            "nchar",
 		"ntext":            "nclob",
 		"nvarchar":         "nvarchar2",
 		"real":             "float",
+		"rowversion":       "raw",
 		"smalldatetime":    "date",
 		"smallint":         "number",
 		"smallmoney":       "number",
+		"sql_variant":      "clob", // the text form, or JSON with -variantjson
 		"text":             "clob",
 		"time":             "time",
+		"timestamp":        "raw",
 		"tinyint":          "number",
 		"uniqueidentifier": "uuid",
 		"varbinary":        "blob",
 		"varchar":          "varchar2",
+		"xml":              "xmltype",
 	}
 
 	oratype, ok := typeMap[dt]
@@ -383,7 +1831,7 @@ func oraColType(dt string, len, precision, scale int) string {
 		precision = 1
 	case "int":
 		precision = 10
-	case "geography":
+	case "geography", "hierarchyid":
 		len = 4000
 	case "money":
 		precision = 20
@@ -399,8 +1847,13 @@ func oraColType(dt string, len, precision, scale int) string {
 
 	datatype := oraType(dt, len)
 
+	switch dt {
+	case "rowversion", "timestamp":
+		return "raw ( 8 )"
+	}
+
 	switch datatype {
-	case "blob", "clob", "nclob", "raw", "date":
+	case "blob", "clob", "nclob", "raw", "date", "xmltype":
 		return datatype
 	case "uuid":
 		return "raw ( 16 )"
@@ -421,8 +1874,650 @@ func oraColType(dt string, len, precision, scale int) string {
 	return datatype
 }
 
+// dialectExpr contains the per-dialect replacement for a T-SQL function.
+// An empty replacement means that there is no equivalent.
+type dialectExpr struct {
+	pg   string
+	ora  string
+	std  string
+	bare bool // the replacement is for the function name only (the arguments are kept)
+}
+
+func (de dialectExpr) pick(dbDialect dialect.DbDialect) string {
+	switch dbDialect.Dialect() {
+	case dialect.PostgreSQL:
+		return de.pg
+	case dialect.Oracle:
+		return de.ora
+	}
+	return de.std
+}
+
+// tsqlFuncs maps the (lower-case) T-SQL functions to their dialect
+// equivalents. Those that are not bare are niladic and the replacement
+// includes the empty argument list, if any.
+var tsqlFuncs = map[string]dialectExpr{
+	"abs":               {"abs", "abs", "abs", true},
+	"avg":               {"avg", "avg", "avg", true},
+	"ceiling":           {"ceiling", "ceil", "ceiling", true},
+	"coalesce":          {"coalesce", "coalesce", "coalesce", true},
+	"count":             {"count", "count", "count", true},
+	"current_timestamp": {"now()", "SYSTIMESTAMP", "CURRENT_TIMESTAMP", false},
+	"current_user":      {"current_user", "USER", "CURRENT_USER", false},
+	"datalength":        {"octet_length", "lengthb", "octet_length", true},
+	"floor":             {"floor", "floor", "floor", true},
+	"getdate":           {"now()", "SYSTIMESTAMP", "CURRENT_TIMESTAMP", false},
+	"getutcdate":        {"( now() AT TIME ZONE 'utc' )", "SYS_EXTRACT_UTC ( SYSTIMESTAMP )", "", false},
+	"isnull":            {"coalesce", "coalesce", "coalesce", true},
+	"left":              {"left", "", "", true},
+	"len":               {"length", "length", "char_length", true},
+	"lower":             {"lower", "lower", "lower", true},
+	"ltrim":             {"ltrim", "ltrim", "", true},
+	"max":               {"max", "max", "max", true},
+	"min":               {"min", "min", "min", true},
+	"newid":             {"gen_random_uuid()", "SYS_GUID()", "", false},
+	"newsequentialid":   {"gen_random_uuid()", "SYS_GUID()", "", false},
+	"nullif":            {"nullif", "nullif", "nullif", true},
+	"original_login":    {"session_user", "USER", "SESSION_USER", false},
+	"replace":           {"replace", "replace", "", true},
+	"right":             {"right", "", "", true},
+	"round":             {"round", "round", "", true},
+	"row_number":        {"row_number", "row_number", "row_number", true},
+	"rtrim":             {"rtrim", "rtrim", "", true},
+	"session_user":      {"session_user", "USER", "SESSION_USER", false},
+	"substring":         {"substring", "substr", "substring", true},
+	"sum":               {"sum", "sum", "sum", true},
+	"suser_name":        {"session_user", "USER", "SESSION_USER", false},
+	"suser_sname":       {"session_user", "USER", "SESSION_USER", false},
+	"sysdatetime":       {"now()", "SYSTIMESTAMP", "CURRENT_TIMESTAMP", false},
+	"sysutcdatetime":    {"( now() AT TIME ZONE 'utc' )", "SYS_EXTRACT_UTC ( SYSTIMESTAMP )", "", false},
+	"system_user":       {"session_user", "USER", "SYSTEM_USER", false},
+	"upper":             {"upper", "upper", "upper", true},
+	"user_name":         {"current_user", "USER", "CURRENT_USER", false},
+}
+
+// tsqlKeywords are the expression keywords that are passed through as is
+var tsqlKeywords = map[string]bool{
+	"and": true, "between": true, "case": true, "else": true, "end": true,
+	"escape": true, "exists": true, "in": true, "is": true, "like": true,
+	"not": true, "null": true, "or": true, "then": true, "when": true,
+}
+
+// queryKeywords are the additional query keywords that are passed through
+// as is when translating queries
+var queryKeywords = map[string]bool{
+	"all": true, "as": true, "asc": true, "by": true, "cross": true,
+	"desc": true, "distinct": true, "except": true, "from": true,
+	"full": true, "group": true, "having": true, "inner": true,
+	"intersect": true, "join": true, "left": true, "on": true,
+	"order": true, "outer": true, "over": true, "partition": true,
+	"right": true, "select": true, "union": true, "where": true,
+}
+
+// convertStyles maps the CONVERT date/time styles to the Pg and Oracle
+// (to_char/to_timestamp) formats
+var convertStyles = map[string][2]string{
+	"0":   {"Mon DD YYYY HH12:MIAM", "Mon DD YYYY HH12:MIAM"},
+	"1":   {"MM/DD/YY", "MM/DD/YY"},
+	"3":   {"DD/MM/YY", "DD/MM/YY"},
+	"4":   {"DD.MM.YY", "DD.MM.YY"},
+	"8":   {"HH24:MI:SS", "HH24:MI:SS"},
+	"10":  {"MM-DD-YY", "MM-DD-YY"},
+	"11":  {"YY/MM/DD", "YY/MM/DD"},
+	"12":  {"YYMMDD", "YYMMDD"},
+	"20":  {"YYYY-MM-DD HH24:MI:SS", "YYYY-MM-DD HH24:MI:SS"},
+	"21":  {"YYYY-MM-DD HH24:MI:SS.MS", "YYYY-MM-DD HH24:MI:SS.FF3"},
+	"23":  {"YYYY-MM-DD", "YYYY-MM-DD"},
+	"100": {"Mon DD YYYY HH12:MIAM", "Mon DD YYYY HH12:MIAM"},
+	"101": {"MM/DD/YYYY", "MM/DD/YYYY"},
+	"103": {"DD/MM/YYYY", "DD/MM/YYYY"},
+	"104": {"DD.MM.YYYY", "DD.MM.YYYY"},
+	"108": {"HH24:MI:SS", "HH24:MI:SS"},
+	"110": {"MM-DD-YYYY", "MM-DD-YYYY"},
+	"111": {"YYYY/MM/DD", "YYYY/MM/DD"},
+	"112": {"YYYYMMDD", "YYYYMMDD"},
+	"120": {"YYYY-MM-DD HH24:MI:SS", "YYYY-MM-DD HH24:MI:SS"},
+	"121": {"YYYY-MM-DD HH24:MI:SS.MS", "YYYY-MM-DD HH24:MI:SS.FF3"},
+	"126": {`YYYY-MM-DD"T"HH24:MI:SS.MS`, `YYYY-MM-DD"T"HH24:MI:SS.FF3`},
+}
+
+// castTypeRe parses the datatype of a CAST or CONVERT
+var castTypeRe = regexp.MustCompile(`(?i)^\s*\[?(\w+)\]?\s*(?:\(\s*(max|\d+)\s*(?:,\s*(\d+)\s*)?\))?\s*$`)
+
+// nextValue matches the remainder of a NEXT VALUE FOR [schema].[sequence]
+var nextValue = regexp.MustCompile(`^(?i)\s+VALUE\s+FOR\s+(\[[^\]]+\]|\w+)(?:\s*\.\s*(\[[^\]]+\]|\w+))?`)
+
+// bitCompare matches the comparison of a bit column to a 0/1 literal
+var bitCompare = regexp.MustCompile(`^\s*(=|<>|!=)\s*(\(*)\s*([01])\b(?:\s*(\)+))?`)
+
+// exprTranslator does a best-effort translation of T-SQL expressions
+// (defaults, check constraints, and view queries) to the target dialect
+type exprTranslator struct {
+	dbDialect dialect.DbDialect
+	bitCols   map[string]bool   // the (lower-case) names of the bit columns
+	schemas   map[string]string // the schema name mappings
+	query     bool              // translating a query, untranslated items are marked with TODO comments
+}
+
+func newExprTranslator(t bp.Table, v params) exprTranslator {
+	x := exprTranslator{dbDialect: v.dbDialect, bitCols: make(map[string]bool), schemas: v.schemas}
+	for _, c := range t.Columns {
+		if c.DataType == bp.Bit {
+			x.bitCols[strings.ToLower(c.ColName)] = true
+		}
+	}
+	return x
+}
+
+// hasBoolean indicates that bit columns are boolean for the dialect
+func (x exprTranslator) hasBoolean() bool {
+	return x.dbDialect.Dialect() != dialect.Oracle
+}
+
+// untranslated marks the current position as not translated (for
+// queries) and returns false
+func (x exprTranslator) untranslated(sb *strings.Builder, what string) bool {
+	if x.query {
+		sb.WriteString(fmt.Sprintf("/* TODO: %s */ ", what))
+	}
+	return false
+}
+
+// translate translates the expression. The ok is false if the expression
+// contains anything (functions, mostly) that could not be translated.
+func (x exprTranslator) translate(expr string) (s string, ok bool) {
+
+	ok = true
+	rs := []rune(expr)
+	var sb strings.Builder
+
+	isWordChar := func(c rune) bool {
+		return unicode.IsLetter(c) || unicode.IsDigit(c) || strings.ContainsRune("_@#$", c)
+	}
+	skipSpace := func(i int) int {
+		for i < len(rs) && unicode.IsSpace(rs[i]) {
+			i++
+		}
+		return i
+	}
+
+	for i := 0; i < len(rs); {
+		c := rs[i]
+
+		switch {
+		case c == '-' && i+1 < len(rs) && rs[i+1] == '-':
+			// Comment to the end of the line
+			j := i
+			for j < len(rs) && rs[j] != '\n' {
+				j++
+			}
+			sb.WriteString(string(rs[i:j]))
+			i = j
+
+		case c == '/' && i+1 < len(rs) && rs[i+1] == '*':
+			// Block comment
+			j := strings.Index(string(rs[i:]), "*/")
+			if j < 0 {
+				sb.WriteString(string(rs[i:]))
+				i = len(rs)
+				continue
+			}
+			end := i + len([]rune(string(rs[i:])[:j+2]))
+			sb.WriteString(string(rs[i:end]))
+			i = end
+
+		case c == '\'' || ((c == 'N' || c == 'n') && i+1 < len(rs) && rs[i+1] == '\'' && (i == 0 || !isWordChar(rs[i-1]))):
+			// String literal, the N prefix is dropped
+			if c != '\'' {
+				i++
+			}
+			j := i + 1
+			for j < len(rs) {
+				if rs[j] == '\'' {
+					if j+1 < len(rs) && rs[j+1] == '\'' {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			if j >= len(rs) {
+				j = len(rs) - 1
+			}
+			sb.WriteString(string(rs[i : j+1]))
+			i = j + 1
+
+		case c == '[' || c == '"':
+			// Quoted identifier
+			q := ']'
+			if c == '"' {
+				q = '"'
+			}
+			var name []rune
+			j := i + 1
+			for j < len(rs) {
+				if rs[j] == q {
+					if j+1 < len(rs) && rs[j+1] == q {
+						name = append(name, q)
+						j += 2
+						continue
+					}
+					break
+				}
+				name = append(name, rs[j])
+				j++
+			}
+			i = j + 1
+			if k := skipSpace(i); k < len(rs) && rs[k] == '(' {
+				// User defined function
+				ok = x.untranslated(&sb, "user defined function")
+				sb.WriteString(formatIdent(string(name), x.dbDialect))
+				continue
+			}
+			i = x.writeIdent(&sb, x.mapSchemaName(string(name), rs, i), rs, i)
+
+		case unicode.IsLetter(c) || c == '_' || c == '@' || c == '#':
+			j := i
+			for j < len(rs) && isWordChar(rs[j]) {
+				j++
+			}
+			word := string(rs[i:j])
+			lw := strings.ToLower(word)
+			i = j
+
+			k := skipSpace(i)
+			isCall := k < len(rs) && rs[k] == '('
+
+			de, known := tsqlFuncs[lw]
+			switch {
+			case known && de.bare && isCall:
+				rep := de.pick(x.dbDialect)
+				if rep == "" {
+					ok = x.untranslated(&sb, "function "+word)
+					rep = word
+				}
+				sb.WriteString(rep)
+			case known && !de.bare:
+				if isCall {
+					m := skipSpace(k + 1)
+					if m >= len(rs) || rs[m] != ')' {
+						ok = x.untranslated(&sb, "function "+word)
+						sb.WriteString(word)
+						continue
+					}
+					i = m + 1
+				}
+				rep := de.pick(x.dbDialect)
+				if rep == "" {
+					ok = x.untranslated(&sb, "function "+word)
+					rep = word + "()"
+				}
+				sb.WriteString(rep)
+			case (lw == "cast" || lw == "convert") && isCall:
+				end := matchingParen(rs, k)
+				if end < 0 {
+					ok = x.untranslated(&sb, "unbalanced "+word)
+					sb.WriteString(word)
+					continue
+				}
+				var conv string
+				var cok bool
+				if lw == "cast" {
+					conv, cok = x.translateCast(string(rs[k+1 : end]))
+				} else {
+					conv, cok = x.translateConvert(string(rs[k+1 : end]))
+				}
+				ok = ok && cok
+				sb.WriteString(conv)
+				i = end + 1
+			case tsqlKeywords[lw] || (x.query && queryKeywords[lw]):
+				sb.WriteString(strings.ToUpper(word))
+			case isCall:
+				// Unknown function
+				ok = x.untranslated(&sb, "function "+word)
+				sb.WriteString(word)
+			case lw == "next" && nextValue.MatchString(string(rs[i:])):
+				m := nextValue.FindStringSubmatch(string(rs[i:]))
+				sb.WriteString(x.nextValue(m[1], m[2]))
+				i += len([]rune(m[0]))
+			case x.query && lw == "top":
+				ok = x.untranslated(&sb, "TOP")
+				sb.WriteString(word)
+			default:
+				i = x.writeIdent(&sb, x.mapSchemaName(word, rs, i), rs, i)
+			}
+
+		case c == '+' && x.isConcat(sb.String(), rs, i):
+			sb.WriteString("||")
+			i++
+
+		default:
+			sb.WriteRune(c)
+			i++
+		}
+	}
+
+	return sb.String(), ok
+}
+
+// matchingParen returns the position of the parenthesis that closes the
+// one at position i, or -1
+func matchingParen(rs []rune, i int) int {
+
+	depth := 0
+	inQuote := false
+	for j := i; j < len(rs); j++ {
+		switch {
+		case rs[j] == '\'':
+			inQuote = !inQuote
+		case inQuote:
+		case rs[j] == '(':
+			depth++
+		case rs[j] == ')':
+			depth--
+			if depth == 0 {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+// splitArgs splits the arguments of a function call on the top-level commas
+func splitArgs(s string) (args []string) {
+
+	depth := 0
+	inQuote := false
+	last := 0
+	for i, c := range s {
+		switch {
+		case c == '\'':
+			inQuote = !inQuote
+		case inQuote:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			args = append(args, strings.TrimSpace(s[last:i]))
+			last = i + 1
+		}
+	}
+	return append(args, strings.TrimSpace(s[last:]))
+}
+
+// castType translates the datatype of a CAST or CONVERT. The base
+// datatype (lower-case) is also returned.
+func (x exprTranslator) castType(s string) (typ, base string, ok bool) {
+
+	m := castTypeRe.FindStringSubmatch(s)
+	if m == nil {
+		return s, "", false
+	}
+
+	base = strings.ToLower(m[1])
+	var length, precision, scale int
+	if m[2] != "" && strings.ToLower(m[2]) != "max" {
+		length, _ = strconv.Atoi(m[2])
+	}
+	switch base {
+	case "decimal", "numeric":
+		precision = length
+		length = 0
+		scale, _ = strconv.Atoi(m[3])
+	}
+
+	return convDatatype(base, length, precision, scale, x.dbDialect), base, true
+}
+
+// translateCast translates the arguments of a CAST ( expr AS type )
+func (x exprTranslator) translateCast(args string) (s string, ok bool) {
+
+	var sb strings.Builder
+
+	// The datatype follows the last top-level AS
+	depth := 0
+	pos := -1
+	lower := strings.ToLower(args)
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+		if depth == 0 && i+4 <= len(args) && lower[i:i+4] == " as " {
+			pos = i
+		}
+	}
+	if pos < 0 {
+		ok = x.untranslated(&sb, "CAST")
+		sb.WriteString("CAST(" + args + ")")
+		return sb.String(), ok
+	}
+
+	expr, ok := x.translate(args[:pos])
+	typ, _, tok := x.castType(args[pos+4:])
+	if !tok {
+		ok = x.untranslated(&sb, "CAST datatype")
+	}
+	sb.WriteString(fmt.Sprintf("CAST ( %s AS %s )", strings.TrimSpace(expr), typ))
+	return sb.String(), ok
+}
+
+// translateConvert translates the arguments of a CONVERT ( type, expr [, style] ).
+// The date/time styles become to_char (to character types) or
+// to_timestamp (to temporal types) formats.
+func (x exprTranslator) translateConvert(args string) (s string, ok bool) {
+
+	var sb strings.Builder
+
+	a := splitArgs(args)
+	if len(a) < 2 {
+		ok = x.untranslated(&sb, "CONVERT")
+		sb.WriteString("CONVERT(" + args + ")")
+		return sb.String(), ok
+	}
+
+	expr, ok := x.translate(a[1])
+	typ, base, tok := x.castType(a[0])
+	if !tok {
+		ok = x.untranslated(&sb, "CONVERT datatype")
+	}
+
+	if len(a) > 2 {
+		style := strings.Trim(a[2], "() ")
+		fmts, found := convertStyles[style]
+
+		var fcn string
+		switch base {
+		case "char", "varchar", "nchar", "nvarchar":
+			fcn = "to_char"
+		case "date", "datetime", "datetime2", "smalldatetime":
+			fcn = "to_timestamp"
+		}
+
+		if fcn != "" {
+			f := fmts[0]
+			if x.dbDialect.Dialect() == dialect.Oracle {
+				f = fmts[1]
+			}
+			if !found || x.dbDialect.Dialect() == dialect.StandardSQL {
+				ok = x.untranslated(&sb, "CONVERT style "+style)
+			} else {
+				if fcn == "to_char" {
+					sb.WriteString(fmt.Sprintf("CAST ( to_char ( %s, '%s' ) AS %s )", expr, f, typ))
+				} else {
+					sb.WriteString(fmt.Sprintf("to_timestamp ( %s, '%s' )", expr, f))
+				}
+				return sb.String(), ok
+			}
+		}
+	}
+
+	sb.WriteString(fmt.Sprintf("CAST ( %s AS %s )", expr, typ))
+	return sb.String(), ok
+}
+
+// mapSchemaName maps an identifier that qualifies another (that is
+// followed by a ".") using the schema name mappings
+func (x exprTranslator) mapSchemaName(name string, rs []rune, i int) string {
+	if i >= len(rs) || rs[i] != '.' {
+		return name
+	}
+	return mapSchema(name, x.schemas)
+}
+
+// nextValue translates the NEXT VALUE FOR a sequence
+func (x exprTranslator) nextValue(schema, name string) string {
+
+	schema = strings.Trim(schema, "[]")
+	name = strings.Trim(name, "[]")
+	seq := formatIdent(schema, x.dbDialect)
+	if name != "" {
+		seq = formatIdent(mapSchema(schema, x.schemas), x.dbDialect) + "." + formatIdent(name, x.dbDialect)
+	}
+
+	switch x.dbDialect.Dialect() {
+	case dialect.PostgreSQL:
+		return fmt.Sprintf("nextval('%s')", seq)
+	case dialect.Oracle:
+		return seq + ".NEXTVAL"
+	}
+	return "NEXT VALUE FOR " + seq
+}
+
+// isConcat guesses if the "+" at position i is string concatenation, that
+// is, if either operand is a string literal
+func (x exprTranslator) isConcat(prev string, rs []rune, i int) bool {
+
+	prev = strings.TrimRight(prev, " \t\r\n")
+	if strings.HasSuffix(prev, "'") {
+		return true
+	}
+
+	for j := i + 1; j < len(rs); j++ {
+		switch {
+		case unicode.IsSpace(rs[j]) || rs[j] == '(':
+			continue
+		case rs[j] == '\'':
+			return true
+		case (rs[j] == 'N' || rs[j] == 'n') && j+1 < len(rs) && rs[j+1] == '\'':
+			return true
+		}
+		return false
+	}
+	return false
+}
+
+// writeIdent writes the identifier and, for bit columns in dialects
+// having a boolean datatype, translates any comparison to a 0/1 literal
+// that follows. It returns the position to continue from.
+func (x exprTranslator) writeIdent(sb *strings.Builder, name string, rs []rune, i int) int {
+
+	sb.WriteString(formatIdent(name, x.dbDialect))
+
+	if !x.bitCols[strings.ToLower(name)] || !x.hasBoolean() {
+		return i
+	}
+
+	m := bitCompare.FindStringSubmatch(string(rs[i:]))
+	if m == nil || len(m[4]) < len(m[2]) {
+		return i
+	}
+
+	op := m[1]
+	if op == "!=" {
+		op = "<>"
+	}
+	val := "false"
+	if m[3] == "1" {
+		val = "true"
+	}
+	sb.WriteString(fmt.Sprintf(" %s %s", op, val))
+
+	// Only consume the closing parens that match the opening parens
+	consumed := strings.TrimRight(m[0], ")") + m[4][:len(m[2])]
+	return i + len([]rune(consumed))
+}
+
+// unwrapParens removes the parentheses that enclose the entire expression,
+// as in ((1)) or (getdate())
+func unwrapParens(s string) string {
+
+	for {
+		s = strings.TrimSpace(s)
+		if len(s) < 2 || s[0] != '(' || s[len(s)-1] != ')' {
+			return s
+		}
+
+		depth := 0
+		inQuote := false
+		for i := 0; i < len(s); i++ {
+			switch {
+			case s[i] == '\'':
+				inQuote = !inQuote
+			case inQuote:
+			case s[i] == '(':
+				depth++
+			case s[i] == ')':
+				depth--
+				if depth == 0 && i < len(s)-1 {
+					// The opening paren closes before the end
+					return s
+				}
+			}
+		}
+		s = s[1 : len(s)-1]
+	}
+}
+
+// translateDefault translates the default expression for the column
+func (x exprTranslator) translateDefault(c bp.TableColumn) (s string, ok bool) {
+
+	s = unwrapParens(c.Default)
+
+	if c.DataType == bp.Bit && x.hasBoolean() {
+		switch strings.Trim(s, "'") {
+		case "0":
+			return "false", true
+		case "1":
+			return "true", true
+		}
+	}
+
+	return x.translate(s)
+}
+
+// openOutput opens the appropriate target for writing output, or dies trying
+func openOutput(target string) (f *os.File) {
+
+	var err error
+
+	if target == "" || target == "-" {
+		f = os.Stdout
+	} else {
+		f, err = os.OpenFile(target, os.O_CREATE|os.O_WRONLY, 0644)
+		dieOnErrf("File open failed: %q", err)
+	}
+	return f
+}
+
+// deferredClose closes a file handle, or dies trying
+func deferredClose(f *os.File) {
+	err := f.Close()
+	dieOnErrf("File close failed: %q", err)
+}
+
 func dieOnErrf(s string, err error) {
 	if err != nil {
 		log.Fatalf(s, err)
 	}
 }
+
+func dieOnErr(err error) {
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -13,18 +13,37 @@ import (
 	"log"
 	"os"
 	"runtime/pprof"
+	"sort"
 	"strings"
 
 	//
 	bp "github.com/gsiems/bac-tract/bactract"
+
+	"github.com/gsiems/db-dialect/dialect"
 )
 
+// maxLobChars is the maximum number of characters for LOB data that
+// is written to the SQL*Loader data file
+const maxLobChars = 1048576
+
 type params struct {
 	baseDir           string
 	tableName         string
 	tablesFile        string
+	schemaMap         string
+	history           string
+	partitions        bool
 	colExceptionsFile string
 	rowLimit          uint64
+	timePrec          int
+	variantJSON       bool
+	rvUint            bool
+	identityScript    bool
+	lobDir            string
+	charset           string
+	unmappable        string
+	cs                bp.Charset
+	csPolicy          int
 	workers           int
 	cpuprofile        string
 	memprofile        string
@@ -73,8 +92,18 @@ func main() {
 	flag.StringVar(&v.tableName, "t", "", "The table to extract data from. When not specified then extract all tables")
 	flag.StringVar(&v.colExceptionsFile, "e", "", "The column exceptions data file, should there be one")
 	flag.StringVar(&v.tablesFile, "f", "", "The file to read the list of tables to extract from, one table per line")
+	flag.StringVar(&v.schemaMap, "schema-map", "", "The schema name mappings to apply to the output, comma separated source=target pairs (dbo=public).")
+	flag.BoolVar(&v.partitions, "partitions", false, "Write the data for partitioned tables to one data and control file per partition (<schema>.<table>.p<N>.dat).")
+	flag.StringVar(&v.history, "history", "include", "How to extract the history tables for temporal tables (include, exclude, or combine). Combine appends the history data to the data for the temporal table, which is then only loadable into the tables created by bp2ddl -history combine (no primary key or unique constraints).")
 	flag.Uint64Var(&v.rowLimit, "c", 0, "The number of rows to extract. When 0 extract all rows.")
+	flag.IntVar(&v.timePrec, "p", -1, "The number of fractional second digits to output for datetime, datetime2, and time values. When negative use the column scale.")
 	flag.IntVar(&v.workers, "w", 1, "The number of workers to use")
+	flag.BoolVar(&v.variantJSON, "variantjson", false, "Write sql_variant values as JSON objects containing the base type and value.")
+	flag.BoolVar(&v.rvUint, "rvuint", false, "Write rowversion (timestamp) values as unsigned integers rather than as hex.")
+	flag.StringVar(&v.lobDir, "lobdir", "", "The directory to write large values to, one file per value, for loading via LOBFILE. When not specified then large values are written to the data file.")
+	flag.StringVar(&v.charset, "charset", "UTF8", "The character set to write the data files in (Oracle, PostgreSQL, or IANA name).")
+	flag.StringVar(&v.unmappable, "unmappable", "replace", "How to deal with characters that cannot be written in the charset (replace, drop, or error).")
+	flag.BoolVar(&v.identityScript, "identity", false, "Write a post-load script, per table, that advances the identity sequences past the largest extracted value.")
 	flag.BoolVar(&v.debug, "debug", false, "Write debug information to STDOUT.")
 	flag.StringVar(&v.cpuprofile, "cpuprofile", "", "The filename to write cpu profile information to")
 	//flag.StringVar(&v.memprofile, "memprofile", "", The filename to write memory profile information to")
@@ -92,6 +121,12 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 
+	var err error
+	v.cs, err = bp.LookupCharset(v.charset)
+	dieOnErrf("Charset lookup failed: %q", err)
+	v.csPolicy, err = bp.LookupUnmappablePolicy(v.unmappable)
+	dieOnErrf("Unmappable policy lookup failed: %q", err)
+
 	tables := getTables(v)
 
 	// create the channels
@@ -124,13 +159,27 @@ func getTables(v params) (l []bp.Table) {
 	p, _ := bp.New(v.baseDir)
 
 	p.SetDebug(v.debug)
+	p.SetTimePrecision(v.timePrec)
+	if v.rvUint {
+		p.SetRowversionFormat(bp.RowversionUint64)
+	}
+	// uniqueidentifier columns are RAW ( 16 ), loaded from hex
+	p.SetGUIDFormat(bp.GUIDUpper | bp.GUIDNoDashes)
+
+	sm, err := bp.LookupSchemaMap(v.schemaMap)
+	dieOnErrf("Schema map lookup failed: %q", err)
+	p.SetSchemaMap(sm)
+
+	hm, err := bp.LookupHistoryMode(v.history)
+	dieOnErrf("History mode lookup failed: %q", err)
+	p.SetHistoryMode(hm)
 
 	model, err := p.GetModel(v.colExceptionsFile)
 	dieOnErrf("GetModel failed: %q", err)
 
 	var tables []string
 	if v.tableName != "" {
-		tables = append(tables, v.tableName)
+		tables = append(tables, p.MapTableName(v.tableName))
 	} else if v.tablesFile != "" {
 
 		content, err := ioutil.ReadFile(v.tablesFile)
@@ -138,7 +187,7 @@ func getTables(v params) (l []bp.Table) {
 
 		x := bytes.Split(content, []byte("\n"))
 		for _, z := range x {
-			tables = append(tables, string(z))
+			tables = append(tables, p.MapTableName(string(z)))
 		}
 	} else {
 		tables, err = p.ExportedTables()
@@ -147,7 +196,7 @@ func getTables(v params) (l []bp.Table) {
 
 	for _, table := range tables {
 		t, ok := model.Tables[table]
-		if ok {
+		if ok && t.IsExtracted() {
 			l = append(l, t)
 		}
 	}
@@ -157,15 +206,34 @@ func getTables(v params) (l []bp.Table) {
 
 func mkFile(t bp.Table, v params) {
 
-	err := mkLoaderCtl(t)
-	dieOnErr(err)
+	if !v.partitions || !t.IsPartitioned() {
+		err := mkLoaderCtl(t, v, 0)
+		dieOnErr(err)
+	}
 
-	err = mkLoaderDat(t, v)
+	parts, err := mkLoaderDat(t, v)
 	dieOnErr(err)
+
+	// The control files for the partitions are only generated for the
+	// partitions that have data
+	for _, part := range parts {
+		err = mkLoaderCtl(t, v, part)
+		dieOnErr(err)
+	}
+}
+
+// partSuffix returns the file name suffix for a partition
+func partSuffix(part int) string {
+	if part == 0 {
+		return ""
+	}
+	return fmt.Sprintf(".p%d", part)
 }
 
-// mkLoaderDat generates the data file for SQL*Loader
-func mkLoaderDat(t bp.Table, v params) (err error) {
+// mkLoaderDat generates the data file(s) for SQL*Loader. When splitting
+// the data by partition then the partitions that data was written for
+// are returned.
+func mkLoaderDat(t bp.Table, v params) (parts []int, err error) {
 
 	colSep := []byte(string(0x1c))
 	recSep := []byte(" 0X1E")
@@ -174,10 +242,36 @@ func mkLoaderDat(t bp.Table, v params) (err error) {
 	r, err := t.DataReader()
 	dieOnErrf("DataReader failed: %q", err)
 
-	target := fmt.Sprintf("%s.%s.dat", t.Schema, t.TabName)
-	f := openOutput(target)
-	defer deferredClose(f)
-	w := bufio.NewWriter(f)
+	// As SQL*Loader expects either the value or the file name for all
+	// values of a column, all large values get written to files. This
+	// includes the empty values as SQL*Loader would load an empty
+	// value in the data file as NULL.
+	if v.lobDir != "" {
+		err = os.MkdirAll(v.lobDir, 0755)
+		dieOnErrf("Lob directory create failed: %q", err)
+		r.SetLobFiles(0, v.lobDir)
+	}
+
+	// The output files, by partition number (0 for the whole table)
+	type datFile struct {
+		f *os.File
+		w *bufio.Writer
+	}
+	files := make(map[int]datFile)
+	defer func() {
+		for _, df := range files {
+			deferredClose(df.f)
+		}
+	}()
+	newDatFile := func(part int) datFile {
+		f := openOutput(fmt.Sprintf("%s.%s%s.dat", t.Schema, t.TabName, partSuffix(part)))
+		return datFile{f, bufio.NewWriter(v.cs.NewWriter(f, v.csPolicy))}
+	}
+
+	split := v.partitions && t.IsPartitioned()
+	if !split {
+		files[0] = newDatFile(0)
+	}
 
 	var i uint64
 	for {
@@ -196,27 +290,94 @@ func mkLoaderDat(t bp.Table, v params) (err error) {
 			break
 		}
 
+		part := 0
+		if split {
+			part = t.PartitionNumber(row)
+		}
+		df, ok := files[part]
+		if !ok {
+			df = newDatFile(part)
+			files[part] = df
+			parts = append(parts, part)
+		}
+		w := df.w
+
 		for j, ec := range row {
 			if j > 0 {
 				w.Write(colSep)
 			}
 
-			if ec.DataType != bp.Varbinary && !ec.IsNull {
-				w.Write([]byte(ec.Str))
+			if ec.LobFile != "" {
+				w.Write([]byte(ec.LobFile))
+			} else if ec.DataType != bp.Varbinary && !ec.IsNull {
+				if ec.DataType == bp.SQLVariant && v.variantJSON {
+					tj, err := ec.TypedJSON()
+					dieOnErrf("TypedJSON failed: %q", err)
+					w.Write([]byte(tj))
+				} else {
+					w.Write([]byte(ec.Str))
+				}
 			}
 		}
 		w.Write(recSep)
 		w.Write(newLine)
 
 	}
-	w.Flush()
+	for _, df := range files {
+		err = df.w.Flush()
+		if err != nil {
+			return
+		}
+	}
+	sort.Ints(parts)
+
+	if v.identityScript {
+		values := make(map[string]int64)
+		for _, c := range t.IdentityColumns() {
+			if iv, ok := r.IdentityValue(c.ColName); ok {
+				values[c.ColName] = iv
+			}
+		}
+		err = mkIdentityScript(t, values)
+	}
+	return
+}
+
+// mkIdentityScript generates the post-load script for advancing the
+// identity sequences past the largest extracted values
+func mkIdentityScript(t bp.Table, values map[string]int64) (err error) {
+
+	if len(values) == 0 {
+		return
+	}
+
+	target := fmt.Sprintf("%s.%s.identity.sql", t.Schema, t.TabName)
+	f := openOutput(target)
+	defer deferredClose(f)
+	w := bufio.NewWriter(f)
+
+	d := dialect.NewDialect("Ora")
+	tabName := fmt.Sprintf("%s.%s", formatIdent(t.Schema, d), formatIdent(t.TabName, d))
+
+	for _, c := range t.IdentityColumns() {
+		iv, ok := values[c.ColName]
+		if !ok {
+			continue
+		}
+		w.Write([]byte(fmt.Sprintf("ALTER TABLE %s MODIFY ( %s GENERATED BY DEFAULT AS IDENTITY ( START WITH %d INCREMENT BY %d ) ) ;\n",
+			tabName, formatIdent(c.ColName, d), iv+c.IdentityIncr, c.IdentityIncr)))
+	}
+
+	err = w.Flush()
 	return
 }
 
-// mkLoaderCtl generates the essential Oracle SQL*Loader control file
-func mkLoaderCtl(t bp.Table) (err error) {
+// mkLoaderCtl generates the essential Oracle SQL*Loader control file.
+// The control files for partitions append to the table so that the
+// partitions can be loaded in parallel.
+func mkLoaderCtl(t bp.Table, v params, part int) (err error) {
 
-	target := fmt.Sprintf("%s.%s.ctl", t.Schema, t.TabName)
+	target := fmt.Sprintf("%s.%s%s.ctl", t.Schema, t.TabName, partSuffix(part))
 	f := openOutput(target)
 	defer deferredClose(f)
 	w := bufio.NewWriter(f)
@@ -224,33 +385,62 @@ func mkLoaderCtl(t bp.Table) (err error) {
 	var ctl []byte
 
 	ctl = append(ctl, []byte("LOAD DATA\n")...)
-	ctl = append(ctl, []byte("CHARACTERSET UTF8\n")...)
-	ctl = append(ctl, []byte(fmt.Sprintf("INFILE %s.%s.dat \"str ' 0X1E\\n'\"\n", t.Schema, t.TabName))...)
-	ctl = append(ctl, []byte(fmt.Sprintf("TRUNCATE INTO TABLE %s\n", t.TabName))...)
+	ctl = append(ctl, []byte(fmt.Sprintf("CHARACTERSET %s\n", v.cs.OraName))...)
+	ctl = append(ctl, []byte(fmt.Sprintf("INFILE %s.%s%s.dat \"str ' 0X1E\\n'\"\n", t.Schema, t.TabName, partSuffix(part)))...)
+	if part > 0 {
+		ctl = append(ctl, []byte(fmt.Sprintf("APPEND INTO TABLE %s\n", t.TabName))...)
+	} else {
+		ctl = append(ctl, []byte(fmt.Sprintf("TRUNCATE INTO TABLE %s\n", t.TabName))...)
+	}
 	ctl = append(ctl, []byte("FIELDS TERMINATED BY X'1C'\n")...)
 	ctl = append(ctl, []byte("TRAILING NULLCOLS\n")...)
 	ctl = append(ctl, []byte("(\n")...)
 
-	for i, c := range t.Columns {
+	first := true
+	for _, c := range t.Columns {
+
+		// Computed columns (and FILESTREAM columns and column sets) are
+		// not in the data file
+		if !c.IsInBCP() {
+			continue
+		}
 
 		colName := strings.ToUpper(c.ColName)
 
-		if i > 0 {
+		if !first {
 			ctl = append(ctl, []byte(",\n")...)
 		}
+		first = false
+
+		// Large values are loaded from the files named in the data file
+		if v.lobDir != "" && c.IsLob() {
+			fileCol := colName + "_LOBFILE"
+			ctl = append(ctl, []byte(fmt.Sprintf("    %q FILLER char ( 4000 ),\n", fileCol))...)
+			// The text files are always written as UTF-8
+			lobCharset := ""
+			if !v.cs.IsUTF8() && c.DataType != bp.Image && c.DataType != bp.Varbinary {
+				lobCharset = " CHARACTERSET UTF8"
+			}
+			ctl = append(ctl, []byte(fmt.Sprintf("    %q LOBFILE ( %q%s ) TERMINATED BY EOF", colName, fileCol, lobCharset))...)
+			continue
+		}
+
 		ctl = append(ctl, []byte(fmt.Sprintf("    %q", colName))...)
 
-		if c.DtStr == "datetime" || c.DtStr == "smalldatetime" {
+		if c.DtStr == "smalldatetime" || (c.DtStr == "datetime" && c.FracSecDigits() == 0) {
 			ctl = append(ctl, []byte(" DATE \"YYYY-MM-DD HH24:MI:SS\"")...)
 		} else if c.DtStr == "date" {
 			ctl = append(ctl, []byte(" DATE \"YYYY-MM-DD\"")...)
-		} else if c.DtStr == "datetime2" {
+		} else if c.DtStr == "datetime" || c.DtStr == "datetime2" {
 			ctl = append(ctl, []byte(" TIMESTAMP \"YYYY-MM-DD HH24:MI:SS.FF\"")...)
 		}
 
 		// if len too long then add char(len)
 		if c.Length > 256 { // No, I really don't know where the threshold is...
 			ctl = append(ctl, []byte(fmt.Sprintf(" char ( %d )", c.Length))...)
+		} else if c.DataType == bp.Image {
+			// The image data is written as hex
+			ctl = append(ctl, []byte(fmt.Sprintf(" char ( %d )", maxLobChars))...)
 		}
 
 		if c.IsNullable {
@@ -266,6 +456,21 @@ func mkLoaderCtl(t bp.Table) (err error) {
 	return
 }
 
+// formatIdent formats an identifier the same way that bp2ddl does so that
+// the scripts refer to the tables and columns as created by the DDL
+func formatIdent(s string, dbDialect dialect.DbDialect) string {
+
+	if dbDialect.IsIdentifier(s) && !dbDialect.IsKeyword(s) {
+		return strings.ToLower(s)
+	}
+
+	if dbDialect.Dialect() == dialect.PostgreSQL {
+		return fmt.Sprintf("%q", strings.ToLower(s))
+	}
+	return fmt.Sprintf("%q", strings.ToUpper(s))
+
+}
+
 // openOutput opens the appropriate target for writing output, or dies trying
 func openOutput(target string) (f *os.File) {
 
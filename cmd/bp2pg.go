@@ -12,19 +12,36 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"runtime/pprof"
 	"strings"
 
 	//
 	bp "github.com/gsiems/bac-tract/bactract"
+
+	"github.com/gsiems/db-dialect/dialect"
 )
 
 type params struct {
 	baseDir           string
 	tableName         string
 	tablesFile        string
+	schemaMap         string
+	history           string
+	partitions        bool
 	colExceptionsFile string
 	rowLimit          uint64
+	timePrec          int
+	variantJSON       bool
+	rvUint            bool
+	identityScript    bool
+	lobDir            string
+	lobSize           int
+	ltree             bool
+	charset           string
+	unmappable        string
+	cs                bp.Charset
+	csPolicy          int
 	workers           int
 	cpuprofile        string
 	memprofile        string
@@ -73,8 +90,20 @@ func main() {
 	flag.StringVar(&v.tableName, "t", "", "The table to extract data from. When not specified then extract all tables")
 	flag.StringVar(&v.colExceptionsFile, "e", "", "The column exceptions data file, should there be one")
 	flag.StringVar(&v.tablesFile, "f", "", "The file to read the list of tables to extract from, one table per line")
+	flag.StringVar(&v.schemaMap, "schema-map", "", "The schema name mappings to apply to the output, comma separated source=target pairs (dbo=public).")
+	flag.BoolVar(&v.partitions, "partitions", false, "Write the data for partitioned tables to one file per partition (<schema>.<table>.p<N>.dump).")
+	flag.StringVar(&v.history, "history", "include", "How to extract the history tables for temporal tables (include, exclude, or combine). Combine appends the history data to the data for the temporal table, which is then only loadable into the tables created by bp2ddl -history combine (no primary key or unique constraints).")
 	flag.Uint64Var(&v.rowLimit, "c", 0, "The number of rows to extract. When 0 extract all rows.")
+	flag.IntVar(&v.timePrec, "p", -1, "The number of fractional second digits to output for datetime, datetime2, and time values. When negative use the column scale.")
 	flag.IntVar(&v.workers, "w", 1, "The number of workers to use")
+	flag.BoolVar(&v.variantJSON, "variantjson", false, "Write sql_variant values as JSON objects containing the base type and value.")
+	flag.BoolVar(&v.ltree, "ltree", false, "Write hierarchyid values as ltree paths.")
+	flag.BoolVar(&v.rvUint, "rvuint", false, "Write rowversion (timestamp) values as unsigned integers rather than as hex.")
+	flag.StringVar(&v.charset, "charset", "UTF8", "The character set to write the dump files in (Oracle, PostgreSQL, or IANA name).")
+	flag.StringVar(&v.unmappable, "unmappable", "replace", "How to deal with characters that cannot be written in the charset (replace, drop, or error).")
+	flag.BoolVar(&v.identityScript, "identity", false, "Write a post-load script, per table, that advances the identity sequences past the largest extracted value.")
+	flag.StringVar(&v.lobDir, "lobdir", "", "The directory to write large values to, one file per value, along with a post-load script, per table, that reads the files into the table. When not specified then large values are written to the dump file.")
+	flag.IntVar(&v.lobSize, "lobsize", 1048576, "The size, in bytes, above which large values are written to the lobdir.")
 	flag.BoolVar(&v.debug, "debug", false, "Write debug information to STDOUT.")
 	flag.StringVar(&v.cpuprofile, "cpuprofile", "", "The filename to write cpu profile information to")
 	//flag.StringVar(&v.memprofile, "memprofile", "", The filename to write memory profile information to")
@@ -93,6 +122,12 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 
+	var err error
+	v.cs, err = bp.LookupCharset(v.charset)
+	dieOnErrf("Charset lookup failed: %q", err)
+	v.csPolicy, err = bp.LookupUnmappablePolicy(v.unmappable)
+	dieOnErrf("Unmappable policy lookup failed: %q", err)
+
 	tables := getTables(v)
 
 	// create the channels
@@ -125,13 +160,27 @@ func getTables(v params) (l []bp.Table) {
 	p, _ := bp.New(v.baseDir)
 
 	p.SetDebug(v.debug)
+	p.SetTimePrecision(v.timePrec)
+	if v.rvUint {
+		p.SetRowversionFormat(bp.RowversionUint64)
+	}
+	// uniqueidentifier columns are uuid
+	p.SetGUIDFormat(bp.GUIDCanonical)
+
+	sm, err := bp.LookupSchemaMap(v.schemaMap)
+	dieOnErrf("Schema map lookup failed: %q", err)
+	p.SetSchemaMap(sm)
+
+	hm, err := bp.LookupHistoryMode(v.history)
+	dieOnErrf("History mode lookup failed: %q", err)
+	p.SetHistoryMode(hm)
 
 	model, err := p.GetModel(v.colExceptionsFile)
 	dieOnErrf("GetModel failed: %q", err)
 
 	var tables []string
 	if v.tableName != "" {
-		tables = append(tables, v.tableName)
+		tables = append(tables, p.MapTableName(v.tableName))
 	} else if v.tablesFile != "" {
 
 		content, err := ioutil.ReadFile(v.tablesFile)
@@ -139,7 +188,7 @@ func getTables(v params) (l []bp.Table) {
 
 		x := bytes.Split(content, []byte("\n"))
 		for _, z := range x {
-			tables = append(tables, string(z))
+			tables = append(tables, p.MapTableName(string(z)))
 		}
 	} else {
 		tables, err = p.ExportedTables()
@@ -148,7 +197,7 @@ func getTables(v params) (l []bp.Table) {
 
 	for _, table := range tables {
 		t, ok := model.Tables[table]
-		if ok {
+		if ok && t.IsExtracted() {
 			//hasBinary := false
 			//for _, c := range t.Columns {
 			//	if c.DataType == bp.Binary || c.DataType == bp.Varbinary {
@@ -194,12 +243,34 @@ func mkFile(t bp.Table, v params) {
 	r, err := t.DataReader()
 	dieOnErrf("DataReader failed: %q", err)
 
-	target := fmt.Sprintf("%s.%s.dump", t.Schema, t.TabName)
-	f := openOutput(target)
-	defer deferredClose(f)
-	w := bufio.NewWriter(f)
+	// The file names are written to the dump file in place of the large
+	// values so the (absolute) names need to be usable by the server
+	var lobDir string
+	if v.lobDir != "" {
+		err = os.MkdirAll(v.lobDir, 0755)
+		dieOnErrf("Lob directory create failed: %q", err)
+		lobDir, err = filepath.Abs(v.lobDir)
+		dieOnErrf("Lob directory lookup failed: %q", err)
+		r.SetLobFiles(v.lobSize, lobDir)
+	}
+	lobCols := make(map[string]bool)
+
+	// The output files, by partition number (0 for the whole table)
+	files := make(map[int]*dumpFile)
+	defer func() {
+		for _, df := range files {
+			df.w.Write(dmpEnd)
+			df.w.Write([]byte("\n\n"))
+			err := df.w.Flush()
+			dieOnErr(err)
+			deferredClose(df.f)
+		}
+	}()
 
-	writeHdr := true
+	split := v.partitions && t.IsPartitioned()
+	if !split {
+		files[0] = newDumpFile(fmt.Sprintf("%s.%s.dump", t.Schema, t.TabName), v)
+	}
 
 	var i uint64
 	for {
@@ -218,15 +289,29 @@ func mkFile(t bp.Table, v params) {
 			break
 		}
 
-		if writeHdr {
+		part := 0
+		if split {
+			part = t.PartitionNumber(row)
+		}
+		df, ok := files[part]
+		if !ok {
+			df = newDumpFile(fmt.Sprintf("%s.%s.p%d.dump", t.Schema, t.TabName, part), v)
+			files[part] = df
+		}
+		w := df.w
+
+		if df.writeHdr {
 			var cols []string
 			for _, ec := range row {
 				cols = append(cols, ec.ColName)
 			}
 
 			hdr := fmt.Sprintf("COPY %s (%s) FROM stdin;\n", t.TabName, strings.Join(cols, ","))
+			if !v.cs.IsUTF8() {
+				hdr = fmt.Sprintf("SET client_encoding = '%s';\n", v.cs.PgName) + hdr
+			}
 			w.Write([]byte(hdr))
-			writeHdr = false
+			df.writeHdr = false
 		}
 
 		for j, ec := range row {
@@ -234,11 +319,29 @@ func mkFile(t bp.Table, v params) {
 				w.Write(colSep)
 			}
 
-			if ec.DataType == bp.Varbinary || ec.IsNull {
+			// Streamed values (including varbinary) are written as the
+			// file name for the post-load script to read in
+			if ec.LobFile == "" && (ec.DataType == bp.Varbinary || ec.IsNull) {
 				w.Write(nullMk)
 			} else {
 
 				b := ec.Str
+				if ec.LobFile != "" {
+					b = ec.LobFile
+					lobCols[ec.ColName] = true
+				} else if ec.DataType == bp.SQLVariant && v.variantJSON {
+					tj, err := ec.TypedJSON()
+					dieOnErrf("TypedJSON failed: %q", err)
+					b = tj
+				}
+				if ec.DataType == bp.HierarchyID && v.ltree {
+					b = bp.HierarchyIDToLtree(b)
+				}
+				// bytea uses the \x prefixed hex format
+				if (ec.DataType == bp.Image && ec.LobFile == "") || (ec.DataType == bp.Rowversion && !v.rvUint) {
+					b = "\\x" + b
+				}
+
 				// escape some things as needed
 
 				for len(b) > 0 {
@@ -266,12 +369,119 @@ func mkFile(t bp.Table, v params) {
 		w.Write(recSep)
 	}
 
-	if i > 0 {
-		w.Write(dmpEnd)
-		w.Write([]byte("\n\n"))
+	if v.identityScript {
+		values := make(map[string]int64)
+		for _, c := range t.IdentityColumns() {
+			if iv, ok := r.IdentityValue(c.ColName); ok {
+				values[c.ColName] = iv
+			}
+		}
+		mkIdentityScript(t, values)
+	}
+
+	mkLobScript(t, lobDir, lobCols)
+}
+
+// dumpFile is an output file for the data of a table, or of a partition
+// of a table
+type dumpFile struct {
+	f        *os.File
+	w        *bufio.Writer
+	writeHdr bool
+}
+
+// newDumpFile opens a dump output file
+func newDumpFile(target string, v params) *dumpFile {
+	f := openOutput(target)
+	return &dumpFile{f, bufio.NewWriter(v.cs.NewWriter(f, v.csPolicy)), true}
+}
+
+// mkIdentityScript generates the post-load script for advancing the
+// identity sequences past the largest extracted values
+func mkIdentityScript(t bp.Table, values map[string]int64) {
+
+	if len(values) == 0 {
+		return
+	}
+
+	target := fmt.Sprintf("%s.%s.identity.sql", t.Schema, t.TabName)
+	f := openOutput(target)
+	defer deferredClose(f)
+	w := bufio.NewWriter(f)
+
+	d := dialect.NewDialect("Pg")
+	tabName := fmt.Sprintf("%s.%s", formatIdent(t.Schema, d), formatIdent(t.TabName, d))
+
+	for _, c := range t.IdentityColumns() {
+		iv, ok := values[c.ColName]
+		if !ok {
+			continue
+		}
+		// pg_get_serial_sequence parses the (schema qualified, quoted as
+		// needed) table name but takes the column name as is
+		w.Write([]byte(fmt.Sprintf("SELECT setval ( pg_get_serial_sequence ( '%s', '%s' ), %d ) ;\n",
+			strings.Replace(tabName, "'", "''", -1), strings.Replace(strings.ToLower(c.ColName), "'", "''", -1), iv)))
+	}
+
+	err := w.Flush()
+	dieOnErr(err)
+}
+
+// formatIdent formats an identifier the same way that bp2ddl does so that
+// the scripts refer to the tables and columns as created by the DDL
+func formatIdent(s string, dbDialect dialect.DbDialect) string {
+
+	if dbDialect.IsIdentifier(s) && !dbDialect.IsKeyword(s) {
+		return strings.ToLower(s)
+	}
+
+	if dbDialect.Dialect() == dialect.PostgreSQL {
+		return fmt.Sprintf("%q", strings.ToLower(s))
+	}
+	return fmt.Sprintf("%q", strings.ToUpper(s))
+
+}
+
+// mkLobScript generates the post-load script for reading the large
+// value files into the table. The dump file contains the names of the
+// files in place of the values. NB that pg_read_file and
+// pg_read_binary_file read the files on the server and require the
+// pg_read_server_files role (or superuser).
+func mkLobScript(t bp.Table, lobDir string, lobCols map[string]bool) {
+
+	if len(lobCols) == 0 {
+		return
+	}
+
+	target := fmt.Sprintf("%s.%s.lob.sql", t.Schema, t.TabName)
+	f := openOutput(target)
+	defer deferredClose(f)
+	w := bufio.NewWriter(f)
+
+	d := dialect.NewDialect("Pg")
+	tabName := fmt.Sprintf("%s.%s", formatIdent(t.Schema, d), formatIdent(t.TabName, d))
+
+	for _, c := range t.Columns {
+		if !lobCols[c.ColName] {
+			continue
+		}
+		colName := formatIdent(c.ColName, d)
+		// The lob file names all start with <dir>/<schema>.<table>.<column>.
+		prefix := filepath.Join(lobDir, fmt.Sprintf("%s.%s.%s.", t.Schema, t.TabName, c.ColName))
+		prefix = strings.Replace(prefix, "'", "''", -1)
+
+		switch c.DataType {
+		case bp.Image, bp.Varbinary:
+			w.Write([]byte(fmt.Sprintf("UPDATE %s\n    SET %s = pg_read_binary_file ( convert_from ( %s, 'UTF8' ) )\n    WHERE position ( convert_to ( '%s', 'UTF8' ) IN %s ) = 1 ;\n\n",
+				tabName, colName, colName, prefix, colName)))
+		default:
+			w.Write([]byte(fmt.Sprintf("UPDATE %s\n    SET %s = pg_read_file ( %s )\n    WHERE starts_with ( %s, '%s' ) ;\n\n",
+				tabName, colName, colName, colName, prefix)))
+		}
 	}
 
-	w.Flush()
+	err := w.Flush()
+	dieOnErr(err)
 }
 
 // openOutput opens the appropriate target for writing output, or dies trying
@@ -0,0 +1,463 @@
+// Generate a security (users, roles, and permissions) report or the role and grant scripts from an unzipped bacpac file
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime/pprof"
+	"sort"
+	"strings"
+
+	//
+	bp "github.com/gsiems/bac-tract/bactract"
+
+	"github.com/gsiems/db-dialect/dialect"
+)
+
+type params struct {
+	baseDir    string
+	format     string
+	schemaMap  string
+	dbDialect  dialect.DbDialect
+	cpuprofile string
+	memprofile string
+	debug      bool
+}
+
+// reportRow is one principal/permission/object entry in the report
+type reportRow struct {
+	Principal     string `json:"principal"`
+	PrincipalType string `json:"principalType"`
+	Permission    string `json:"permission"`
+	State         string `json:"state"`
+	ObjectClass   string `json:"objectClass"`
+	ObjectName    string `json:"objectName"`
+	Grantor       string `json:"grantor"`
+}
+
+// builtinPrincipals are the SQL Server principals that are not migrated
+var builtinPrincipals = map[string]bool{
+	"dbo":                true,
+	"guest":              true,
+	"INFORMATION_SCHEMA": true,
+	"sys":                true,
+}
+
+// pgFixedRoles maps the fixed database roles to the Pg predefined roles
+var pgFixedRoles = map[string]string{
+	"db_datareader": "pg_read_all_data",
+	"db_datawriter": "pg_write_all_data",
+}
+
+// tablePrivs are the table (and view) privileges that have Pg and Oracle equivalents
+var tablePrivs = map[string]bool{
+	"DELETE":     true,
+	"INSERT":     true,
+	"REFERENCES": true,
+	"SELECT":     true,
+	"UPDATE":     true,
+}
+
+func main() {
+
+	var v params
+	var dd string
+
+	flag.StringVar(&v.baseDir, "b", "", "The directory containing the unzipped bacpac file.")
+	flag.StringVar(&dd, "d", "", "The dialect [Ora|Pg] to generate the role and grant script for. When not specified then write the security report.")
+	flag.StringVar(&v.format, "format", "csv", "The format of the security report [csv|json].")
+	flag.StringVar(&v.schemaMap, "schema-map", "", "The schema name mappings to apply to the output, comma separated source=target pairs (dbo=public).")
+	flag.StringVar(&v.cpuprofile, "cpuprofile", "", "The filename to write cpu profile information to")
+	//flag.StringVar(&v.memprofile, "memprofile", "", The filename to write memory profile information to")
+
+	flag.Parse()
+
+	if dd != "" {
+		d := dialect.StrToDialect(dd)
+		switch d {
+		case dialect.PostgreSQL, dialect.Oracle:
+			v.dbDialect = dialect.NewDialect(dd)
+		default:
+			log.Fatalf("Unsupported dialect %q", dd)
+		}
+	}
+
+	if v.cpuprofile != "" {
+		f, err := os.Create(v.cpuprofile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = pprof.StartCPUProfile(f)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer pprof.StopCPUProfile()
+	}
+
+	doDump(v)
+}
+
+func doDump(v params) {
+
+	p, _ := bp.New(v.baseDir)
+
+	sm, err := bp.LookupSchemaMap(v.schemaMap)
+	dieOnErrf("Schema map lookup failed: %q", err)
+	p.SetSchemaMap(sm)
+
+	model, err := p.GetModel("")
+	dieOnErrf("GetModel failed: %q", err)
+
+	sort.SliceStable(model.Permissions, func(i, j int) bool {
+		a, b := model.Permissions[i], model.Permissions[j]
+		if a.Grantee != b.Grantee {
+			return a.Grantee < b.Grantee
+		}
+		if a.Object != b.Object {
+			return a.Object < b.Object
+		}
+		return a.Permission < b.Permission
+	})
+
+	if v.dbDialect == nil {
+		mkReport(v, model)
+		return
+	}
+	mkScript(v, model)
+}
+
+// mkReport writes the security report, one row per permission or role
+// membership
+func mkReport(v params, model bp.ExtractedModel) {
+
+	var rows []reportRow
+	for _, m := range model.RoleMemberships {
+		rows = append(rows, reportRow{m.Member, principalType(m.Member, model), "MEMBER", "GRANT", "ROLE", m.Role, ""})
+	}
+	for _, p := range model.Permissions {
+		rows = append(rows, reportRow{p.Grantee, principalType(p.Grantee, model), p.Permission, p.State, p.Class, p.Object, p.Grantor})
+	}
+
+	switch strings.ToLower(v.format) {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err := enc.Encode(rows)
+		dieOnErr(err)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		err := w.Write([]string{"principal", "principal_type", "permission", "state", "object_class", "object_name", "grantor"})
+		dieOnErr(err)
+		for _, r := range rows {
+			err = w.Write([]string{r.Principal, r.PrincipalType, r.Permission, r.State, r.ObjectClass, r.ObjectName, r.Grantor})
+			dieOnErr(err)
+		}
+		w.Flush()
+		dieOnErr(w.Error())
+	default:
+		log.Fatalf("Unsupported report format %q", v.format)
+	}
+}
+
+// principalType determines the type of a principal
+func principalType(name string, model bp.ExtractedModel) string {
+	if _, ok := model.Users[name]; ok {
+		return "user"
+	}
+	if _, ok := model.Roles[name]; ok {
+		return "role"
+	}
+	if strings.HasPrefix(name, "db_") {
+		return "fixed role"
+	}
+	if name == "public" {
+		return "public"
+	}
+	return "unknown"
+}
+
+// mkScript writes the CREATE ROLE/USER and GRANT script for the dialect.
+// Principals, and permissions, that have no equivalent are skipped and a
+// note is written in their place.
+func mkScript(v params, model bp.ExtractedModel) {
+
+	d := v.dbDialect.Dialect()
+
+	var names []string
+	for name := range model.Roles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if builtinPrincipals[name] {
+			continue
+		}
+		switch d {
+		case dialect.PostgreSQL:
+			fmt.Printf("CREATE ROLE %s NOLOGIN ;\n", formatIdent(name, v.dbDialect))
+		case dialect.Oracle:
+			fmt.Printf("CREATE ROLE %s ;\n", formatIdent(name, v.dbDialect))
+		}
+	}
+	if len(names) > 0 {
+		fmt.Print("\n")
+	}
+
+	names = nil
+	for name := range model.Users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		u := model.Users[name]
+		if note := skipUser(u); note != "" {
+			fmt.Printf("-- NB the user %s %s and was skipped\n\n", name, note)
+			continue
+		}
+		user := formatIdent(name, v.dbDialect)
+
+		switch d {
+		case dialect.PostgreSQL:
+			if u.AuthenticationType == "None" {
+				fmt.Printf("CREATE ROLE %s NOLOGIN ;\n", user)
+			} else {
+				fmt.Printf("-- NB set the password for %s\n", user)
+				fmt.Printf("CREATE ROLE %s LOGIN ;\n", user)
+			}
+			if u.DefaultSchema != "" && u.DefaultSchema != "dbo" {
+				fmt.Printf("ALTER ROLE %s SET search_path = %s ;\n", user, formatIdent(u.DefaultSchema, v.dbDialect))
+			}
+		case dialect.Oracle:
+			if u.AuthenticationType == "None" {
+				fmt.Printf("CREATE USER %s NO AUTHENTICATION ;\n", user)
+			} else {
+				// The password placeholder fails until it is edited
+				fmt.Printf("-- NB set the password for %s\n", user)
+				fmt.Printf("CREATE USER %s IDENTIFIED BY <password> PASSWORD EXPIRE ;\n", user)
+				fmt.Printf("GRANT CREATE SESSION TO %s ;\n", user)
+			}
+			if u.DefaultSchema != "" && u.DefaultSchema != "dbo" {
+				fmt.Printf("-- NB the default schema for %s was %s (ALTER SESSION SET CURRENT_SCHEMA)\n", user, u.DefaultSchema)
+			}
+		}
+		fmt.Print("\n")
+	}
+
+	for _, m := range model.RoleMemberships {
+		member, ok := grantee(m.Member, model, v.dbDialect)
+		if !ok {
+			fmt.Printf("-- NB the membership of %s in %s was skipped\n", m.Member, m.Role)
+			continue
+		}
+
+		role := formatIdent(m.Role, v.dbDialect)
+		if _, ok := model.Roles[m.Role]; !ok {
+			fixed, ok := pgFixedRoles[m.Role]
+			if !ok || d != dialect.PostgreSQL {
+				fmt.Printf("-- NB %s is not supported, the membership of %s was skipped\n", m.Role, m.Member)
+				continue
+			}
+			role = fixed
+		}
+		fmt.Printf("GRANT %s TO %s ;\n", role, member)
+	}
+	if len(model.RoleMemberships) > 0 {
+		fmt.Print("\n")
+	}
+
+	usage := make(map[string]bool)
+	for _, p := range model.Permissions {
+		for _, s := range grantDDL(p, model, v.dbDialect, usage) {
+			fmt.Println(s)
+		}
+	}
+}
+
+// skipUser returns the reason that a user is not migrated, if any
+func skipUser(u bp.User) string {
+	switch {
+	case builtinPrincipals[u.Name]:
+		return "is built in"
+	case u.IsCertificate:
+		return "is mapped to a certificate or key"
+	case u.AuthenticationType == "Windows" || u.AuthenticationType == "External" || strings.Contains(u.Name, "\\"):
+		return "uses Windows or external authentication"
+	}
+	return ""
+}
+
+// grantee returns the name of a principal that permissions are granted to
+func grantee(name string, model bp.ExtractedModel, dbDialect dialect.DbDialect) (string, bool) {
+	if name == "public" {
+		return "PUBLIC", true
+	}
+	if u, ok := model.Users[name]; ok {
+		return formatIdent(name, dbDialect), skipUser(u) == ""
+	}
+	if _, ok := model.Roles[name]; ok {
+		return formatIdent(name, dbDialect), true
+	}
+	return name, false
+}
+
+// grantDDL generates the GRANT statements for a permission. Schema
+// level permissions become ALL TABLES/ROUTINES IN SCHEMA grants for Pg
+// and are expanded to the objects in the schema for Oracle.
+func grantDDL(p bp.Permission, model bp.ExtractedModel, dbDialect dialect.DbDialect, usage map[string]bool) (stmts []string) {
+
+	d := dbDialect.Dialect()
+
+	to, ok := grantee(p.Grantee, model, dbDialect)
+	if !ok {
+		return []string{fmt.Sprintf("-- NB %s was skipped (unsupported grantee)", describe(p))}
+	}
+
+	var withGrant string
+	switch p.State {
+	case "GRANT":
+	case "GRANT WITH GRANT OPTION":
+		withGrant = " WITH GRANT OPTION"
+	default:
+		return []string{fmt.Sprintf("-- NB %s was skipped (%s is not supported)", describe(p), p.State)}
+	}
+
+	skip := fmt.Sprintf("-- NB %s was skipped (no equivalent privilege)", describe(p))
+
+	switch p.Class {
+	case bp.ObjectClass:
+		name := formatQN(p.Object, dbDialect)
+		_, isTable := model.Tables[p.Object]
+		_, isView := model.Views[p.Object]
+		_, isProc := model.Procedures[p.Object]
+		_, isFcn := model.Functions[p.Object]
+		_, isSeq := model.Sequences[p.Object]
+
+		switch {
+		case (isTable || isView) && tablePrivs[p.Permission]:
+			stmts = append(stmts, fmt.Sprintf("GRANT %s ON %s TO %s%s ;", p.Permission, name, to, withGrant))
+		case (isProc || isFcn) && p.Permission == "EXECUTE":
+			if d == dialect.PostgreSQL {
+				name = "ROUTINE " + name
+			}
+			stmts = append(stmts, fmt.Sprintf("GRANT EXECUTE ON %s TO %s%s ;", name, to, withGrant))
+		case isSeq && (p.Permission == "UPDATE" || p.Permission == "SELECT"):
+			if d == dialect.PostgreSQL {
+				stmts = append(stmts, fmt.Sprintf("GRANT USAGE ON SEQUENCE %s TO %s%s ;", name, to, withGrant))
+			} else {
+				stmts = append(stmts, fmt.Sprintf("GRANT SELECT ON %s TO %s%s ;", name, to, withGrant))
+			}
+		default:
+			stmts = append(stmts, skip)
+		}
+
+	case bp.SchemaClass:
+		schema := formatIdent(p.Object, dbDialect)
+
+		var objType string
+		switch {
+		case tablePrivs[p.Permission]:
+			objType = "TABLES"
+		case p.Permission == "EXECUTE":
+			objType = "ROUTINES"
+		default:
+			return []string{skip}
+		}
+
+		if d == dialect.PostgreSQL {
+			if !usage[p.Object+" "+p.Grantee] {
+				usage[p.Object+" "+p.Grantee] = true
+				stmts = append(stmts, fmt.Sprintf("GRANT USAGE ON SCHEMA %s TO %s ;", schema, to))
+			}
+			stmts = append(stmts, fmt.Sprintf("GRANT %s ON ALL %s IN SCHEMA %s TO %s%s ;", p.Permission, objType, schema, to, withGrant))
+			stmts = append(stmts, fmt.Sprintf("ALTER DEFAULT PRIVILEGES IN SCHEMA %s GRANT %s ON %s TO %s%s ;", schema, p.Permission, objType, to, withGrant))
+			break
+		}
+
+		// Oracle: grant on each of the objects in the schema
+		var objects []string
+		if objType == "TABLES" {
+			for _, t := range model.Tables {
+				if t.Schema == p.Object {
+					objects = append(objects, t.Schema+"."+t.TabName)
+				}
+			}
+			for _, vw := range model.Views {
+				if vw.Schema == p.Object {
+					objects = append(objects, vw.Schema+"."+vw.Name)
+				}
+			}
+		} else {
+			for _, pr := range model.Procedures {
+				if pr.Schema == p.Object {
+					objects = append(objects, pr.Schema+"."+pr.Name)
+				}
+			}
+			for _, f := range model.Functions {
+				if f.Schema == p.Object {
+					objects = append(objects, f.Schema+"."+f.Name)
+				}
+			}
+		}
+		sort.Strings(objects)
+
+		stmts = append(stmts, "-- "+describe(p))
+		for _, o := range objects {
+			stmts = append(stmts, fmt.Sprintf("GRANT %s ON %s TO %s%s ;", p.Permission, formatQN(o, dbDialect), to, withGrant))
+		}
+
+	default:
+		stmts = append(stmts, skip)
+	}
+
+	return stmts
+}
+
+// describe describes a permission for the notes
+func describe(p bp.Permission) string {
+	on := p.Class
+	if p.Object != "" {
+		on += " " + p.Object
+	}
+	return fmt.Sprintf("%s %s on %s to %s", p.State, p.Permission, on, p.Grantee)
+}
+
+// formatQN formats a (schema.name) qualified name
+func formatQN(qn string, dbDialect dialect.DbDialect) string {
+	var s []string
+	for _, t := range strings.SplitN(qn, ".", 2) {
+		s = append(s, formatIdent(t, dbDialect))
+	}
+	return strings.Join(s, ".")
+}
+
+func formatIdent(s string, dbDialect dialect.DbDialect) string {
+
+	if dbDialect.IsIdentifier(s) && !dbDialect.IsKeyword(s) {
+		return strings.ToLower(s)
+	}
+
+	if dbDialect.Dialect() == dialect.PostgreSQL {
+		return fmt.Sprintf("%q", strings.ToLower(s))
+	}
+	return fmt.Sprintf("%q", strings.ToUpper(s))
+
+}
+
+func dieOnErrf(s string, err error) {
+	if err != nil {
+		log.Fatalf(s, err)
+	}
+}
+
+func dieOnErr(err error) {
+	if err != nil {
+		log.Fatal(err)
+	}
+}
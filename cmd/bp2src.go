@@ -0,0 +1,187 @@
+// Extract the stored procedure, function, and trigger source from an unzipped bacpac file
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sort"
+	"strings"
+
+	//
+	bp "github.com/gsiems/bac-tract/bactract"
+)
+
+type params struct {
+	baseDir    string
+	outDir     string
+	cpuprofile string
+	memprofile string
+	debug      bool
+}
+
+// srcObject is the information needed for writing one object to a
+// source file and to the index
+type srcObject struct {
+	schema     string
+	name       string
+	objType    string
+	script     string
+	parameters []bp.Parameter
+	references []string
+}
+
+func main() {
+
+	var v params
+
+	flag.StringVar(&v.baseDir, "b", "", "The directory containing the unzipped bacpac file.")
+	flag.StringVar(&v.outDir, "o", ".", "The directory to write the source files to. The files are written as <schema>/<type>/<name>.sql along with an index.txt file.")
+	flag.StringVar(&v.cpuprofile, "cpuprofile", "", "The filename to write cpu profile information to")
+	//flag.StringVar(&v.memprofile, "memprofile", "", The filename to write memory profile information to")
+
+	flag.Parse()
+
+	if v.cpuprofile != "" {
+		f, err := os.Create(v.cpuprofile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = pprof.StartCPUProfile(f)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer pprof.StopCPUProfile()
+	}
+
+	doDump(v)
+}
+
+func doDump(v params) {
+
+	p, _ := bp.New(v.baseDir)
+
+	model, err := p.GetModel("")
+	dieOnErrf("GetModel failed: %q", err)
+
+	var objects []srcObject
+	for _, o := range model.Procedures {
+		objects = append(objects, srcObject{o.Schema, o.Name, "procedure", o.Script(), o.Parameters, o.References})
+	}
+	for _, o := range model.Functions {
+		objects = append(objects, srcObject{o.Schema, o.Name, "function", o.Script(), o.Parameters, o.References})
+	}
+	for _, o := range model.Triggers {
+		refs := o.References
+		if o.Table != "" {
+			refs = append([]string{o.Table}, refs...)
+		}
+		objects = append(objects, srcObject{o.Schema, o.Name, "trigger", o.Script(), nil, refs})
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		if objects[i].schema != objects[j].schema {
+			return objects[i].schema < objects[j].schema
+		}
+		if objects[i].objType != objects[j].objType {
+			return objects[i].objType < objects[j].objType
+		}
+		return objects[i].name < objects[j].name
+	})
+
+	err = os.MkdirAll(v.outDir, 0755)
+	dieOnErrf("Output directory create failed: %q", err)
+
+	f := openOutput(filepath.Join(v.outDir, "index.txt"))
+	defer deferredClose(f)
+	w := bufio.NewWriter(f)
+
+	fmt.Fprintln(w, strings.Join([]string{"object_schema", "object_name",
+		"object_type", "file_name", "parameters", "tables"}, "\t"))
+
+	for _, o := range objects {
+
+		fileName := filepath.Join(safeName(o.schema), o.objType, safeName(o.name)+".sql")
+		mkFile(v, fileName, o.script)
+
+		var prms []string
+		for _, prm := range o.parameters {
+			prms = append(prms, prm.String())
+		}
+
+		// Only the references to tables are listed
+		var tables []string
+		for _, ref := range o.references {
+			if _, ok := model.Tables[ref]; ok {
+				tables = append(tables, ref)
+			}
+		}
+
+		fmt.Fprintln(w, strings.Join([]string{o.schema, o.name, o.objType,
+			fileName, strings.Join(prms, ", "), strings.Join(tables, ", ")}, "\t"))
+	}
+
+	err = w.Flush()
+	dieOnErr(err)
+}
+
+// mkFile writes the script for an object to the source file
+func mkFile(v params, fileName, script string) {
+
+	target := filepath.Join(v.outDir, fileName)
+	err := os.MkdirAll(filepath.Dir(target), 0755)
+	dieOnErrf("Source directory create failed: %q", err)
+
+	f := openOutput(target)
+	defer deferredClose(f)
+
+	_, err = fmt.Fprintf(f, "%s\nGO\n", strings.TrimSpace(script))
+	dieOnErr(err)
+}
+
+// safeName replaces the characters in an object name that are not
+// valid, or are troublesome, in file names
+func safeName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < ' ' {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+func openOutput(target string) (f *os.File) {
+
+	var err error
+
+	if target == "" || target == "-" {
+		f = os.Stdout
+	} else {
+		f, err = os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		dieOnErrf("File open failed: %q", err)
+	}
+	return f
+}
+
+// deferredClose closes a file handle, or dies trying
+func deferredClose(f *os.File) {
+	err := f.Close()
+	dieOnErrf("File close failed: %q", err)
+}
+
+func dieOnErrf(s string, err error) {
+	if err != nil {
+		log.Fatalf(s, err)
+	}
+}
+
+func dieOnErr(err error) {
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -1,10 +1,9 @@
 module github.com/gsiems/bac-tract
 
-go 1.20
+go 1.23.0
 
 require (
 	github.com/gsiems/db-dialect v0.0.0-20250131160308-52df3ea8c495
 	golang.org/x/net v0.36.0
+	golang.org/x/text v0.22.0
 )
-
-require golang.org/x/text v0.22.0 // indirect